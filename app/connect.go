@@ -0,0 +1,24 @@
+package app
+
+import (
+	"context"
+	"io"
+
+	"github.com/gold-kou/prism-in-k8s/app/connect"
+	"github.com/gold-kou/prism-in-k8s/app/k8s"
+	"github.com/gold-kou/prism-in-k8s/app/params"
+)
+
+// connectMock port-forwards a local port to the mock until the context is canceled.
+// When the pod is restarted, it re-resolves the running pod and forwards the same local port again.
+func connectMock(ctx context.Context, out io.Writer, config *params.Config) error {
+	namespaceName, resourceName := config.NamespaceName(), config.ResourceName()
+	forward := func(ctx context.Context, localPort int, stopCh <-chan struct{}) (int, <-chan error, error) {
+		return k8s.PortForward(ctx, kubeConfig, k8sClientSet, namespaceName, resourceName, localPort, k8s.PodPort(config), stopCh) //nolint:wrapcheck // already wrapped
+	}
+	return connect.Run(ctx, out, forward, connect.Options{ //nolint:wrapcheck // already wrapped
+		Target:    namespaceName + "/" + resourceName,
+		LocalPort: localPort,
+		EnvFile:   envFile,
+	})
+}
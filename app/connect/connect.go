@@ -0,0 +1,118 @@
+// Package connect keeps a local port forwarded to the mock across the restarts of its pods.
+package connect
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// EnvKey is the key of the local base URL written to the env file
+	EnvKey            = "PRISM_MOCK_URL"
+	reconnectInterval = 1 * time.Second
+)
+
+// Forward forwards the local port to a running pod of the mock until stopCh is closed, e.g. with k8s.PortForward.
+// A random port is used if localPort is 0. It returns the local port and a channel receiving the error when the forwarding stops.
+type Forward func(ctx context.Context, localPort int, stopCh <-chan struct{}) (int, <-chan error, error)
+
+// Options are the settings of Run.
+type Options struct {
+	// Target is the namespace/name of the mock shown in the output
+	Target string
+	// LocalPort is a random port if 0
+	LocalPort int
+	// EnvFile is written with EnvKey if not empty
+	EnvFile string
+}
+
+// Run port-forwards a local port to the mock until the context is canceled.
+// When the pod is restarted, it forwards the same local port again, retrying until a pod is running.
+func Run(ctx context.Context, out io.Writer, forward Forward, options Options) error {
+	port := options.LocalPort
+	connected := false
+	for {
+		stopCh := make(chan struct{})
+		forwardedPort, doneCh, err := forward(ctx, port, stopCh)
+		if err != nil {
+			close(stopCh)
+			if !connected {
+				return xerrors.Errorf("failed to connect to %s: %w", options.Target, err)
+			}
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("[WARN] Failed to reconnect, retrying: %v", err)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(reconnectInterval):
+			}
+			continue
+		}
+
+		if !connected {
+			connected = true
+			// keep the same URL on reconnect
+			port = forwardedPort
+			url := "http://localhost:" + strconv.Itoa(forwardedPort)
+			fmt.Fprintf(out, "Forwarding %s to %s\n", url, options.Target)
+			if options.EnvFile != "" {
+				if err := WriteEnvFile(options.EnvFile, EnvKey, url); err != nil {
+					close(stopCh)
+					return err
+				}
+				log.Printf("[INFO] %s is written to %s", EnvKey, options.EnvFile)
+			}
+		} else {
+			log.Println("[INFO] Reconnected")
+		}
+
+		select {
+		case <-ctx.Done():
+			close(stopCh)
+			return nil
+		case err := <-doneCh:
+			close(stopCh)
+			log.Printf("[WARN] Port-forwarding is stopped, reconnecting: %v", err)
+		}
+	}
+}
+
+// WriteEnvFile sets the key in the env file, keeping the other lines. The file is created if it does not exist.
+func WriteEnvFile(path, key, value string) error {
+	lines := []string{}
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("failed to read %s: %w", path, err)
+	}
+	if len(content) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	}
+
+	entry := key + "=" + value
+	found := false
+	for i, line := range lines {
+		if strings.HasPrefix(line, key+"=") {
+			lines[i] = entry
+			found = true
+		}
+	}
+	if !found {
+		lines = append(lines, entry)
+	}
+
+	err = os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+	if err != nil {
+		return xerrors.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
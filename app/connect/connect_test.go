@@ -0,0 +1,156 @@
+package connect_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/connect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteEnvFile(t *testing.T) {
+	tests := []struct {
+		name string
+		// the file does not exist if nil
+		content *string
+		want    string
+	}{
+		{
+			name: "new file",
+			want: "PRISM_MOCK_URL=http://localhost:4010\n",
+		},
+		{
+			name:    "empty file",
+			content: ptr(""),
+			want:    "PRISM_MOCK_URL=http://localhost:4010\n",
+		},
+		{
+			name:    "append",
+			content: ptr("API_KEY=secret\n"),
+			want:    "API_KEY=secret\nPRISM_MOCK_URL=http://localhost:4010\n",
+		},
+		{
+			name:    "replace",
+			content: ptr("API_KEY=secret\nPRISM_MOCK_URL=http://localhost:1234\nDEBUG=true\n"),
+			want:    "API_KEY=secret\nPRISM_MOCK_URL=http://localhost:4010\nDEBUG=true\n",
+		},
+		{
+			name:    "similar key is kept",
+			content: ptr("PRISM_MOCK_URL_OLD=http://localhost:1234"),
+			want:    "PRISM_MOCK_URL_OLD=http://localhost:1234\nPRISM_MOCK_URL=http://localhost:4010\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ".env")
+			if tt.content != nil {
+				require.NoError(t, os.WriteFile(path, []byte(*tt.content), 0o600))
+			}
+
+			// test target
+			err := connect.WriteEnvFile(path, connect.EnvKey, "http://localhost:4010")
+
+			// verify
+			require.NoError(t, err)
+			got, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+// fakeForward returns the results in order, one per call, and records the local ports requested.
+type fakeForward struct {
+	results    []forwardResult
+	localPorts []int
+}
+
+type forwardResult struct {
+	port   int
+	doneCh chan error
+	err    error
+	// called before returning, e.g. to cancel the context
+	hook func()
+}
+
+func (f *fakeForward) forward(_ context.Context, localPort int, _ <-chan struct{}) (int, <-chan error, error) {
+	f.localPorts = append(f.localPorts, localPort)
+	result := f.results[len(f.localPorts)-1]
+	if result.hook != nil {
+		result.hook()
+	}
+	return result.port, result.doneCh, result.err
+}
+
+func TestRun(t *testing.T) {
+	t.Run("reconnect the same port", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stopped := make(chan error, 1)
+		stopped <- errors.New("pod is restarted")
+		forward := &fakeForward{results: []forwardResult{
+			{port: 4010, doneCh: stopped},
+			{err: errors.New("no running pod found")},
+			{port: 4010, doneCh: make(chan error), hook: cancel},
+		}}
+		envFile := filepath.Join(t.TempDir(), ".env")
+		out := &bytes.Buffer{}
+
+		// test target
+		err := connect.Run(ctx, out, forward.forward, connect.Options{Target: "ns/name", EnvFile: envFile})
+
+		// verify
+		require.NoError(t, err)
+		assert.Equal(t, []int{0, 4010, 4010}, forward.localPorts)
+		assert.Equal(t, "Forwarding http://localhost:4010 to ns/name\n", out.String())
+		content, err := os.ReadFile(envFile)
+		require.NoError(t, err)
+		assert.Equal(t, "PRISM_MOCK_URL=http://localhost:4010\n", string(content))
+	})
+
+	t.Run("first connection fails", func(t *testing.T) {
+		forward := &fakeForward{results: []forwardResult{
+			{err: errors.New("no running pod found")},
+		}}
+
+		// test target
+		err := connect.Run(context.Background(), &bytes.Buffer{}, forward.forward, connect.Options{Target: "ns/name"})
+
+		// verify
+		require.ErrorContains(t, err, "no running pod found")
+	})
+
+	t.Run("canceled while waiting to reconnect", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stopped := make(chan error, 1)
+		stopped <- errors.New("pod is restarted")
+		forward := &fakeForward{results: []forwardResult{
+			{port: 4010, doneCh: stopped},
+			{err: errors.New("no running pod found"), hook: func() {
+				time.AfterFunc(10*time.Millisecond, cancel)
+			}},
+		}}
+		start := time.Now()
+
+		// test target
+		err := connect.Run(ctx, &bytes.Buffer{}, forward.forward, connect.Options{Target: "ns/name"})
+
+		// verify
+		require.NoError(t, err)
+		assert.Len(t, forward.localPorts, 2)
+		// returns without waiting for the retry interval of 1s
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+	})
+}
+
+func ptr(s string) *string {
+	return &s
+}
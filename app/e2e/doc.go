@@ -0,0 +1,3 @@
+// Package e2e has the end-to-end tests against a kind cluster with Istio installed.
+// They are behind the e2e build tag, run them with `make test-e2e`.
+package e2e
@@ -0,0 +1,239 @@
+//go:build e2e
+
+package e2e_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/k8s"
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/gold-kou/prism-in-k8s/app/prismmock"
+	"github.com/gold-kou/prism-in-k8s/app/testutil"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"istio.io/client-go/pkg/clientset/versioned"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	paramsPath  = "../../config/params.yaml"
+	openAPIPath = "testdata/openapi.yaml"
+	curlImage   = "yauritux/busybox-curl:latest"
+	curlPodName = "curl"
+	// the sample fault injection of the VirtualService
+	faultDelay     = 100 * time.Millisecond
+	delayTolerance = 1 * time.Second
+	timeout        = 5 * time.Minute
+)
+
+type environment struct {
+	kubeconfig     *restclient.Config
+	k8sClientSet   kubernetes.Interface
+	istioClientSet versioned.Interface
+	client         *prismmock.Client
+}
+
+func setUp(t *testing.T) *environment {
+	t.Helper()
+	kubeconfigPath := clientcmd.NewDefaultPathOptions().GetDefaultFilename()
+	kubeconfig, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	require.NoError(t, err)
+	k8sClientSet, err := kubernetes.NewForConfig(kubeconfig)
+	require.NoError(t, err)
+	istioClientSet, err := versioned.NewForConfig(kubeconfig)
+	require.NoError(t, err)
+	client, err := prismmock.New(prismmock.Options{KubeClient: k8sClientSet, IstioClient: istioClientSet, Creator: "e2e"})
+	require.NoError(t, err)
+	return &environment{
+		kubeconfig:     kubeconfig,
+		k8sClientSet:   k8sClientSet,
+		istioClientSet: istioClientSet,
+		client:         client,
+	}
+}
+
+// newMock returns the mock of config/params.yaml in a unique namespace.
+func newMock(t *testing.T) *prismmock.Mock {
+	t.Helper()
+	config, err := params.LoadConfig(paramsPath)
+	require.NoError(t, err)
+	config.MicroserviceNamespace = "e2e-" + uuid.NewString()[:8]
+	config.IstioMode = true
+	require.NoError(t, params.ValidateParams(config))
+
+	openAPI, err := os.ReadFile(openAPIPath)
+	require.NoError(t, err)
+	return &prismmock.Mock{Config: *config, OpenAPI: string(openAPI)}
+}
+
+// specExample returns the JSON example of the 200 response of GET path in the OpenAPI definition.
+func specExample(t *testing.T, openAPI, path string) interface{} {
+	t.Helper()
+	var spec struct {
+		Paths map[string]struct {
+			Get struct {
+				Responses map[string]struct {
+					Content map[string]struct {
+						Example interface{} `json:"example"`
+					} `json:"content"`
+				} `json:"responses"`
+			} `json:"get"`
+		} `json:"paths"`
+	}
+	require.NoError(t, yaml.Unmarshal([]byte(openAPI), &spec))
+	return spec.Paths[path].Get.Responses["200"].Content["application/json"].Example
+}
+
+type curlResult struct {
+	body       string
+	statusCode int
+	duration   time.Duration
+}
+
+// curl requests the URL from the curl pod to go through its Istio sidecar.
+func curl(ctx context.Context, t *testing.T, env *environment, namespace, url string) curlResult {
+	t.Helper()
+	stdout, err := testutil.ExecInPod(ctx, env.kubeconfig, env.k8sClientSet, namespace, curlPodName, curlPodName,
+		[]string{"curl", "-s", "-m", "10", "-w", "\n%{http_code} %{time_total}", url})
+	require.NoError(t, err)
+
+	index := strings.LastIndex(stdout, "\n")
+	require.NotEqual(t, -1, index, stdout)
+	var statusCode int
+	var seconds float64
+	_, err = fmt.Sscanf(stdout[index+1:], "%d %f", &statusCode, &seconds)
+	require.NoError(t, err, stdout)
+	return curlResult{
+		body:       stdout[:index],
+		statusCode: statusCode,
+		duration:   time.Duration(seconds * float64(time.Second)),
+	}
+}
+
+// curlUntilOK retries until the sidecars get the routes from istiod.
+func curlUntilOK(ctx context.Context, t *testing.T, env *environment, namespace, url string) curlResult {
+	t.Helper()
+	var result curlResult
+	for range 30 {
+		result = curl(ctx, t, env, namespace, url)
+		if result.statusCode == http.StatusOK {
+			return result
+		}
+		time.Sleep(1 * time.Second)
+	}
+	require.Equal(t, http.StatusOK, result.statusCode, result.body)
+	return result
+}
+
+func createCurlPod(ctx context.Context, t *testing.T, env *environment, namespace string) {
+	t.Helper()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      curlPodName,
+			Namespace: namespace,
+			Labels:    map[string]string{"app": curlPodName},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:    curlPodName,
+					Image:   curlImage,
+					Command: []string{"sleep", "3600"},
+				},
+			},
+		},
+	}
+	_, err := env.k8sClientSet.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, testutil.WaitForPodReady(ctx, env.k8sClientSet, namespace, curlPodName))
+}
+
+func TestMock(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	env := setUp(t)
+	mock := newMock(t)
+	namespaceName, resourceName := mock.Names()
+	t.Cleanup(func() {
+		// in case the test fails before deleting
+		_ = env.client.Delete(context.Background(), mock)
+	})
+
+	// create
+	require.NoError(t, env.client.Create(ctx, mock))
+	status, err := env.client.WaitReady(ctx, mock)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), status.ReadyReplicas)
+	// in the same namespace as the mock to get the sidecar injected
+	createCurlPod(ctx, t, env, namespaceName)
+
+	t.Run("response bodies match the spec examples", func(t *testing.T) {
+		for _, path := range []string{"/users", "/users/{id}"} {
+			result := curlUntilOK(ctx, t, env, namespaceName, mock.URL()+strings.ReplaceAll(path, "{id}", "1"))
+			var body interface{}
+			require.NoError(t, json.Unmarshal([]byte(result.body), &body), result.body)
+			assert.Equal(t, specExample(t, mock.OpenAPI, path), body, path)
+		}
+	})
+
+	t.Run("fault delays are applied", func(t *testing.T) {
+		curlUntilOK(ctx, t, env, namespaceName, mock.URL()+"/example1/users")
+		for range 3 {
+			result := curl(ctx, t, env, namespaceName, mock.URL()+"/example1/users")
+			assert.Equal(t, http.StatusOK, result.statusCode)
+			assert.GreaterOrEqual(t, result.duration, faultDelay)
+			assert.Less(t, result.duration, faultDelay+delayTolerance)
+		}
+	})
+
+	t.Run("port-forward", func(t *testing.T) {
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		localPort, _, err := k8s.PortForward(ctx, env.kubeconfig, env.k8sClientSet, namespaceName, resourceName, 0, mock.PrismPort, stopCh)
+		require.NoError(t, err)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:"+strconv.Itoa(localPort)+"/users", nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("delete leaves no resources behind", func(t *testing.T) {
+		require.NoError(t, env.client.Delete(ctx, mock))
+
+		_, err := env.istioClientSet.NetworkingV1alpha3().VirtualServices(namespaceName).Get(ctx, resourceName, metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+		// all the other resources are deleted with the namespace
+		deleted := false
+		for range 120 {
+			_, err := env.k8sClientSet.CoreV1().Namespaces().Get(ctx, namespaceName, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				deleted = true
+				break
+			}
+			time.Sleep(1 * time.Second)
+		}
+		assert.True(t, deleted, "namespace %s is not deleted", namespaceName)
+		mocks, err := k8s.ListMocks(ctx, env.k8sClientSet, "")
+		require.NoError(t, err)
+		for _, found := range mocks {
+			assert.NotEqual(t, namespaceName, found.Namespace)
+		}
+	})
+}
@@ -0,0 +1,196 @@
+// Package faultproxy is a reverse proxy in front of Prism in the same pod, which injects the faults of the routes of the parameters,
+// e.g. the latency distributions which Istio does not support.
+package faultproxy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v2"
+)
+
+// RoutesKey is the key of the routes in the ConfigMap of the fault proxy.
+const RoutesKey = "routes.yaml"
+
+// ReloadedMessage is logged by Watch when the routes are reloaded, to find when a change takes effect.
+const ReloadedMessage = "routes are reloaded"
+
+const abortBody = "fault filter abort"
+
+var errInvalidRoutes = errors.New("invalid fault proxy routes")
+
+// quantiles are the points of the piecewise linear quantile function of the percentiles.
+// The delays are uniform between the percentiles, and capped at p99.
+var quantiles = []float64{0, 0.5, 0.9, 0.99, 1}
+
+// Proxy forwards the requests to the target after the latency and the faults of the first matching route.
+type Proxy struct {
+	proxy *httputil.ReverseProxy
+
+	mu     sync.Mutex
+	routes []params.Route
+	random *rand.Rand
+}
+
+// New returns the proxy to the target, e.g. http://127.0.0.1:80 for Prism in the same pod.
+func New(target *url.URL, routes []params.Route) *Proxy {
+	return &Proxy{
+		proxy:  httputil.NewSingleHostReverseProxy(target),
+		routes: routes,
+		random: rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())), //nolint:gosec // not for security
+	}
+}
+
+// SetRoutes replaces the routes. It is safe to call while serving.
+func (p *Proxy) SetRoutes(routes []params.Route) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.routes = routes
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	delay, abort := p.faults(r)
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			// the client is gone
+			timer.Stop()
+			return
+		}
+	}
+	if abort != 0 {
+		// the same body as the fault injection of Envoy
+		http.Error(w, abortBody, abort)
+		return
+	}
+	p.proxy.ServeHTTP(w, r)
+}
+
+// faults returns the delay and the status code to abort with, or 0, of the first route matching the request.
+func (p *Proxy) faults(r *http.Request) (time.Duration, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, route := range p.routes {
+		if !Match(route.Match, r) {
+			continue
+		}
+		delay := Sample(route.Latency, p.random)
+		fault := route.Fault
+		if fault.Delay.FixedDelay != 0 && p.hit(fault.Delay.AppliedPercentage()) {
+			delay += fault.Delay.FixedDelay
+		}
+		abort := 0
+		if fault.Abort.HTTPStatus != 0 && p.hit(fault.Abort.AppliedPercentage()) {
+			abort = fault.Abort.HTTPStatus
+		}
+		return delay, abort
+	}
+	return 0, 0
+}
+
+// hit returns true for the percentage of the calls.
+func (p *Proxy) hit(percentage float64) bool {
+	return p.random.Float64()*100 < percentage //nolint:mnd // percent
+}
+
+// Match returns true if the request matches all the set fields of the match.
+func Match(match params.RouteMatch, r *http.Request) bool {
+	if match.PathPrefix != "" && !strings.HasPrefix(r.URL.Path, match.PathPrefix) {
+		return false
+	}
+	if match.Method != "" && !strings.EqualFold(match.Method, r.Method) {
+		return false
+	}
+	for name, value := range match.Headers {
+		if r.Header.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Sample returns a delay of the latency distribution.
+func Sample(latency params.Latency, random *rand.Rand) time.Duration {
+	switch latency.Distribution {
+	case params.DistributionNormal:
+		delay := float64(latency.Mean) + random.NormFloat64()*float64(latency.StdDev)
+		return time.Duration(math.Max(0, delay))
+	case params.DistributionLogNormal:
+		// the parameters of the underlying normal distribution for the mean and the standard deviation of the delays
+		mean, stdDev := float64(latency.Mean), float64(latency.StdDev)
+		sigma := math.Sqrt(math.Log(1 + stdDev*stdDev/(mean*mean)))
+		mu := math.Log(mean) - sigma*sigma/2 //nolint:mnd // the formula of the log-normal distribution
+		return time.Duration(math.Exp(mu + sigma*random.NormFloat64()))
+	default:
+		return percentile(latency, random.Float64())
+	}
+}
+
+// percentile returns the delay at the quantile u of the percentiles.
+func percentile(latency params.Latency, u float64) time.Duration {
+	delays := []time.Duration{0, latency.P50, latency.P90, latency.P99, latency.P99}
+	for i := 1; i < len(quantiles); i++ {
+		if u <= quantiles[i] {
+			ratio := (u - quantiles[i-1]) / (quantiles[i] - quantiles[i-1])
+			return delays[i-1] + time.Duration(ratio*float64(delays[i]-delays[i-1]))
+		}
+	}
+	return latency.P99
+}
+
+// MarshalRoutes encodes the routes for the ConfigMap of the fault proxy.
+func MarshalRoutes(routes []params.Route) (string, error) {
+	marshaled, err := yaml.Marshal(routes)
+	if err != nil {
+		return "", xerrors.Errorf("%w: %w", errInvalidRoutes, err)
+	}
+	return string(marshaled), nil
+}
+
+// UnmarshalRoutes decodes the routes encoded by MarshalRoutes.
+func UnmarshalRoutes(content []byte) ([]params.Route, error) {
+	var routes []params.Route
+	if err := yaml.UnmarshalStrict(content, &routes); err != nil {
+		return nil, xerrors.Errorf("%w: %w", errInvalidRoutes, err)
+	}
+	return routes, nil
+}
+
+// Watch reloads the routes file into the proxy when it changes, e.g. when the mounted ConfigMap is updated, until the context is done.
+func Watch(ctx context.Context, proxy *Proxy, read func() ([]byte, error), interval time.Duration) {
+	previous, _ := read()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		content, err := read()
+		if err != nil || string(content) == string(previous) {
+			continue
+		}
+		routes, err := UnmarshalRoutes(content)
+		if err != nil {
+			log.Printf("[WARN] The routes are not reloaded: %v", err)
+			continue
+		}
+		previous = content
+		proxy.SetRoutes(routes)
+		log.Printf("[INFO] %d %s", len(routes), ReloadedMessage)
+	}
+}
@@ -0,0 +1,246 @@
+package faultproxy_test
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/faultproxy"
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		match params.RouteMatch
+		want  bool
+	}{
+		{name: "empty match", match: params.RouteMatch{}, want: true},
+		{name: "path prefix", match: params.RouteMatch{PathPrefix: "/users"}, want: true},
+		{name: "other path prefix", match: params.RouteMatch{PathPrefix: "/pets"}, want: false},
+		{name: "method in lower case", match: params.RouteMatch{Method: "get"}, want: true},
+		{name: "other method", match: params.RouteMatch{Method: "POST"}, want: false},
+		{name: "header", match: params.RouteMatch{Headers: map[string]string{"x-test": "slow"}}, want: true},
+		{name: "other header value", match: params.RouteMatch{Headers: map[string]string{"x-test": "fast"}}, want: false},
+		{name: "all fields", match: params.RouteMatch{PathPrefix: "/users", Method: "GET", Headers: map[string]string{"X-Test": "slow"}}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			r.Header.Set("X-Test", "slow")
+
+			// test target
+			got := faultproxy.Match(tt.match, r)
+
+			// verify
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSample(t *testing.T) {
+	const samples = 20000
+	tests := []struct {
+		name    string
+		latency params.Latency
+		verify  func(t *testing.T, delays []time.Duration)
+	}{
+		{
+			name:    "percentiles",
+			latency: params.Latency{P50: 50 * time.Millisecond, P90: 200 * time.Millisecond, P99: time.Second},
+			verify: func(t *testing.T, delays []time.Duration) {
+				t.Helper()
+				assert.InDelta(t, 0.5, ratioAtMost(delays, 50*time.Millisecond), 0.02)
+				assert.InDelta(t, 0.9, ratioAtMost(delays, 200*time.Millisecond), 0.02)
+				assert.InDelta(t, 0.99, ratioAtMost(delays, time.Second-time.Nanosecond), 0.005)
+				assert.InDelta(t, 1, ratioAtMost(delays, time.Second), 0)
+			},
+		},
+		{
+			name:    "normal",
+			latency: params.Latency{Distribution: params.DistributionNormal, Mean: 100 * time.Millisecond, StdDev: 10 * time.Millisecond},
+			verify: func(t *testing.T, delays []time.Duration) {
+				t.Helper()
+				assert.InDelta(t, float64(100*time.Millisecond), float64(mean(delays)), float64(time.Millisecond))
+				assert.InDelta(t, 0.5, ratioAtMost(delays, 100*time.Millisecond), 0.02)
+			},
+		},
+		{
+			name:    "normal never negative",
+			latency: params.Latency{Distribution: params.DistributionNormal, Mean: time.Millisecond, StdDev: 10 * time.Millisecond},
+			verify: func(t *testing.T, delays []time.Duration) {
+				t.Helper()
+				assert.InDelta(t, 0, ratioAtMost(delays, -time.Nanosecond), 0)
+			},
+		},
+		{
+			name:    "lognormal",
+			latency: params.Latency{Distribution: params.DistributionLogNormal, Mean: 100 * time.Millisecond, StdDev: 50 * time.Millisecond},
+			verify: func(t *testing.T, delays []time.Duration) {
+				t.Helper()
+				assert.InDelta(t, float64(100*time.Millisecond), float64(mean(delays)), float64(2*time.Millisecond))
+				// the median of a right-skewed distribution is below the mean
+				assert.Greater(t, ratioAtMost(delays, 100*time.Millisecond), 0.5)
+				assert.InDelta(t, 0, ratioAtMost(delays, 0), 0)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			random := rand.New(rand.NewPCG(1, 2)) //nolint:gosec // not for security
+
+			// test target
+			delays := make([]time.Duration, samples)
+			for i := range delays {
+				delays[i] = faultproxy.Sample(tt.latency, random)
+			}
+
+			// verify
+			tt.verify(t, delays)
+		})
+	}
+}
+
+func ratioAtMost(delays []time.Duration, limit time.Duration) float64 {
+	count := 0
+	for _, delay := range delays {
+		if delay <= limit {
+			count++
+		}
+	}
+	return float64(count) / float64(len(delays))
+}
+
+func mean(delays []time.Duration) time.Duration {
+	var sum time.Duration
+	for _, delay := range delays {
+		sum += delay
+	}
+	return sum / time.Duration(len(delays))
+}
+
+func TestProxy(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	prism := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer prism.Close()
+	target, err := url.Parse(prism.URL)
+	require.NoError(t, err)
+	routes := []params.Route{
+		{Name: "slow-users", Match: params.RouteMatch{PathPrefix: "/users"}, Latency: params.Latency{Distribution: params.DistributionNormal, Mean: delay}},
+		{Name: "delayed-pets", Match: params.RouteMatch{PathPrefix: "/pets", Headers: map[string]string{"x-fault": "delay"}}, Fault: params.Fault{Delay: params.FaultDelay{FixedDelay: delay}}},
+		{Name: "unavailable-pets", Match: params.RouteMatch{PathPrefix: "/pets", Method: "POST"}, Fault: params.Fault{Abort: params.FaultAbort{HTTPStatus: http.StatusServiceUnavailable}}},
+		{Name: "never-aborted-pets", Match: params.RouteMatch{PathPrefix: "/pets", Method: "DELETE"}, Fault: params.Fault{Abort: params.FaultAbort{HTTPStatus: http.StatusServiceUnavailable, Percentage: 1e-9}}},
+	}
+	proxy := httptest.NewServer(faultproxy.New(target, routes))
+	defer proxy.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		header     http.Header
+		wantStatus int
+		delayed    bool
+	}{
+		{name: "latency", method: http.MethodGet, path: "/users/1", wantStatus: http.StatusTeapot, delayed: true},
+		{name: "no matching route", method: http.MethodGet, path: "/pets/1", wantStatus: http.StatusTeapot, delayed: false},
+		{name: "fault delay", method: http.MethodGet, path: "/pets/1", header: http.Header{"X-Fault": {"delay"}}, wantStatus: http.StatusTeapot, delayed: true},
+		{name: "fault abort", method: http.MethodPost, path: "/pets", wantStatus: http.StatusServiceUnavailable, delayed: false},
+		{name: "fault abort not hit", method: http.MethodDelete, path: "/pets/1", wantStatus: http.StatusTeapot, delayed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(context.Background(), tt.method, proxy.URL+tt.path, nil)
+			require.NoError(t, err)
+			req.Header = tt.header
+
+			// test target
+			start := time.Now()
+			resp, err := http.DefaultClient.Do(req)
+			elapsed := time.Since(start)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			// verify
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			if tt.delayed {
+				assert.GreaterOrEqual(t, elapsed, delay)
+			} else {
+				assert.Less(t, elapsed, delay)
+			}
+		})
+	}
+}
+
+func TestMarshalRoutes(t *testing.T) {
+	routes := []params.Route{
+		{Name: "slow-users", Match: params.RouteMatch{PathPrefix: "/users", Method: "GET", Headers: map[string]string{"x-test": "slow"}}, Latency: params.Latency{P50: 50 * time.Millisecond, P90: 200 * time.Millisecond, P99: time.Second}},
+		{Name: "default", Latency: params.Latency{Distribution: params.DistributionLogNormal, Mean: 100 * time.Millisecond, StdDev: 50 * time.Millisecond}},
+	}
+
+	// test target
+	marshaled, err := faultproxy.MarshalRoutes(routes)
+	require.NoError(t, err)
+	got, err := faultproxy.UnmarshalRoutes([]byte(marshaled))
+
+	// verify
+	require.NoError(t, err)
+	assert.Equal(t, routes[0], got[0])
+	assert.Equal(t, routes[1].Latency, got[1].Latency)
+}
+
+func TestUnmarshalRoutesUnknownField(t *testing.T) {
+	// test target
+	_, err := faultproxy.UnmarshalRoutes([]byte("- name: users\n  delay: 1s\n"))
+
+	// verify
+	require.Error(t, err)
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	target, err := url.Parse("http://127.0.0.1:80")
+	require.NoError(t, err)
+	proxy := faultproxy.New(target, nil)
+	reads := atomic.Int32{}
+	reloaded, err := faultproxy.MarshalRoutes([]params.Route{
+		{Name: "slow", Latency: params.Latency{Distribution: params.DistributionNormal, Mean: time.Hour}},
+	})
+	require.NoError(t, err)
+
+	// test target
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		faultproxy.Watch(ctx, proxy, func() ([]byte, error) {
+			// the routes are changed after the first read
+			if reads.Add(1) == 1 {
+				return []byte("[]\n"), nil
+			}
+			return []byte(reloaded), nil
+		}, 10*time.Millisecond)
+	}()
+
+	// verify
+	// the request is delayed for an hour once the routes are reloaded, so it waits for the request context instead
+	assert.Eventually(t, func() bool {
+		reqCtx, reqCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer reqCancel()
+		r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(reqCtx)
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, r)
+		return reqCtx.Err() != nil
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+}
@@ -0,0 +1,25 @@
+package app
+
+import (
+	"context"
+	"log"
+
+	"github.com/gold-kou/prism-in-k8s/app/gc"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func collectGarbage(ctx context.Context) error {
+	options := gc.Options{
+		KubeClient:    k8sClientSet,
+		IstioClient:   istioClientSet,
+		DynamicClient: dynamicClient,
+		DryRun:        isDryRun,
+	}
+	if isTest {
+		log.Println("[WARN] The ECR repositories are not deleted in test mode")
+	} else {
+		options.ECRClient = ecrClient
+	}
+	_, err := gc.CollectGarbage(ctx, options, metav1.Now().Time)
+	return err //nolint:wrapcheck // already wrapped
+}
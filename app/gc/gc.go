@@ -0,0 +1,90 @@
+// Package gc deletes the mocks whose ttl is expired.
+package gc
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/istio"
+	"github.com/gold-kou/prism-in-k8s/app/k8s"
+	"github.com/gold-kou/prism-in-k8s/app/registry"
+	"golang.org/x/xerrors"
+	"istio.io/client-go/pkg/clientset/versioned"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Options are the dependencies of CollectGarbage.
+type Options struct {
+	KubeClient  kubernetes.Interface
+	IstioClient versioned.Interface
+	// DynamicClient is optional. If nil, the waypoints of the expired mocks in ambient are kept.
+	DynamicClient dynamic.Interface
+	// ECRClient is optional. If nil, the repositories of the expired mocks are kept.
+	ECRClient registry.ECRAPI
+	// DryRun only logs the expired mocks without deleting anything
+	DryRun bool
+}
+
+// CollectGarbage deletes the mocks created by this tool which are expired at now, and returns them.
+// Mocks without an expiry, including the legacy mocks without the ownership labels, are never deleted.
+func CollectGarbage(ctx context.Context, options Options, now time.Time) ([]k8s.Mock, error) {
+	// legacy mocks have no expiry, so the namespace suffix is not needed
+	mocks, err := k8s.ListMocks(ctx, options.KubeClient, "")
+	if err != nil {
+		return nil, xerrors.Errorf("failed to list mocks: %w", err)
+	}
+
+	expired := []k8s.Mock{}
+	for _, mock := range mocks {
+		if !mock.Expired(now) {
+			continue
+		}
+		expired = append(expired, mock)
+
+		if options.DryRun {
+			log.Printf("[INFO] (dry-run) %s/%s expired at %s and would be deleted", mock.Namespace, mock.Name, mock.ExpiresAt)
+			continue
+		}
+		log.Printf("[INFO] %s/%s expired at %s, deleting", mock.Namespace, mock.Name, mock.ExpiresAt)
+		if err := deleteMock(ctx, options, mock); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("[INFO] %d of %d mocks are expired", len(expired), len(mocks))
+	return expired, nil
+}
+
+func deleteMock(ctx context.Context, options Options, mock k8s.Mock) error {
+	// the VirtualService is deleted regardless of istioMode because the mock may have been created with another config
+	err := istio.DeleteIstioResources(ctx, options.IstioClient, mock.Namespace, mock.Name)
+	if err != nil {
+		return xerrors.Errorf("failed to delete Istio resources of %s/%s: %w", mock.Namespace, mock.Name, err)
+	}
+
+	if options.DynamicClient == nil {
+		log.Printf("[WARN] Skip deleting the waypoint of %s/%s without the dynamic client", mock.Namespace, mock.Name)
+	} else if err := istio.DeleteWaypoint(ctx, options.DynamicClient, mock.Namespace); err != nil {
+		return xerrors.Errorf("failed to delete waypoint of %s/%s: %w", mock.Namespace, mock.Name, err)
+	}
+
+	// only the labeled mocks expire, so the namespace must have the labels too
+	err = k8s.DeleteK8sResources(ctx, options.KubeClient, mock.Namespace, mock.Name, "")
+	if err != nil {
+		return xerrors.Errorf("failed to delete k8s resources of %s/%s: %w", mock.Namespace, mock.Name, err)
+	}
+
+	if mock.Repository == "" {
+		return nil
+	}
+	if options.ECRClient == nil {
+		log.Printf("[WARN] Skip deleting ECR %s without the ECR client", mock.Repository)
+		return nil
+	}
+	err = registry.DeleteECR(ctx, options.ECRClient, mock.Repository)
+	if err != nil {
+		return xerrors.Errorf("failed to delete ECR of %s/%s: %w", mock.Namespace, mock.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package gc_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/gc"
+	"github.com/gold-kou/prism-in-k8s/app/istio"
+	"github.com/gold-kou/prism-in-k8s/app/k8s"
+	"github.com/gold-kou/prism-in-k8s/app/ownership"
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/gold-kou/prism-in-k8s/app/registry"
+	registryfake "github.com/gold-kou/prism-in-k8s/app/registry/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	istiofake "istio.io/client-go/pkg/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var now = time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+// testMock is a mock created by this tool in the namespace <name>-prism-mock, with the repository of the same name.
+type testMock struct {
+	name string
+	// zero if the mock never expires
+	expiresAt time.Time
+}
+
+func (m testMock) config() *params.Config {
+	config := &params.Config{
+		MicroserviceName:      m.name,
+		MicroserviceNamespace: m.name,
+		PrismMockSuffix:       "-prism-mock",
+		IstioMode:             true,
+	}
+	config.SetDefaults()
+	return config
+}
+
+func (m testMock) objects() ([]runtime.Object, []runtime.Object) {
+	config := m.config()
+	namespaceName, resourceName := config.NamespaceName(), config.ResourceName()
+	k8sObjects := []runtime.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespaceName, Labels: ownership.Labels(m.name)}},
+		k8s.NewDeployment(config, namespaceName, resourceName, k8s.DeploymentOptions{
+			Image: "test-image",
+			Owner: ownership.Owner{Repository: resourceName, ExpiresAt: m.expiresAt},
+		}),
+		k8s.NewService(config, namespaceName, resourceName),
+	}
+	istioObjects := []runtime.Object{istio.NewVirtualService(config, namespaceName, resourceName)}
+	return k8sObjects, istioObjects
+}
+
+func TestCollectGarbage(t *testing.T) {
+	// in the name order
+	mocks := []testMock{
+		{name: "alive", expiresAt: now.Add(time.Minute)},
+		{name: "expired", expiresAt: now.Add(-time.Minute)},
+		{name: "expiring", expiresAt: now},
+		{name: "forever"},
+	}
+	tests := []struct {
+		name   string
+		dryRun bool
+		// the names of the mocks left
+		wantLeft []string
+	}{
+		{
+			name:     "delete expired",
+			wantLeft: []string{"alive", "forever"},
+		},
+		{
+			name:     "dry-run",
+			dryRun:   true,
+			wantLeft: []string{"alive", "expired", "expiring", "forever"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			k8sObjects := []runtime.Object{
+				// a legacy mock without the ownership labels is never deleted
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "legacy-prism-mock"}},
+			}
+			istioObjects := []runtime.Object{}
+			ecrClient := registryfake.NewECR("123456789012", "ap-northeast-1")
+			for _, mock := range mocks {
+				k8sMock, istioMock := mock.objects()
+				k8sObjects = append(k8sObjects, k8sMock...)
+				istioObjects = append(istioObjects, istioMock...)
+				require.NoError(t, registry.CreateECR(ctx, ecrClient, &params.Config{}, mock.config().ResourceName()))
+			}
+			k8sClientSet := fake.NewSimpleClientset(k8sObjects...)
+			istioClientSet := istiofake.NewSimpleClientset(istioObjects...)
+			dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+			for _, mock := range mocks {
+				// created through the client, which knows the plural of Gateway unlike the fake tracker
+				namespaceName := mock.config().NamespaceName()
+				_, err := dynamicClient.Resource(istio.GatewayResource).Namespace(namespaceName).Create(ctx, istio.NewWaypoint(mock.config(), namespaceName), metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+
+			// test target
+			expired, err := gc.CollectGarbage(ctx, gc.Options{
+				KubeClient:    k8sClientSet,
+				IstioClient:   istioClientSet,
+				DynamicClient: dynamicClient,
+				ECRClient:     ecrClient,
+				DryRun:        tt.dryRun,
+			}, now)
+			require.NoError(t, err)
+
+			// verify
+			expiredNames := []string{}
+			for _, mock := range expired {
+				expiredNames = append(expiredNames, mock.MicroserviceName)
+			}
+			assert.Equal(t, []string{"expired", "expiring"}, expiredNames)
+
+			wantRepositories := []string{}
+			for _, mock := range mocks {
+				config := mock.config()
+				namespaceName, resourceName := config.NamespaceName(), config.ResourceName()
+				_, deploymentErr := k8sClientSet.AppsV1().Deployments(namespaceName).Get(ctx, resourceName, metav1.GetOptions{})
+				_, namespaceErr := k8sClientSet.CoreV1().Namespaces().Get(ctx, namespaceName, metav1.GetOptions{})
+				_, virtualServiceErr := istioClientSet.NetworkingV1alpha3().VirtualServices(namespaceName).Get(ctx, resourceName, metav1.GetOptions{})
+				_, waypointErr := dynamicClient.Resource(istio.GatewayResource).Namespace(namespaceName).Get(ctx, config.WaypointName(), metav1.GetOptions{})
+				if !slices.Contains(tt.wantLeft, mock.name) {
+					assert.True(t, apierrors.IsNotFound(deploymentErr), mock.name)
+					assert.True(t, apierrors.IsNotFound(namespaceErr), mock.name)
+					assert.True(t, apierrors.IsNotFound(virtualServiceErr), mock.name)
+					assert.True(t, apierrors.IsNotFound(waypointErr), mock.name)
+					continue
+				}
+				require.NoError(t, deploymentErr, mock.name)
+				require.NoError(t, namespaceErr, mock.name)
+				require.NoError(t, virtualServiceErr, mock.name)
+				require.NoError(t, waypointErr, mock.name)
+				wantRepositories = append(wantRepositories, resourceName)
+			}
+			assert.Equal(t, wantRepositories, ecrClient.RepositoryNames())
+			_, err = k8sClientSet.CoreV1().Namespaces().Get(ctx, "legacy-prism-mock", metav1.GetOptions{})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestCollectGarbageWithoutECR(t *testing.T) {
+	ctx := context.TODO()
+	mock := testMock{name: "expired", expiresAt: now.Add(-time.Minute)}
+	k8sObjects, istioObjects := mock.objects()
+	k8sClientSet := fake.NewSimpleClientset(k8sObjects...)
+
+	// test target
+	expired, err := gc.CollectGarbage(ctx, gc.Options{
+		KubeClient:  k8sClientSet,
+		IstioClient: istiofake.NewSimpleClientset(istioObjects...),
+	}, now)
+
+	// verify
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	// the repository is kept but the resources are deleted
+	assert.Equal(t, mock.config().ResourceName(), expired[0].Repository)
+	_, err = k8sClientSet.CoreV1().Namespaces().Get(ctx, mock.config().NamespaceName(), metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
@@ -0,0 +1,115 @@
+package istio
+
+import (
+	"context"
+	"log"
+
+	"github.com/gold-kou/prism-in-k8s/app/ownership"
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/pingcap/errors"
+	"golang.org/x/xerrors"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	networkingv1alpha3 "istio.io/api/networking/v1alpha3"
+	"istio.io/client-go/pkg/apis/networking/v1alpha3"
+	"istio.io/client-go/pkg/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+var (
+	errFailedToApplyDestinationRule  = errors.New("failed to apply DestinationRule")
+	errFailedToDeleteDestinationRule = errors.New("failed to delete DestinationRule")
+)
+
+// NewDestinationRule builds the DestinationRule of the mock Service with the connection pool and the outlier detection of destinationRule.
+func NewDestinationRule(config *params.Config, namespaceName, resourceName string) *v1alpha3.DestinationRule {
+	trafficPolicy := &networkingv1alpha3.TrafficPolicy{}
+	connectionPool := config.DestinationRule.ConnectionPool
+	if connectionPool != (params.ConnectionPool{}) {
+		trafficPolicy.ConnectionPool = &networkingv1alpha3.ConnectionPoolSettings{
+			Tcp: &networkingv1alpha3.ConnectionPoolSettings_TCPSettings{
+				MaxConnections: int32(connectionPool.MaxConnections),
+			},
+			Http: &networkingv1alpha3.ConnectionPoolSettings_HTTPSettings{
+				Http1MaxPendingRequests:  int32(connectionPool.HTTP1MaxPendingRequests),
+				Http2MaxRequests:         int32(connectionPool.HTTP2MaxRequests),
+				MaxRequestsPerConnection: int32(connectionPool.MaxRequestsPerConnection),
+			},
+		}
+	}
+	outlierDetection := config.DestinationRule.OutlierDetection
+	if outlierDetection != (params.OutlierDetection{}) {
+		trafficPolicy.OutlierDetection = &networkingv1alpha3.OutlierDetection{
+			MaxEjectionPercent: int32(outlierDetection.MaxEjectionPercent),
+		}
+		if outlierDetection.Consecutive5xxErrors != 0 {
+			trafficPolicy.OutlierDetection.Consecutive_5XxErrors = wrapperspb.UInt32(uint32(outlierDetection.Consecutive5xxErrors))
+		}
+		if outlierDetection.Interval != 0 {
+			trafficPolicy.OutlierDetection.Interval = durationpb.New(outlierDetection.Interval)
+		}
+		if outlierDetection.BaseEjectionTime != 0 {
+			trafficPolicy.OutlierDetection.BaseEjectionTime = durationpb.New(outlierDetection.BaseEjectionTime)
+		}
+	}
+
+	return &v1alpha3.DestinationRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      resourceName,
+			Namespace: namespaceName,
+			Labels:    ownership.Labels(config.MicroserviceName),
+		},
+		Spec: networkingv1alpha3.DestinationRule{
+			Host:          resourceName + "." + namespaceName + ".svc.cluster.local",
+			TrafficPolicy: trafficPolicy,
+		},
+	}
+}
+
+// applyDestinationRule creates the DestinationRule or updates it to the current parameters, and deletes it if destinationRule is empty.
+func applyDestinationRule(ctx context.Context, istioClientSet versioned.Interface, config *params.Config, namespaceName, resourceName string) error {
+	if !config.DestinationRule.Enabled() {
+		return deleteDestinationRule(ctx, istioClientSet, namespaceName, resourceName)
+	}
+
+	desired := NewDestinationRule(config, namespaceName, resourceName)
+	destinationRules := istioClientSet.NetworkingV1alpha3().DestinationRules(namespaceName)
+	_, err := destinationRules.Create(ctx, desired, metav1.CreateOptions{})
+	if err == nil {
+		log.Println("[INFO] DestinationRule is created successfully")
+		return nil
+	}
+	if !errors.IsAlreadyExists(err) {
+		return xerrors.Errorf("%w: %w", errFailedToApplyDestinationRule, err)
+	}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := destinationRules.Get(ctx, desired.Name, metav1.GetOptions{})
+		if err != nil {
+			return err //nolint:wrapcheck // wrapped below
+		}
+		current.Labels = desired.Labels
+		desired.Spec.DeepCopyInto(&current.Spec)
+		_, err = destinationRules.Update(ctx, current, metav1.UpdateOptions{})
+		return err //nolint:wrapcheck // wrapped below
+	})
+	if err != nil {
+		return xerrors.Errorf("%w: %w", errFailedToApplyDestinationRule, err)
+	}
+	log.Println("[INFO] DestinationRule is updated successfully")
+	return nil
+}
+
+// deleteDestinationRule deletes the DestinationRule. It is ignored if it does not exist.
+func deleteDestinationRule(ctx context.Context, istioClientSet versioned.Interface, namespaceName, resourceName string) error {
+	err := istioClientSet.NetworkingV1alpha3().DestinationRules(namespaceName).Delete(ctx, resourceName, metav1.DeleteOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return xerrors.Errorf("%w: %w", errFailedToDeleteDestinationRule, err)
+		}
+		return nil
+	}
+	log.Println("[INFO] DestinationRule is deleted successfully")
+	return nil
+}
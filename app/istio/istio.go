@@ -5,13 +5,14 @@ import (
 	"log"
 
 	"github.com/golang/protobuf/ptypes/duration"
+	"github.com/gold-kou/prism-in-k8s/app/ownership"
+	"github.com/gold-kou/prism-in-k8s/app/params"
 	"github.com/pingcap/errors"
 	"golang.org/x/xerrors"
 	networkingv1alpha3 "istio.io/api/networking/v1alpha3"
 	"istio.io/client-go/pkg/apis/networking/v1alpha3"
 	"istio.io/client-go/pkg/clientset/versioned"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	restclient "k8s.io/client-go/rest"
 )
 
 const (
@@ -20,22 +21,38 @@ const (
 )
 
 var (
-	errFailedToCreateIstioClient    = errors.New("failed to create Istio client")
 	errFailedToCreateVirtualService = errors.New("failed to create VirtualService")
 	errFailedToDeleteVirtualService = errors.New("failed to delete VirtualService")
 )
 
-func CreateIstioResources(ctx context.Context, kubeconfig *restclient.Config, namespaceName, resourceName string) error {
-	// Istio clientset
-	istioClientSet, err := versioned.NewForConfig(kubeconfig)
+func CreateIstioResources(ctx context.Context, istioClientSet versioned.Interface, config *params.Config, namespaceName, resourceName string) error {
+	// VirtualService
+	virtualService := NewVirtualService(config, namespaceName, resourceName)
+	_, err := istioClientSet.NetworkingV1alpha3().VirtualServices(namespaceName).Create(ctx, virtualService, metav1.CreateOptions{})
 	if err != nil {
-		return xerrors.Errorf("%w: %w", errFailedToCreateIstioClient, err)
+		if !errors.IsAlreadyExists(err) {
+			return xerrors.Errorf("%w: %w", errFailedToCreateVirtualService, err)
+		}
+		log.Println("[WARN] The VirtualService already exists")
+	} else {
+		log.Println("[INFO] VirtualService is created successfully")
 	}
 
-	// VirtualService
+	// DestinationRule
+	if err := applyDestinationRule(ctx, istioClientSet, config, namespaceName, resourceName); err != nil {
+		return err
+	}
+	// routes of the real microservice
+	return routeToMock(ctx, istioClientSet, config, namespaceName, resourceName)
+}
+
+// NewVirtualService builds the VirtualService of the mock Service with the routes, or the sample fault injection if there are none.
+func NewVirtualService(config *params.Config, namespaceName, resourceName string) *v1alpha3.VirtualService {
 	virtualService := &v1alpha3.VirtualService{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: resourceName,
+			Name:      resourceName,
+			Namespace: namespaceName,
+			Labels:    ownership.Labels(config.MicroserviceName),
 		},
 		Spec: networkingv1alpha3.VirtualService{
 			Hosts: []string{
@@ -89,27 +106,31 @@ func CreateIstioResources(ctx context.Context, kubeconfig *restclient.Config, na
 			},
 		},
 	}
-	_, err = istioClientSet.NetworkingV1alpha3().VirtualServices(namespaceName).Create(ctx, virtualService, metav1.CreateOptions{})
-	if err != nil {
-		if !errors.IsAlreadyExists(err) {
-			return xerrors.Errorf("%w: %w", errFailedToCreateVirtualService, err)
-		}
-		log.Println("[WARN] The VirtualService already exists")
-	} else {
-		log.Println("[INFO] VirtualService is created successfully")
+	if len(config.Routes) > 0 {
+		host := resourceName + "." + namespaceName + ".svc.cluster.local"
+		// the last route is the default one
+		defaultRoute := virtualService.Spec.Http[len(virtualService.Spec.Http)-1]
+		virtualService.Spec.Http = append(newRoutes(config, host), defaultRoute)
 	}
-	return nil
+	return virtualService
 }
 
-func DeleteIstioResources(ctx context.Context, kubeconfig *restclient.Config, namespaceName, resourceName string) error {
-	// Istio clientset
-	istioClientSet, err := versioned.NewForConfig(kubeconfig)
-	if err != nil {
-		return xerrors.Errorf("%w: %w", errFailedToCreateIstioClient, err)
+func DeleteIstioResources(ctx context.Context, istioClientSet versioned.Interface, namespaceName, resourceName string) error {
+	// first, so that the traffic is restored before the mock is gone
+	if err := removeHeaderRoute(ctx, istioClientSet, namespaceName, resourceName); err != nil {
+		return err
+	}
+	if err := removeMirror(ctx, istioClientSet, namespaceName, resourceName); err != nil {
+		return err
+	}
+	if err := deleteTrafficSplit(ctx, istioClientSet, namespaceName, resourceName); err != nil {
+		return err
+	}
+	if err := deleteDestinationRule(ctx, istioClientSet, namespaceName, resourceName); err != nil {
+		return err
 	}
-	log.Println("[INFO] Clientset of istio set up successfully")
 
-	err = istioClientSet.NetworkingV1alpha3().VirtualServices(namespaceName).Delete(ctx, resourceName, metav1.DeleteOptions{})
+	err := istioClientSet.NetworkingV1alpha3().VirtualServices(namespaceName).Delete(ctx, resourceName, metav1.DeleteOptions{})
 	if err != nil {
 		if !errors.IsNotFound(err) {
 			return xerrors.Errorf("%w: %w", errFailedToDeleteVirtualService, err)
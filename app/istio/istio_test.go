@@ -3,74 +3,484 @@ package istio_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/gold-kou/prism-in-k8s/app/istio"
+	"github.com/gold-kou/prism-in-k8s/app/params"
 	"github.com/gold-kou/prism-in-k8s/app/testutil"
-	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"istio.io/client-go/pkg/clientset/versioned"
+	networkingv1alpha3 "istio.io/api/networking/v1alpha3"
+	"istio.io/client-go/pkg/apis/networking/v1alpha3"
+	"istio.io/client-go/pkg/clientset/versioned/fake"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 )
 
+const (
+	testNamespaceName = "test-namespace"
+	testResourceName  = "test-resource"
+)
+
+func newConfig() *params.Config {
+	config := &params.Config{
+		MicroserviceName:      "test",
+		MicroserviceNamespace: "test",
+		IstioMode:             true,
+	}
+	config.SetDefaults()
+	return config
+}
+
 func TestCreateIstioResources(t *testing.T) {
-	testNamespaceName := "test-namespace" + uuid.NewString()
-	testResourceName := "test-resource" + uuid.NewString()
+	tests := []struct {
+		name     string
+		existing []runtime.Object
+		// the hosts are empty if the existing VirtualService is kept
+		wantHosts []string
+	}{
+		{
+			name:      "create",
+			wantHosts: []string{testResourceName + "." + testNamespaceName + ".svc.cluster.local"},
+		},
+		{
+			name: "already exists",
+			existing: []runtime.Object{
+				&v1alpha3.VirtualService{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespaceName, Name: testResourceName}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			istioClientSet := fake.NewSimpleClientset(tt.existing...)
+
+			// test target
+			err := istio.CreateIstioResources(ctx, istioClientSet, newConfig(), testNamespaceName, testResourceName)
+			require.NoError(t, err)
+
+			// verify
+			virtualService, err := istioClientSet.NetworkingV1alpha3().VirtualServices(testNamespaceName).Get(ctx, testResourceName, metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantHosts, virtualService.Spec.Hosts)
+		})
+	}
+}
+
+func TestDeleteIstioResources(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []runtime.Object
+	}{
+		{
+			name: "delete",
+			existing: []runtime.Object{
+				&v1alpha3.VirtualService{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespaceName, Name: testResourceName}},
+			},
+		},
+		{
+			name: "not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			istioClientSet := fake.NewSimpleClientset(tt.existing...)
+
+			// test target
+			err := istio.DeleteIstioResources(ctx, istioClientSet, testNamespaceName, testResourceName)
+			require.NoError(t, err)
+
+			// verify
+			_, err = istioClientSet.NetworkingV1alpha3().VirtualServices(testNamespaceName).Get(ctx, testResourceName, metav1.GetOptions{})
+			assert.True(t, apierrors.IsNotFound(err))
+		})
+	}
+}
+
+func TestNewVirtualServiceGolden(t *testing.T) {
+	config := &params.Config{
+		MicroserviceName:      "sample",
+		MicroserviceNamespace: "sample",
+		PrismMockSuffix:       "-prism-mock",
+		IstioMode:             true,
+	}
+	config.SetDefaults()
+
+	virtualService := istio.NewVirtualService(config, config.NamespaceName(), config.ResourceName())
+	testutil.AssertGolden(t, "virtualservice", virtualService)
+}
+
+func TestNewVirtualServiceRoutesGolden(t *testing.T) {
+	config := &params.Config{
+		MicroserviceName:      "sample",
+		MicroserviceNamespace: "sample",
+		PrismMockSuffix:       "-prism-mock",
+		IstioMode:             true,
+		Routes: []params.Route{
+			{
+				Name:    "get-users",
+				Match:   params.RouteMatch{PathPrefix: "/users", Method: "get", Headers: map[string]string{"X-Tenant": "large"}},
+				Timeout: 2 * time.Second,
+				Retries: params.Retries{Attempts: 3, PerTryTimeout: 500 * time.Millisecond, RetryOn: "5xx,reset,connect-failure"},
+			},
+			{
+				Name:  "unavailable-orders",
+				Match: params.RouteMatch{PathPrefix: "/orders"},
+				Fault: params.Fault{
+					Delay: params.FaultDelay{FixedDelay: 300 * time.Millisecond},
+					Abort: params.FaultAbort{HTTPStatus: 503, Percentage: 10},
+				},
+			},
+			{
+				Name:    "all",
+				Timeout: 5 * time.Second,
+				Retries: params.Retries{Attempts: 2},
+			},
+		},
+	}
+	config.SetDefaults()
+
+	virtualService := istio.NewVirtualService(config, config.NamespaceName(), config.ResourceName())
+	testutil.AssertGolden(t, "virtualservice-routes", virtualService)
+}
 
+func TestCreateIstioResourcesTrafficSplit(t *testing.T) {
 	ctx := context.TODO()
-	kubeconfigPath := clientcmd.NewDefaultPathOptions().GetDefaultFilename()
-	kubeconfig, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
-	require.NoError(t, err)
+	istioClientSet := fake.NewSimpleClientset()
+	splitName := testResourceName + "-split"
 
-	// create namespace to create a virtualservice
-	k8sClientSet, err := kubernetes.NewForConfig(kubeconfig)
-	require.NoError(t, err)
-	err = testutil.CreateNamespace(ctx, k8sClientSet, testNamespaceName)
-	require.NoError(t, err)
+	for _, weight := range []int{20, 50} {
+		config := newConfig()
+		config.TrafficSplit.Weight = weight
+
+		// test target
+		err := istio.CreateIstioResources(ctx, istioClientSet, config, testNamespaceName, testResourceName)
+		require.NoError(t, err)
+
+		// verify
+		virtualService, err := istioClientSet.NetworkingV1alpha3().VirtualServices(testNamespaceName).Get(ctx, splitName, metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"test.test.svc.cluster.local"}, virtualService.Spec.Hosts)
+		routes := virtualService.Spec.Http[0].Route
+		require.Len(t, routes, 2)
+		assert.Equal(t, int32(100-weight), routes[0].Weight)
+		assert.Equal(t, int32(weight), routes[1].Weight)
+	}
 
 	// test target
-	err = istio.CreateIstioResources(ctx, kubeconfig, testNamespaceName, testResourceName)
-	assert.NoError(t, err)
+	err := istio.CreateIstioResources(ctx, istioClientSet, newConfig(), testNamespaceName, testResourceName)
+	require.NoError(t, err)
 
 	// verify
-	istioClient, err := versioned.NewForConfig(kubeconfig)
-	assert.NoError(t, err)
-	_, err = istioClient.NetworkingV1alpha3().VirtualServices(testNamespaceName).Get(ctx, testResourceName, metav1.GetOptions{})
-	assert.NoError(t, err)
+	_, err = istioClientSet.NetworkingV1alpha3().VirtualServices(testNamespaceName).Get(ctx, splitName, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
 
-	// clean up
-	err = testutil.DeleteNamespace(ctx, k8sClientSet, testNamespaceName)
+func TestDeleteIstioResourcesTrafficSplit(t *testing.T) {
+	ctx := context.TODO()
+	istioClientSet := fake.NewSimpleClientset(
+		&v1alpha3.VirtualService{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespaceName, Name: testResourceName}},
+		&v1alpha3.VirtualService{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespaceName, Name: testResourceName + "-split"}},
+	)
+
+	// test target
+	err := istio.DeleteIstioResources(ctx, istioClientSet, testNamespaceName, testResourceName)
 	require.NoError(t, err)
+
+	// verify
+	list, err := istioClientSet.NetworkingV1alpha3().VirtualServices(testNamespaceName).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, list.Items)
 }
 
-func TestDeleteIstioResources(t *testing.T) {
-	testNamespaceName := "test-namespace" + uuid.NewString()
-	testResourceName := "test-resource" + uuid.NewString()
+func TestNewSplitVirtualServiceGolden(t *testing.T) {
+	config := &params.Config{
+		MicroserviceName:      "sample",
+		MicroserviceNamespace: "sample",
+		PrismMockSuffix:       "-prism-mock",
+		IstioMode:             true,
+		TrafficSplit: params.TrafficSplit{
+			Weight:  10,
+			Headers: []params.HeaderMatch{{Name: "x-use-mock", Exact: "true"}},
+		},
+		TrafficMirror: params.TrafficMirror{Percentage: 5},
+	}
+	config.SetDefaults()
+
+	virtualService := istio.NewSplitVirtualService(config, config.NamespaceName(), config.ResourceName())
+	testutil.AssertGolden(t, "virtualservice-split", virtualService)
+}
+
+func TestCreateIstioResourcesHeaderRoute(t *testing.T) {
+	realVirtualService := &v1alpha3.VirtualService{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "test"},
+		Spec: networkingv1alpha3.VirtualService{
+			Hosts: []string{"test"},
+			Http: []*networkingv1alpha3.HTTPRoute{
+				{Name: "original", Route: []*networkingv1alpha3.HTTPRouteDestination{{Destination: &networkingv1alpha3.Destination{Host: "test"}}}},
+			},
+		},
+	}
+	headers := []params.HeaderMatch{
+		{Name: "X-Use-Mock", Exact: "true"},
+		{Name: "baggage", Regex: ".*mock=true.*"},
+	}
+
+	tests := []struct {
+		name     string
+		existing []runtime.Object
+		// wantRoutes are the names of the routes of the VirtualService wantNamespace/wantName
+		wantNamespace string
+		wantName      string
+		wantRoutes    []string
+	}{
+		{
+			name:          "inserted into the VirtualService of the microservice",
+			existing:      []runtime.Object{realVirtualService},
+			wantNamespace: "test",
+			wantName:      "test",
+			wantRoutes:    []string{testResourceName + "-headers", "original"},
+		},
+		{
+			name:          "split VirtualService without the VirtualService of the microservice",
+			wantNamespace: testNamespaceName,
+			wantName:      testResourceName + "-split",
+			wantRoutes:    []string{testResourceName + "-headers", "split"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			istioClientSet := fake.NewSimpleClientset(tt.existing...)
+			config := newConfig()
+			config.TrafficSplit.Headers = headers
 
+			// test target, twice to check that the route is not duplicated
+			for range 2 {
+				err := istio.CreateIstioResources(ctx, istioClientSet, config, testNamespaceName, testResourceName)
+				require.NoError(t, err)
+			}
+
+			// verify
+			virtualService, err := istioClientSet.NetworkingV1alpha3().VirtualServices(tt.wantNamespace).Get(ctx, tt.wantName, metav1.GetOptions{})
+			require.NoError(t, err)
+			routeNames := []string{}
+			for _, route := range virtualService.Spec.Http {
+				routeNames = append(routeNames, route.Name)
+			}
+			assert.Equal(t, tt.wantRoutes, routeNames)
+			headerRoute := virtualService.Spec.Http[0]
+			require.Len(t, headerRoute.Match, 2)
+			assert.Equal(t, "true", headerRoute.Match[0].Headers["x-use-mock"].GetExact())
+			assert.Equal(t, ".*mock=true.*", headerRoute.Match[1].Headers["baggage"].GetRegex())
+
+			// test target
+			err = istio.DeleteIstioResources(ctx, istioClientSet, testNamespaceName, testResourceName)
+			require.NoError(t, err)
+
+			// verify only the VirtualService of the microservice is left as it was
+			list, err := istioClientSet.NetworkingV1alpha3().VirtualServices(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+			require.NoError(t, err)
+			require.Len(t, list.Items, len(tt.existing))
+			if len(tt.existing) > 0 {
+				require.Len(t, list.Items[0].Spec.Http, 1)
+				assert.Equal(t, "original", list.Items[0].Spec.Http[0].Name)
+			}
+		})
+	}
+}
+
+func TestCreateIstioResourcesMirror(t *testing.T) {
 	ctx := context.TODO()
-	kubeconfigPath := clientcmd.NewDefaultPathOptions().GetDefaultFilename()
-	kubeconfig, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	mockHost := testResourceName + "." + testNamespaceName + ".svc.cluster.local"
+	istioClientSet := fake.NewSimpleClientset(&v1alpha3.VirtualService{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "test"},
+		Spec: networkingv1alpha3.VirtualService{
+			Hosts: []string{"test.test.svc.cluster.local"},
+			Http: []*networkingv1alpha3.HTTPRoute{
+				{Name: "real", Route: []*networkingv1alpha3.HTTPRouteDestination{{Destination: &networkingv1alpha3.Destination{Host: "test"}}}},
+				{
+					Name:   "mirrored",
+					Route:  []*networkingv1alpha3.HTTPRouteDestination{{Destination: &networkingv1alpha3.Destination{Host: "test"}}},
+					Mirror: &networkingv1alpha3.Destination{Host: "other"},
+				},
+				{Name: "other", Route: []*networkingv1alpha3.HTTPRouteDestination{{Destination: &networkingv1alpha3.Destination{Host: "other"}}}},
+			},
+		},
+	})
+	config := newConfig()
+	config.TrafficMirror.Percentage = 50
+
+	// test target
+	err := istio.CreateIstioResources(ctx, istioClientSet, config, testNamespaceName, testResourceName)
 	require.NoError(t, err)
-	k8sClientSet, err := kubernetes.NewForConfig(kubeconfig)
+
+	// verify
+	virtualService, err := istioClientSet.NetworkingV1alpha3().VirtualServices("test").Get(ctx, "test", metav1.GetOptions{})
 	require.NoError(t, err)
-	istioClientSet, err := versioned.NewForConfig(kubeconfig)
+	assert.Equal(t, mockHost, virtualService.Spec.Http[0].Mirror.GetHost())
+	assert.InDelta(t, 50.0, virtualService.Spec.Http[0].MirrorPercentage.GetValue(), 0)
+	assert.Equal(t, "other", virtualService.Spec.Http[1].Mirror.GetHost())
+	assert.Nil(t, virtualService.Spec.Http[2].Mirror)
+
+	// edited by another team after the mirror is added
+	virtualService.Spec.Http[0].Name = "edited"
+	virtualService.Spec.Http = append(virtualService.Spec.Http, &networkingv1alpha3.HTTPRoute{Name: "added"})
+	_, err = istioClientSet.NetworkingV1alpha3().VirtualServices("test").Update(ctx, virtualService, metav1.UpdateOptions{})
 	require.NoError(t, err)
 
-	// dummy resources
-	err = testutil.CreateNamespace(ctx, k8sClientSet, testNamespaceName)
+	// test target
+	err = istio.DeleteIstioResources(ctx, istioClientSet, testNamespaceName, testResourceName)
 	require.NoError(t, err)
-	err = testutil.CreateVirtualService(ctx, istioClientSet, testNamespaceName, testResourceName)
+
+	// verify only the mirror to the mock is removed
+	virtualService, err = istioClientSet.NetworkingV1alpha3().VirtualServices("test").Get(ctx, "test", metav1.GetOptions{})
 	require.NoError(t, err)
+	require.Len(t, virtualService.Spec.Http, 4)
+	assert.Equal(t, "edited", virtualService.Spec.Http[0].Name)
+	assert.Nil(t, virtualService.Spec.Http[0].Mirror)
+	assert.Nil(t, virtualService.Spec.Http[0].MirrorPercentage)
+	assert.Equal(t, "other", virtualService.Spec.Http[1].Mirror.GetHost())
+	assert.Equal(t, "added", virtualService.Spec.Http[3].Name)
+}
+
+func TestCreateIstioResourcesDestinationRule(t *testing.T) {
+	ctx := context.TODO()
+	istioClientSet := fake.NewSimpleClientset()
+
+	for _, maxConnections := range []int{10, 20} {
+		config := newConfig()
+		config.DestinationRule.ConnectionPool.MaxConnections = maxConnections
+
+		// test target
+		err := istio.CreateIstioResources(ctx, istioClientSet, config, testNamespaceName, testResourceName)
+		require.NoError(t, err)
+
+		// verify
+		destinationRule, err := istioClientSet.NetworkingV1alpha3().DestinationRules(testNamespaceName).Get(ctx, testResourceName, metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, testResourceName+"."+testNamespaceName+".svc.cluster.local", destinationRule.Spec.Host)
+		assert.Equal(t, int32(maxConnections), destinationRule.Spec.TrafficPolicy.ConnectionPool.Tcp.MaxConnections)
+		assert.Nil(t, destinationRule.Spec.TrafficPolicy.OutlierDetection)
+	}
 
 	// test target
-	err = istio.CreateIstioResources(ctx, kubeconfig, testNamespaceName, testResourceName)
-	assert.NoError(t, err)
+	err := istio.CreateIstioResources(ctx, istioClientSet, newConfig(), testNamespaceName, testResourceName)
+	require.NoError(t, err)
 
-	// skip verify to reduce test time
+	// verify
+	_, err = istioClientSet.NetworkingV1alpha3().DestinationRules(testNamespaceName).Get(ctx, testResourceName, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
 
-	// clean up
-	err = testutil.DeleteNamespace(ctx, k8sClientSet, testNamespaceName)
+func TestDeleteIstioResourcesDestinationRule(t *testing.T) {
+	ctx := context.TODO()
+	istioClientSet := fake.NewSimpleClientset(
+		&v1alpha3.DestinationRule{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespaceName, Name: testResourceName}},
+	)
+
+	// test target
+	err := istio.DeleteIstioResources(ctx, istioClientSet, testNamespaceName, testResourceName)
 	require.NoError(t, err)
+
+	// verify
+	_, err = istioClientSet.NetworkingV1alpha3().DestinationRules(testNamespaceName).Get(ctx, testResourceName, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func TestNewDestinationRuleGolden(t *testing.T) {
+	config := &params.Config{
+		MicroserviceName:      "sample",
+		MicroserviceNamespace: "sample",
+		PrismMockSuffix:       "-prism-mock",
+		IstioMode:             true,
+		DestinationRule: params.DestinationRule{
+			ConnectionPool: params.ConnectionPool{
+				MaxConnections:           10,
+				HTTP1MaxPendingRequests:  5,
+				MaxRequestsPerConnection: 1,
+			},
+			OutlierDetection: params.OutlierDetection{
+				Consecutive5xxErrors: 5,
+				Interval:             10 * time.Second,
+				BaseEjectionTime:     30 * time.Second,
+				MaxEjectionPercent:   100,
+			},
+		},
+	}
+	config.SetDefaults()
+
+	destinationRule := istio.NewDestinationRule(config, config.NamespaceName(), config.ResourceName())
+	testutil.AssertGolden(t, "destinationrule", destinationRule)
+}
+
+func TestNewWaypointGolden(t *testing.T) {
+	config := &params.Config{
+		MicroserviceName:      "sample",
+		MicroserviceNamespace: "sample",
+		PrismMockSuffix:       "-prism-mock",
+		IstioMode:             true,
+		Istio:                 params.Istio{Dataplane: params.DataplaneAmbient},
+	}
+	config.SetDefaults()
+
+	waypoint := istio.NewWaypoint(config, config.NamespaceName())
+	testutil.AssertGolden(t, "waypoint", waypoint)
+}
+
+func TestDeleteWaypoint(t *testing.T) {
+	config := newConfig()
+	config.Istio.Dataplane = params.DataplaneAmbient
+	unowned := istio.NewWaypoint(config, testNamespaceName)
+	unowned.SetLabels(map[string]string{"istio.io/waypoint-for": "service"})
+
+	tests := []struct {
+		name     string
+		existing *unstructured.Unstructured
+		wantKept bool
+	}{
+		{
+			name:     "created by the mock",
+			existing: istio.NewWaypoint(config, testNamespaceName),
+		},
+		{
+			name:     "not created by the mock",
+			existing: unowned,
+			wantKept: true,
+		},
+		{
+			name: "not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+			if tt.existing != nil {
+				// created through the client, which knows the plural of Gateway unlike the fake tracker
+				_, err := dynamicClient.Resource(istio.GatewayResource).Namespace(testNamespaceName).Create(ctx, tt.existing, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+
+			// test target
+			err := istio.DeleteWaypoint(ctx, dynamicClient, testNamespaceName)
+
+			// verify
+			require.NoError(t, err)
+			_, err = dynamicClient.Resource(istio.GatewayResource).Namespace(testNamespaceName).Get(ctx, "waypoint", metav1.GetOptions{})
+			if tt.wantKept {
+				require.NoError(t, err)
+				return
+			}
+			assert.True(t, apierrors.IsNotFound(err))
+		})
+	}
 }
@@ -0,0 +1,92 @@
+package istio
+
+import (
+	"context"
+	"log"
+	"slices"
+
+	"github.com/gold-kou/prism-in-k8s/app/ownership"
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/pingcap/errors"
+	"golang.org/x/xerrors"
+	networkingv1alpha3 "istio.io/api/networking/v1alpha3"
+	"istio.io/client-go/pkg/apis/networking/v1alpha3"
+	"istio.io/client-go/pkg/clientset/versioned"
+)
+
+var (
+	errFailedToAddMirror    = errors.New("failed to add mirror")
+	errFailedToRemoveMirror = errors.New("failed to remove mirror")
+)
+
+// newMirror returns the mirror destination of the mock, or nil if trafficMirror is disabled.
+func newMirror(config *params.Config, namespaceName, resourceName string) *networkingv1alpha3.Destination {
+	if !config.TrafficMirror.Enabled() {
+		return nil
+	}
+	return &networkingv1alpha3.Destination{
+		Host: resourceName + "." + namespaceName + ".svc.cluster.local",
+	}
+}
+
+func newMirrorPercentage(config *params.Config) *networkingv1alpha3.Percent {
+	if !config.TrafficMirror.Enabled() {
+		return nil
+	}
+	return &networkingv1alpha3.Percent{Value: config.TrafficMirror.Percentage}
+}
+
+// addMirror sets the mirror to the mock on the routes of the VirtualService of the real microservice which route to it,
+// and records it in the VirtualService of the mock to remove it later.
+// The routes already mirroring to another host are left as they are, because a route has only one mirror.
+func addMirror(ctx context.Context, istioClientSet versioned.Interface, config *params.Config, namespaceName, resourceName string, target *v1alpha3.VirtualService) error {
+	mirror := newMirror(config, namespaceName, resourceName)
+	hosts := microserviceHosts(config)
+	mirrored := 0
+	err := updateVirtualService(ctx, istioClientSet, target.Namespace, target.Name, func(virtualService *v1alpha3.VirtualService) {
+		mirrored = 0
+		for _, route := range virtualService.Spec.Http {
+			if !slices.ContainsFunc(route.GetRoute(), func(destination *networkingv1alpha3.HTTPRouteDestination) bool {
+				return slices.Contains(hosts, destination.GetDestination().GetHost())
+			}) {
+				continue
+			}
+			if route.GetMirror() != nil && route.GetMirror().GetHost() != mirror.GetHost() {
+				log.Printf("[WARN] Route %q of VirtualService %s/%s already mirrors to %s, so it is not mirrored to the mock", route.GetName(), target.Namespace, target.Name, route.GetMirror().GetHost())
+				continue
+			}
+			route.Mirror = mirror
+			route.MirrorPercentage = newMirrorPercentage(config)
+			mirrored++
+		}
+	})
+	if err != nil {
+		return xerrors.Errorf("%w: %s/%s: %w", errFailedToAddMirror, target.Namespace, target.Name, err)
+	}
+	err = setTarget(ctx, istioClientSet, namespaceName, resourceName, ownership.MirrorAnnotation, target.Namespace+"/"+target.Name)
+	if err != nil {
+		return xerrors.Errorf("%w: %w", errFailedToAddMirror, err)
+	}
+	log.Printf("[INFO] %d routes of VirtualService %s/%s mirror %g%% of the requests to the mock", mirrored, target.Namespace, target.Name, config.TrafficMirror.Percentage)
+	return nil
+}
+
+// removeMirror removes only the mirrors to the mock added by addMirror, keeping the other changes made to the VirtualService since.
+func removeMirror(ctx context.Context, istioClientSet versioned.Interface, namespaceName, resourceName string) error {
+	mockHost := resourceName + "." + namespaceName + ".svc.cluster.local"
+	target, err := restoreTarget(ctx, istioClientSet, namespaceName, resourceName, ownership.MirrorAnnotation, func(virtualService *v1alpha3.VirtualService) {
+		for _, route := range virtualService.Spec.Http {
+			if route.GetMirror().GetHost() == mockHost {
+				route.Mirror = nil
+				route.MirrorPercentage = nil
+			}
+		}
+	})
+	if err != nil {
+		return xerrors.Errorf("%w: %w", errFailedToRemoveMirror, err)
+	}
+	if target != "" {
+		log.Printf("[INFO] The mirror to the mock is removed from VirtualService %s", target)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package istio
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/pingcap/errors"
+	"golang.org/x/xerrors"
+	"google.golang.org/protobuf/types/known/durationpb"
+	networkingv1alpha3 "istio.io/api/networking/v1alpha3"
+	"istio.io/client-go/pkg/apis/networking/v1alpha3"
+	"istio.io/client-go/pkg/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	errFailedToGetRoutes    = errors.New("failed to get routes of the mock")
+	errFailedToUpdateRoutes = errors.New("failed to update routes of the mock")
+)
+
+// MockRoutes returns the routes of the VirtualService of the mock.
+func MockRoutes(ctx context.Context, istioClientSet versioned.Interface, namespaceName, resourceName string) ([]*networkingv1alpha3.HTTPRoute, error) {
+	virtualService, err := istioClientSet.NetworkingV1alpha3().VirtualServices(namespaceName).Get(ctx, resourceName, metav1.GetOptions{})
+	if err != nil {
+		return nil, xerrors.Errorf("%w: %w", errFailedToGetRoutes, err)
+	}
+	return virtualService.Spec.Http, nil
+}
+
+// SetMockRoutes replaces the routes of the VirtualService of the mock, e.g. with the routes of NewVirtualService for other faults.
+func SetMockRoutes(ctx context.Context, istioClientSet versioned.Interface, namespaceName, resourceName string, routes []*networkingv1alpha3.HTTPRoute) error {
+	err := updateVirtualService(ctx, istioClientSet, namespaceName, resourceName, func(virtualService *v1alpha3.VirtualService) {
+		virtualService.Spec.Http = routes
+	})
+	if err != nil {
+		return xerrors.Errorf("%w: %w", errFailedToUpdateRoutes, err)
+	}
+	return nil
+}
+
+// newRoutes builds the routes of the VirtualService of the mock from routes, in the same order as the fault proxy matches them.
+func newRoutes(config *params.Config, host string) []*networkingv1alpha3.HTTPRoute {
+	routes := make([]*networkingv1alpha3.HTTPRoute, 0, len(config.Routes))
+	for _, route := range config.Routes {
+		httpRoute := &networkingv1alpha3.HTTPRoute{
+			Name: route.Name,
+			Route: []*networkingv1alpha3.HTTPRouteDestination{
+				{
+					Destination: &networkingv1alpha3.Destination{Host: host},
+				},
+			},
+		}
+		if match := newMatch(route.Match); match != nil {
+			httpRoute.Match = []*networkingv1alpha3.HTTPMatchRequest{match}
+		}
+		if route.Timeout != 0 {
+			httpRoute.Timeout = durationpb.New(route.Timeout)
+		}
+		if retries := route.Retries; retries.Enabled() {
+			httpRoute.Retries = &networkingv1alpha3.HTTPRetry{
+				Attempts: int32(retries.Attempts),
+				RetryOn:  retries.RetryOn,
+			}
+			if retries.PerTryTimeout != 0 {
+				httpRoute.Retries.PerTryTimeout = durationpb.New(retries.PerTryTimeout)
+			}
+		}
+		if route.Fault.Enabled() {
+			httpRoute.Fault = newFault(route.Fault)
+		}
+		routes = append(routes, httpRoute)
+	}
+	return routes
+}
+
+// newMatch returns nil for an empty match, which matches all the requests.
+func newMatch(match params.RouteMatch) *networkingv1alpha3.HTTPMatchRequest {
+	if match.PathPrefix == "" && match.Method == "" && len(match.Headers) == 0 {
+		return nil
+	}
+	request := &networkingv1alpha3.HTTPMatchRequest{}
+	if match.PathPrefix != "" {
+		request.Uri = &networkingv1alpha3.StringMatch{
+			MatchType: &networkingv1alpha3.StringMatch_Prefix{Prefix: match.PathPrefix},
+		}
+	}
+	if match.Method != "" {
+		request.Method = &networkingv1alpha3.StringMatch{
+			MatchType: &networkingv1alpha3.StringMatch_Exact{Exact: strings.ToUpper(match.Method)},
+		}
+	}
+	for name, value := range match.Headers {
+		if request.Headers == nil {
+			request.Headers = map[string]*networkingv1alpha3.StringMatch{}
+		}
+		request.Headers[strings.ToLower(name)] = &networkingv1alpha3.StringMatch{
+			MatchType: &networkingv1alpha3.StringMatch_Exact{Exact: value},
+		}
+	}
+	return request
+}
+
+func newFault(fault params.Fault) *networkingv1alpha3.HTTPFaultInjection {
+	injection := &networkingv1alpha3.HTTPFaultInjection{}
+	if delay := fault.Delay; delay.FixedDelay != 0 {
+		injection.Delay = &networkingv1alpha3.HTTPFaultInjection_Delay{
+			Percentage: &networkingv1alpha3.Percent{Value: delay.AppliedPercentage()},
+			HttpDelayType: &networkingv1alpha3.HTTPFaultInjection_Delay_FixedDelay{
+				FixedDelay: durationpb.New(delay.FixedDelay),
+			},
+		}
+	}
+	if abort := fault.Abort; abort.HTTPStatus != 0 {
+		injection.Abort = &networkingv1alpha3.HTTPFaultInjection_Abort{
+			Percentage: &networkingv1alpha3.Percent{Value: abort.AppliedPercentage()},
+			ErrorType: &networkingv1alpha3.HTTPFaultInjection_Abort_HttpStatus{
+				HttpStatus: int32(abort.HTTPStatus),
+			},
+		}
+	}
+	return injection
+}
@@ -0,0 +1,306 @@
+package istio
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/gold-kou/prism-in-k8s/app/ownership"
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/pingcap/errors"
+	"golang.org/x/xerrors"
+	networkingv1alpha3 "istio.io/api/networking/v1alpha3"
+	"istio.io/client-go/pkg/apis/networking/v1alpha3"
+	"istio.io/client-go/pkg/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	maxWeight = 100
+	// splitSuffix is the suffix of the VirtualService splitting the traffic to the real microservice
+	splitSuffix = "-split"
+	// headerRouteSuffix is the suffix of the name of the route to the mock by the headers
+	headerRouteSuffix = "-headers"
+)
+
+var (
+	errFailedToApplyTrafficSplit = errors.New("failed to apply traffic split")
+	errFailedToApplyHeaderRoute  = errors.New("failed to apply header route")
+	errFailedToRemoveHeaderRoute = errors.New("failed to remove header route")
+)
+
+// routeToMock sends the traffic to the real microservice to the mock as trafficSplit and trafficMirror say.
+// The routes of the previous run are removed first, so that a change of the parameters is applied cleanly.
+func routeToMock(ctx context.Context, istioClientSet versioned.Interface, config *params.Config, namespaceName, resourceName string) error {
+	if err := removeHeaderRoute(ctx, istioClientSet, namespaceName, resourceName); err != nil {
+		return err
+	}
+	if err := removeMirror(ctx, istioClientSet, namespaceName, resourceName); err != nil {
+		return err
+	}
+	if !config.TrafficSplit.Enabled() && !config.TrafficMirror.Enabled() {
+		return deleteTrafficSplit(ctx, istioClientSet, namespaceName, resourceName)
+	}
+
+	others, err := findVirtualServices(ctx, istioClientSet, config)
+	if err != nil {
+		return err
+	}
+	if config.TrafficSplit.Weight == 0 && len(others) == 1 {
+		// the routes are changed in the VirtualService of the real microservice to keep its routing
+		if err := deleteTrafficSplit(ctx, istioClientSet, namespaceName, resourceName); err != nil {
+			return err
+		}
+		if len(config.TrafficSplit.Headers) > 0 {
+			if err := insertHeaderRoute(ctx, istioClientSet, config, namespaceName, resourceName, others[0]); err != nil {
+				return err
+			}
+		}
+		if config.TrafficMirror.Enabled() {
+			return addMirror(ctx, istioClientSet, config, namespaceName, resourceName, others[0])
+		}
+		return nil
+	}
+	for _, other := range others {
+		log.Printf("[WARN] VirtualService %s/%s also routes %s, so the traffic split may not be applied", other.Namespace, other.Name, config.MicroserviceHost())
+	}
+	return applyTrafficSplit(ctx, istioClientSet, config, namespaceName, resourceName)
+}
+
+// NewSplitVirtualService builds the VirtualService for the host of the real microservice, which sends the requests matching trafficSplit.headers
+// and trafficSplit.weight percent of the others to the mock, and mirrors trafficMirror.percentage percent of them to the mock.
+// It is in the namespace of the mock, so that it is deleted with the mock, and routes to the real microservice across the namespaces by the FQDNs.
+func NewSplitVirtualService(config *params.Config, namespaceName, resourceName string) *v1alpha3.VirtualService {
+	weight := int32(config.TrafficSplit.Weight)
+	http := []*networkingv1alpha3.HTTPRoute{}
+	if len(config.TrafficSplit.Headers) > 0 {
+		http = append(http, NewHeaderRoute(config, namespaceName, resourceName))
+	}
+	http = append(http, &networkingv1alpha3.HTTPRoute{
+		Name: "split",
+		Route: []*networkingv1alpha3.HTTPRouteDestination{
+			{
+				Destination: &networkingv1alpha3.Destination{
+					Host: config.MicroserviceHost(),
+				},
+				Weight: maxWeight - weight,
+			},
+			{
+				Destination: &networkingv1alpha3.Destination{
+					Host: resourceName + "." + namespaceName + ".svc.cluster.local",
+				},
+				Weight: weight,
+			},
+		},
+		Mirror:           newMirror(config, namespaceName, resourceName),
+		MirrorPercentage: newMirrorPercentage(config),
+	})
+
+	return &v1alpha3.VirtualService{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      resourceName + splitSuffix,
+			Namespace: namespaceName,
+			Labels:    ownership.Labels(config.MicroserviceName),
+		},
+		Spec: networkingv1alpha3.VirtualService{
+			Hosts: []string{
+				config.MicroserviceHost(),
+			},
+			Http: http,
+		},
+	}
+}
+
+// NewHeaderRoute builds the route sending the requests matching any of trafficSplit.headers to the mock.
+func NewHeaderRoute(config *params.Config, namespaceName, resourceName string) *networkingv1alpha3.HTTPRoute {
+	route := &networkingv1alpha3.HTTPRoute{
+		Name: resourceName + headerRouteSuffix,
+		Route: []*networkingv1alpha3.HTTPRouteDestination{
+			{
+				Destination: &networkingv1alpha3.Destination{
+					Host: resourceName + "." + namespaceName + ".svc.cluster.local",
+				},
+			},
+		},
+	}
+	for _, header := range config.TrafficSplit.Headers {
+		match := &networkingv1alpha3.StringMatch{}
+		switch {
+		case header.Exact != "":
+			match.MatchType = &networkingv1alpha3.StringMatch_Exact{Exact: header.Exact}
+		case header.Prefix != "":
+			match.MatchType = &networkingv1alpha3.StringMatch_Prefix{Prefix: header.Prefix}
+		default:
+			match.MatchType = &networkingv1alpha3.StringMatch_Regex{Regex: header.Regex}
+		}
+		// the matches are ORed
+		route.Match = append(route.Match, &networkingv1alpha3.HTTPMatchRequest{
+			Headers: map[string]*networkingv1alpha3.StringMatch{strings.ToLower(header.Name): match},
+		})
+	}
+	return route
+}
+
+// applyTrafficSplit creates the split VirtualService or updates its routes, so that the traffic can be moved to the mock gradually.
+func applyTrafficSplit(ctx context.Context, istioClientSet versioned.Interface, config *params.Config, namespaceName, resourceName string) error {
+	desired := NewSplitVirtualService(config, namespaceName, resourceName)
+	virtualServices := istioClientSet.NetworkingV1alpha3().VirtualServices(namespaceName)
+	_, err := virtualServices.Create(ctx, desired, metav1.CreateOptions{})
+	if err == nil {
+		log.Printf("[INFO] VirtualService %s is created to route the traffic to %s to the mock", desired.Name, config.MicroserviceHost())
+		return nil
+	}
+	if !errors.IsAlreadyExists(err) {
+		return xerrors.Errorf("%w: %w", errFailedToApplyTrafficSplit, err)
+	}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := virtualServices.Get(ctx, desired.Name, metav1.GetOptions{})
+		if err != nil {
+			return err //nolint:wrapcheck // wrapped below
+		}
+		current.Labels = desired.Labels
+		desired.Spec.DeepCopyInto(&current.Spec)
+		_, err = virtualServices.Update(ctx, current, metav1.UpdateOptions{})
+		return err //nolint:wrapcheck // wrapped below
+	})
+	if err != nil {
+		return xerrors.Errorf("%w: %w", errFailedToApplyTrafficSplit, err)
+	}
+	log.Printf("[INFO] VirtualService %s is updated to route the traffic to %s to the mock", desired.Name, config.MicroserviceHost())
+	return nil
+}
+
+// findVirtualServices returns the VirtualServices routing the host of the real microservice in its namespace.
+func findVirtualServices(ctx context.Context, istioClientSet versioned.Interface, config *params.Config) ([]*v1alpha3.VirtualService, error) {
+	list, err := istioClientSet.NetworkingV1alpha3().VirtualServices(config.MicroserviceNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, xerrors.Errorf("%w: failed to list the VirtualServices in %s: %w", errFailedToApplyTrafficSplit, config.MicroserviceNamespace, err)
+	}
+	hosts := microserviceHosts(config)
+	found := []*v1alpha3.VirtualService{}
+	for _, virtualService := range list.Items {
+		if slices.ContainsFunc(virtualService.Spec.Hosts, func(host string) bool { return slices.Contains(hosts, host) }) {
+			found = append(found, virtualService)
+		}
+	}
+	return found, nil
+}
+
+// microserviceHosts returns the short and the long names of the host of the real microservice.
+func microserviceHosts(config *params.Config) []string {
+	return []string{
+		config.MicroserviceName,
+		config.MicroserviceName + "." + config.MicroserviceNamespace,
+		config.MicroserviceName + "." + config.MicroserviceNamespace + ".svc",
+		config.MicroserviceHost(),
+	}
+}
+
+// insertHeaderRoute inserts the header route at the top of the VirtualService of the real microservice,
+// and records it in the VirtualService of the mock to remove it later.
+func insertHeaderRoute(ctx context.Context, istioClientSet versioned.Interface, config *params.Config, namespaceName, resourceName string, target *v1alpha3.VirtualService) error {
+	route := NewHeaderRoute(config, namespaceName, resourceName)
+	err := updateVirtualService(ctx, istioClientSet, target.Namespace, target.Name, func(virtualService *v1alpha3.VirtualService) {
+		virtualService.Spec.Http = append([]*networkingv1alpha3.HTTPRoute{route}, withoutRoute(virtualService.Spec.Http, route.Name)...)
+	})
+	if err != nil {
+		return xerrors.Errorf("%w: %s/%s: %w", errFailedToApplyHeaderRoute, target.Namespace, target.Name, err)
+	}
+	err = setTarget(ctx, istioClientSet, namespaceName, resourceName, ownership.HeaderRouteAnnotation, target.Namespace+"/"+target.Name)
+	if err != nil {
+		return xerrors.Errorf("%w: %w", errFailedToApplyHeaderRoute, err)
+	}
+	log.Printf("[INFO] The route to the mock by the headers is inserted into VirtualService %s/%s", target.Namespace, target.Name)
+	return nil
+}
+
+// removeHeaderRoute removes the header route inserted by insertHeaderRoute, so that the routing of the real microservice is restored.
+func removeHeaderRoute(ctx context.Context, istioClientSet versioned.Interface, namespaceName, resourceName string) error {
+	routeName := resourceName + headerRouteSuffix
+	target, err := restoreTarget(ctx, istioClientSet, namespaceName, resourceName, ownership.HeaderRouteAnnotation, func(virtualService *v1alpha3.VirtualService) {
+		virtualService.Spec.Http = withoutRoute(virtualService.Spec.Http, routeName)
+	})
+	if err != nil {
+		return xerrors.Errorf("%w: %w", errFailedToRemoveHeaderRoute, err)
+	}
+	if target != "" {
+		log.Printf("[INFO] The route to the mock by the headers is removed from VirtualService %s", target)
+	}
+	return nil
+}
+
+// setTarget records the namespace/name of the VirtualService of the real microservice changed for the mock in the annotation of the VirtualService of the mock.
+func setTarget(ctx context.Context, istioClientSet versioned.Interface, namespaceName, resourceName, annotation, target string) error {
+	return updateVirtualService(ctx, istioClientSet, namespaceName, resourceName, func(virtualService *v1alpha3.VirtualService) {
+		if virtualService.Annotations == nil {
+			virtualService.Annotations = map[string]string{}
+		}
+		virtualService.Annotations[annotation] = target
+	})
+}
+
+// restoreTarget reverts the VirtualService recorded in the annotation by restore, and removes the annotation.
+// It returns the namespace/name of the reverted VirtualService, or empty if nothing is recorded.
+// A deleted VirtualService is ignored.
+func restoreTarget(ctx context.Context, istioClientSet versioned.Interface, namespaceName, resourceName, annotation string, restore func(*v1alpha3.VirtualService)) (string, error) {
+	virtualService, err := istioClientSet.NetworkingV1alpha3().VirtualServices(namespaceName).Get(ctx, resourceName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err //nolint:wrapcheck // wrapped by the callers
+	}
+	target, ok := virtualService.Annotations[annotation]
+	if !ok {
+		return "", nil
+	}
+
+	targetNamespace, targetName, _ := strings.Cut(target, "/")
+	err = updateVirtualService(ctx, istioClientSet, targetNamespace, targetName, restore)
+	if err != nil && !errors.IsNotFound(err) {
+		return "", xerrors.Errorf("%s: %w", target, err)
+	}
+	err = updateVirtualService(ctx, istioClientSet, namespaceName, resourceName, func(virtualService *v1alpha3.VirtualService) {
+		delete(virtualService.Annotations, annotation)
+	})
+	if err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// updateVirtualService gets the VirtualService, mutates it and updates it, retrying on conflicts with the other writers, e.g. the owners of the real microservice.
+func updateVirtualService(ctx context.Context, istioClientSet versioned.Interface, namespaceName, name string, mutate func(*v1alpha3.VirtualService)) error {
+	virtualServices := istioClientSet.NetworkingV1alpha3().VirtualServices(namespaceName)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error { //nolint:wrapcheck // wrapped by the callers
+		virtualService, err := virtualServices.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err //nolint:wrapcheck // wrapped by the callers
+		}
+		mutate(virtualService)
+		_, err = virtualServices.Update(ctx, virtualService, metav1.UpdateOptions{})
+		return err //nolint:wrapcheck // wrapped by the callers
+	})
+}
+
+func withoutRoute(routes []*networkingv1alpha3.HTTPRoute, name string) []*networkingv1alpha3.HTTPRoute {
+	return slices.DeleteFunc(slices.Clone(routes), func(route *networkingv1alpha3.HTTPRoute) bool {
+		return route.GetName() == name
+	})
+}
+
+// deleteTrafficSplit deletes the split VirtualService. It is ignored if the traffic is not split.
+func deleteTrafficSplit(ctx context.Context, istioClientSet versioned.Interface, namespaceName, resourceName string) error {
+	err := istioClientSet.NetworkingV1alpha3().VirtualServices(namespaceName).Delete(ctx, resourceName+splitSuffix, metav1.DeleteOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return xerrors.Errorf("%w: %w", errFailedToDeleteVirtualService, err)
+		}
+		return nil
+	}
+	log.Println("[INFO] VirtualService of the traffic split is deleted successfully, all the traffic goes to the real microservice")
+	return nil
+}
@@ -0,0 +1,107 @@
+package istio
+
+import (
+	"context"
+	"log"
+
+	"github.com/gold-kou/prism-in-k8s/app/ownership"
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/pingcap/errors"
+	"golang.org/x/xerrors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	waypointClassName = "istio-waypoint"
+	// waypointPort is the HBONE port of the waypoint
+	waypointPort = 15008
+)
+
+// GatewayResource is the Gateway API resource of the waypoint.
+var GatewayResource = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"}
+
+var (
+	errFailedToCreateWaypoint = errors.New("failed to create waypoint")
+	errFailedToDeleteWaypoint = errors.New("failed to delete waypoint")
+	errNoGatewayAPI           = errors.New("the Gateway API CRDs are required for the waypoint in ambient")
+)
+
+// NewWaypoint builds the waypoint Gateway for the services in the namespace of the mock, which applies the VirtualService and the DestinationRule in ambient.
+func NewWaypoint(config *params.Config, namespaceName string) *unstructured.Unstructured {
+	labels := map[string]interface{}{
+		"istio.io/waypoint-for": "service",
+	}
+	for key, value := range ownership.Labels(config.MicroserviceName) {
+		labels[key] = value
+	}
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": GatewayResource.GroupVersion().String(),
+			"kind":       "Gateway",
+			"metadata": map[string]interface{}{
+				"name":      config.WaypointName(),
+				"namespace": namespaceName,
+				"labels":    labels,
+			},
+			"spec": map[string]interface{}{
+				"gatewayClassName": waypointClassName,
+				"listeners": []interface{}{
+					map[string]interface{}{
+						"name":     "mesh",
+						"port":     int64(waypointPort),
+						"protocol": "HBONE",
+					},
+				},
+			},
+		},
+	}
+}
+
+// CreateWaypoint deploys the waypoint in the namespace of the mock unless istio.waypoint references an existing one.
+// It is deleted by DeleteWaypoint, because the namespace is kept if it is not created by the mock.
+func CreateWaypoint(ctx context.Context, dynamicClient dynamic.Interface, config *params.Config, namespaceName string) error {
+	if config.Istio.Waypoint != "" {
+		log.Printf("[INFO] The existing waypoint %s is used", config.Istio.Waypoint)
+		return nil
+	}
+	_, err := dynamicClient.Resource(GatewayResource).Namespace(namespaceName).Create(ctx, NewWaypoint(config, namespaceName), metav1.CreateOptions{})
+	if err != nil {
+		switch {
+		case errors.IsAlreadyExists(err):
+			log.Println("[WARN] The waypoint already exists")
+			return nil
+		case errors.IsNotFound(err):
+			return xerrors.Errorf("%w: %w", errNoGatewayAPI, err)
+		default:
+			return xerrors.Errorf("%w: %w", errFailedToCreateWaypoint, err)
+		}
+	}
+	log.Println("[INFO] Waypoint is created successfully")
+	return nil
+}
+
+// DeleteWaypoint deletes the waypoint deployed by CreateWaypoint in the namespace of the mock. Missing waypoint is ignored,
+// and so is missing Gateway API. A Gateway without the ownership labels, e.g. deployed by hand with the same name, is kept.
+func DeleteWaypoint(ctx context.Context, dynamicClient dynamic.Interface, namespaceName string) error {
+	gateways := dynamicClient.Resource(GatewayResource).Namespace(namespaceName)
+	waypoint, err := gateways.Get(ctx, params.DefaultWaypointName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return xerrors.Errorf("%w: %w", errFailedToDeleteWaypoint, err)
+	}
+	if waypoint.GetLabels()[ownership.ManagedByLabel] != ownership.ManagedByValue {
+		log.Printf("[WARN] The waypoint %s/%s is kept because it is not created by the mock", namespaceName, waypoint.GetName())
+		return nil
+	}
+	err = gateways.Delete(ctx, waypoint.GetName(), metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return xerrors.Errorf("%w: %w", errFailedToDeleteWaypoint, err)
+	}
+	log.Println("[INFO] Waypoint is deleted successfully")
+	return nil
+}
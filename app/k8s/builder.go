@@ -0,0 +1,257 @@
+package k8s
+
+import (
+	"strconv"
+
+	"github.com/gold-kou/prism-in-k8s/app/faultproxy"
+	"github.com/gold-kou/prism-in-k8s/app/ownership"
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/gold-kou/prism-in-k8s/app/util"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// PrismImage is the upstream image of Dockerfile.prism, used when the OpenAPI definition is mounted from a ConfigMap
+	PrismImage = "stoplight/prism:5.8.2"
+	// SpecConfigMapKey is the key of the OpenAPI definition in the spec ConfigMap
+	SpecConfigMapKey = "openapi.yaml"
+	specVolumeName   = "openapi"
+	specMountPath    = "/spec"
+	// imagePrismPort and imageSpecPath are the port and the OpenAPI definition of CMD of Dockerfile.prism
+	imagePrismPort = 80
+	imageSpecPath  = "/app/openapi.yaml"
+
+	faultProxyContainerName = "faultproxy"
+	faultProxyVolumeName    = "faultproxy"
+	faultProxyMountPath     = "/faultproxy"
+	faultProxyCPU           = "100m"
+	faultProxyMemory        = "64Mi"
+)
+
+// DeploymentOptions are the settings of the mock Deployment which are not parameters.
+type DeploymentOptions struct {
+	// Image defaults to PrismImage if OpenAPI is set
+	Image           string
+	ImagePullPolicy corev1.PullPolicy
+	// OpenAPI is set to mount the OpenAPI definition from the spec ConfigMap instead of using the one in the image
+	OpenAPI string
+	// FaultProxyImage is the image of cmd/faultproxy, required if the parameters need the fault proxy
+	FaultProxyImage string
+	Owner           ownership.Owner
+}
+
+// SpecConfigMapName returns the name of the ConfigMap holding the OpenAPI definition of the mock.
+func SpecConfigMapName(resourceName string) string {
+	return resourceName + "-openapi"
+}
+
+// FaultProxyConfigMapName returns the name of the ConfigMap holding the routes of the fault proxy.
+func FaultProxyConfigMapName(resourceName string) string {
+	return resourceName + "-faultproxy"
+}
+
+// PodPort returns the port of the pod serving the mock, the fault proxy or Prism.
+func PodPort(config *params.Config) int {
+	if config.FaultProxyEnabled() {
+		return params.FaultProxyPort
+	}
+	return config.PrismPort
+}
+
+// NewDeployment builds the Deployment running Prism.
+func NewDeployment(config *params.Config, namespaceName, resourceName string, options DeploymentOptions) *appsv1.Deployment {
+	if options.OpenAPI != "" {
+		if options.Image == "" {
+			options.Image = PrismImage
+		}
+		if options.Owner.SpecHash == "" {
+			options.Owner.SpecHash = ownership.HashSpec([]byte(options.OpenAPI))
+		}
+	}
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        resourceName,
+			Namespace:   namespaceName,
+			Labels:      ownership.Labels(config.MicroserviceName),
+			Annotations: options.Owner.Annotations(),
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: util.Int32Ptr(1),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app": resourceName,
+				},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"app": resourceName,
+					},
+					Annotations: map[string]string{},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:            resourceName,
+							Image:           options.Image,
+							ImagePullPolicy: options.ImagePullPolicy,
+							Ports: []corev1.ContainerPort{
+								{
+									ContainerPort: int32(config.PrismPort),
+								},
+							},
+							Resources: corev1.ResourceRequirements{
+								Limits: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse(config.PrismCPU),
+									corev1.ResourceMemory: resource.MustParse(config.PrismMemory),
+								},
+							},
+						},
+					},
+					PriorityClassName: config.PriorityClassName,
+				},
+			},
+		},
+	}
+
+	if options.OpenAPI != "" {
+		// roll out the pods when the mounted OpenAPI definition changes
+		deployment.Spec.Template.ObjectMeta.Annotations[ownership.SpecHashAnnotation] = options.Owner.SpecHash
+
+		podSpec := &deployment.Spec.Template.Spec
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: specVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: SpecConfigMapName(resourceName)},
+				},
+			},
+		})
+		podSpec.Containers[0].VolumeMounts = []corev1.VolumeMount{
+			{
+				Name:      specVolumeName,
+				MountPath: specMountPath,
+				ReadOnly:  true,
+			},
+		}
+		// same as CMD of Dockerfile.prism except for the port and the path
+		podSpec.Containers[0].Args = []string{"mock", "-h", "0.0.0.0", "-p", strconv.Itoa(config.PrismPort), specMountPath + "/" + SpecConfigMapKey}
+	} else if config.PrismPort != imagePrismPort {
+		// same as CMD of Dockerfile.prism except for the port
+		deployment.Spec.Template.Spec.Containers[0].Args = []string{"mock", "-h", "0.0.0.0", "-p", strconv.Itoa(config.PrismPort), imageSpecPath}
+	}
+
+	if config.FaultProxyEnabled() {
+		addFaultProxy(&deployment.Spec.Template.Spec, config, resourceName, options.FaultProxyImage)
+	}
+
+	// no sidecar in ambient, where ztunnel and the waypoint handle the traffic
+	if config.IstioMode && !config.Ambient() {
+		deployment.Spec.Template.ObjectMeta.Annotations["sidecar.istio.io/inject"] = "true"
+		deployment.Spec.Template.ObjectMeta.Annotations["sidecar.istio.io/proxyCPULimit"] = config.IstioProxyCPU
+		deployment.Spec.Template.ObjectMeta.Annotations["sidecar.istio.io/proxyMemoryLimit"] = config.IstioProxyMemory
+		deployment.Spec.Template.ObjectMeta.Annotations["traffic.sidecar.istio.io/includeOutboundIPRanges"] = "*"
+		deployment.Spec.Template.ObjectMeta.Annotations["proxy.istio.io/config"] = `{ "terminationDrainDuration": "30s" }`
+	}
+	return deployment
+}
+
+// addFaultProxy adds the fault proxy container in front of Prism, which reloads the routes from the mounted ConfigMap.
+func addFaultProxy(podSpec *corev1.PodSpec, config *params.Config, resourceName, image string) {
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: faultProxyVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: FaultProxyConfigMapName(resourceName)},
+			},
+		},
+	})
+	podSpec.Containers = append(podSpec.Containers, corev1.Container{
+		Name:  faultProxyContainerName,
+		Image: image,
+		Args: []string{
+			"-listen", ":" + strconv.Itoa(params.FaultProxyPort),
+			"-target", "http://127.0.0.1:" + strconv.Itoa(config.PrismPort),
+			"-routes", faultProxyMountPath + "/" + faultproxy.RoutesKey,
+		},
+		Ports: []corev1.ContainerPort{
+			{
+				ContainerPort: params.FaultProxyPort,
+			},
+		},
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(faultProxyCPU),
+				corev1.ResourceMemory: resource.MustParse(faultProxyMemory),
+			},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      faultProxyVolumeName,
+				MountPath: faultProxyMountPath,
+				ReadOnly:  true,
+			},
+		},
+	})
+}
+
+// NewService builds the Service in front of Prism, or the fault proxy if it is enabled.
+func NewService(config *params.Config, namespaceName, resourceName string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      resourceName,
+			Namespace: namespaceName,
+			Labels:    ownership.Labels(config.MicroserviceName),
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{
+				"app": resourceName,
+			},
+			Ports: []corev1.ServicePort{
+				{
+					Protocol:   corev1.ProtocolTCP,
+					Port:       servicePort,
+					TargetPort: intstr.FromInt(PodPort(config)),
+				},
+			},
+			Type: corev1.ServiceTypeClusterIP,
+		},
+	}
+}
+
+// NewSpecConfigMap builds the ConfigMap holding the OpenAPI definition.
+func NewSpecConfigMap(config *params.Config, namespaceName, resourceName, openAPI string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      SpecConfigMapName(resourceName),
+			Namespace: namespaceName,
+			Labels:    ownership.Labels(config.MicroserviceName),
+		},
+		Data: map[string]string{
+			SpecConfigMapKey: openAPI,
+		},
+	}
+}
+
+// NewFaultProxyConfigMap builds the ConfigMap holding the routes of the fault proxy.
+func NewFaultProxyConfigMap(config *params.Config, namespaceName, resourceName string) (*corev1.ConfigMap, error) {
+	routes, err := faultproxy.MarshalRoutes(config.FaultProxyRoutes())
+	if err != nil {
+		return nil, err //nolint:wrapcheck // already wrapped
+	}
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      FaultProxyConfigMapName(resourceName),
+			Namespace: namespaceName,
+			Labels:    ownership.Labels(config.MicroserviceName),
+		},
+		Data: map[string]string{
+			faultproxy.RoutesKey: routes,
+		},
+	}, nil
+}
@@ -0,0 +1,111 @@
+package k8s_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/k8s"
+	"github.com/gold-kou/prism-in-k8s/app/ownership"
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/gold-kou/prism-in-k8s/app/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var testOwner = ownership.Owner{
+	Creator:    "arn:aws:iam::123456789012:user/tester",
+	SpecHash:   "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+	Repository: "sample-prism-mock",
+	ExpiresAt:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+}
+
+// goldenCases is the matrix of the generated resources pinned by the golden files.
+var goldenCases = []struct {
+	name    string
+	config  params.Config
+	options k8s.DeploymentOptions
+}{
+	{
+		name:    "default",
+		config:  params.Config{},
+		options: k8s.DeploymentOptions{Image: "123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/sample-prism-mock", Owner: testOwner},
+	},
+	{
+		name:    "istio",
+		config:  params.Config{IstioMode: true, IstioProxyCPU: "200m", IstioProxyMemory: "256Mi"},
+		options: k8s.DeploymentOptions{Image: "123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/sample-prism-mock", Owner: testOwner},
+	},
+	{
+		name:    "ambient",
+		config:  params.Config{IstioMode: true, Istio: params.Istio{Dataplane: params.DataplaneAmbient}},
+		options: k8s.DeploymentOptions{Image: "123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/sample-prism-mock", Owner: testOwner},
+	},
+	{
+		name:    "test-mode",
+		config:  params.Config{IstioMode: true},
+		options: k8s.DeploymentOptions{Image: testutil.LocalPrismImage, ImagePullPolicy: corev1.PullNever, Owner: ownership.Owner{Creator: "tester"}},
+	},
+	{
+		name:    "priority-class",
+		config:  params.Config{PriorityClassName: "high-priority", PrismCPU: "1", PrismMemory: "1Gi"},
+		options: k8s.DeploymentOptions{Image: "123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/sample-prism-mock", Owner: testOwner},
+	},
+	{
+		name:    "custom-port",
+		config:  params.Config{PrismPort: 4010},
+		options: k8s.DeploymentOptions{OpenAPI: "openapi: 3.0.0\n", Owner: ownership.Owner{Creator: "tester"}},
+	},
+	{
+		name:    "custom-port-image",
+		config:  params.Config{PrismPort: 4010},
+		options: k8s.DeploymentOptions{Image: "123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/sample-prism-mock", Owner: testOwner},
+	},
+	{
+		name: "fault-proxy",
+		config: params.Config{Routes: []params.Route{
+			{Name: "slow-users", Match: params.RouteMatch{PathPrefix: "/users", Method: "GET"}, Latency: params.Latency{P50: 50 * time.Millisecond, P90: 200 * time.Millisecond, P99: time.Second}},
+			{Name: "unavailable-orders", Match: params.RouteMatch{PathPrefix: "/orders"}, Fault: params.Fault{Abort: params.FaultAbort{HTTPStatus: 503, Percentage: 10}}},
+			{Name: "default", Latency: params.Latency{Distribution: params.DistributionLogNormal, Mean: 100 * time.Millisecond, StdDev: 50 * time.Millisecond}},
+		}},
+		options: k8s.DeploymentOptions{
+			Image:           "123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/sample-prism-mock",
+			FaultProxyImage: "123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/sample-prism-mock:faultproxy",
+			Owner:           testOwner,
+		},
+	},
+}
+
+func TestBuilderGolden(t *testing.T) {
+	for _, tt := range goldenCases {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.MicroserviceName = "sample"
+			config.MicroserviceNamespace = "sample"
+			config.PrismMockSuffix = "-prism-mock"
+			config.SetDefaults()
+
+			deployment := k8s.NewDeployment(&config, config.NamespaceName(), config.ResourceName(), tt.options)
+			testutil.AssertGolden(t, tt.name+"/deployment", deployment)
+			service := k8s.NewService(&config, config.NamespaceName(), config.ResourceName())
+			testutil.AssertGolden(t, tt.name+"/service", service)
+			// the Service must reach a container of the pod
+			containerPorts := []int32{}
+			for _, container := range deployment.Spec.Template.Spec.Containers {
+				for _, port := range container.Ports {
+					containerPorts = append(containerPorts, port.ContainerPort)
+				}
+			}
+			assert.Contains(t, containerPorts, service.Spec.Ports[0].TargetPort.IntVal)
+			if tt.options.OpenAPI != "" {
+				configMap := k8s.NewSpecConfigMap(&config, config.NamespaceName(), config.ResourceName(), tt.options.OpenAPI)
+				testutil.AssertGolden(t, tt.name+"/configmap", configMap)
+			}
+			if config.FaultProxyEnabled() {
+				configMap, err := k8s.NewFaultProxyConfigMap(&config, config.NamespaceName(), config.ResourceName())
+				require.NoError(t, err)
+				testutil.AssertGolden(t, tt.name+"/faultproxy-configmap", configMap)
+			}
+		})
+	}
+}
@@ -2,60 +2,73 @@ package k8s
 
 import (
 	"context"
-	"fmt"
 	"log"
-	"strconv"
 	"strings"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/gold-kou/prism-in-k8s/app/faultproxy"
+	"github.com/gold-kou/prism-in-k8s/app/ownership"
 	"github.com/gold-kou/prism-in-k8s/app/params"
-	"github.com/gold-kou/prism-in-k8s/app/util"
 	"github.com/pingcap/errors"
 	"golang.org/x/xerrors"
-	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth" // to provide configuration
-	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
 )
 
 const (
-	localPrismImage = "my-local-image:v1"
-	servicePort     = 80
+	servicePort = 80
 )
 
 var (
-	errFailedToCreateClientSet  = errors.New("failed to create clientset")
-	errFailedToCreateNameSpace  = errors.New("failed to create namespace")
-	errFailedToCreateDeployment = errors.New("failed to create deployment")
-	errFailedToCreateService    = errors.New("failed to create service")
-	errFailedToDeleteNameSpace  = errors.New("failed to delete namespace")
-	errFailedToDeleteDeployment = errors.New("failed to delete deployment")
-	errFailedToDeleteService    = errors.New("failed to delete service")
-	errFailedToListPods         = errors.New("failed to list pods")
-	errFailedToGetLatestVersion = errors.New("failed to get latest version")
+	errFailedToCreateNameSpace     = errors.New("failed to create namespace")
+	errFailedToCreateDeployment    = errors.New("failed to create deployment")
+	errFailedToCreateService       = errors.New("failed to create service")
+	errFailedToCreateSpecConfigMap = errors.New("failed to create spec configmap")
+	errFailedToDeleteNameSpace     = errors.New("failed to delete namespace")
+	errFailedToGetNameSpace        = errors.New("failed to get namespace")
+	errFailedToUpdateNameSpace     = errors.New("failed to update namespace")
+	errFailedToDeleteDeployment    = errors.New("failed to delete deployment")
+	errFailedToDeleteService       = errors.New("failed to delete service")
+	errFailedToDeleteSpecConfigMap = errors.New("failed to delete spec configmap")
+	errFailedToCreateFaultProxy    = errors.New("failed to create fault proxy configmap")
+	errFailedToDeleteFaultProxy    = errors.New("failed to delete fault proxy configmap")
+	errFailedToListPods            = errors.New("failed to list pods")
+	errFailedToGetFaultProxy       = errors.New("failed to get fault proxy configmap")
+	errFailedToUpdateFaultProxy    = errors.New("failed to update fault proxy configmap")
+	errNoFaultProxyImage           = errors.New("the image of the fault proxy is required for the latency of the routes")
 )
 
-func CreateK8sResources(ctx context.Context, awsAccountID string, awsConfig aws.Config, kubeconfig *restclient.Config, namespaceName, resourceName string, istioMode, isTest bool) error {
-	k8sClientSet, err := kubernetes.NewForConfig(kubeconfig)
+func CreateK8sResources(ctx context.Context, k8sClientSet kubernetes.Interface, config *params.Config, namespaceName, resourceName string, options DeploymentOptions) error {
+	err := createNamespace(ctx, k8sClientSet, config, namespaceName)
 	if err != nil {
-		return xerrors.Errorf("%w: %w", errFailedToCreateClientSet, err)
+		return xerrors.Errorf("%w: %w", errFailedToCreateNameSpace, err)
 	}
 
-	err = createNamespace(ctx, k8sClientSet, namespaceName, istioMode)
-	if err != nil {
-		return xerrors.Errorf("%w: %w", errFailedToCreateNameSpace, err)
+	if options.OpenAPI != "" {
+		err = createSpecConfigMap(ctx, k8sClientSet, config, namespaceName, resourceName, options.OpenAPI)
+		if err != nil {
+			return xerrors.Errorf("%w: %w", errFailedToCreateSpecConfigMap, err)
+		}
+	}
+
+	if config.FaultProxyEnabled() {
+		if options.FaultProxyImage == "" {
+			return errNoFaultProxyImage
+		}
+		err = createFaultProxyConfigMap(ctx, k8sClientSet, config, namespaceName, resourceName)
+		if err != nil {
+			return xerrors.Errorf("%w: %w", errFailedToCreateFaultProxy, err)
+		}
 	}
 
-	err = crateDeployment(ctx, awsAccountID, awsConfig, k8sClientSet, namespaceName, resourceName, istioMode, isTest)
+	err = crateDeployment(ctx, k8sClientSet, config, namespaceName, resourceName, options)
 	if err != nil {
 		return xerrors.Errorf("%w: %w", errFailedToCreateDeployment, err)
 	}
 
-	err = createService(ctx, k8sClientSet, namespaceName, resourceName)
+	err = createService(ctx, k8sClientSet, config, namespaceName, resourceName)
 	if err != nil {
 		return xerrors.Errorf("%w: %w", errFailedToCreateService, err)
 	}
@@ -63,32 +76,25 @@ func CreateK8sResources(ctx context.Context, awsAccountID string, awsConfig aws.
 	return nil
 }
 
-func createNamespace(ctx context.Context, k8sClientSet *kubernetes.Clientset, namespaceName string, istioMode bool) error {
+func createNamespace(ctx context.Context, k8sClientSet kubernetes.Interface, config *params.Config, namespaceName string) error {
 	// Namespace
 	namespace := &corev1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:   namespaceName,
-			Labels: map[string]string{},
+			Labels: ownership.Labels(config.MicroserviceName),
 		},
 	}
 
-	// get the latest istio version from istiod pod considering during upgrade, if not found return empty podList
-	if istioMode {
-		podList, err := k8sClientSet.CoreV1().Pods("istio-system").List(ctx, metav1.ListOptions{
-			LabelSelector: "app=istiod",
-		})
+	istioLabels := map[string]string{}
+	if config.IstioMode {
+		labels, err := injectionLabels(ctx, k8sClientSet, config)
 		if err != nil {
-			return xerrors.Errorf("%w: %w", errFailedToListPods, err)
+			return err
 		}
-		hyphenedVersions := []string{}
-		for _, item := range podList.Items {
-			hyphenedVersions = append(hyphenedVersions, item.ObjectMeta.Labels["istio.io/rev"])
+		istioLabels = labels
+		for key, value := range labels {
+			namespace.ObjectMeta.Labels[key] = value
 		}
-		latestVersion := getLatestVersion(hyphenedVersions)
-		if err != nil {
-			return xerrors.Errorf("%w: %w", errFailedToGetLatestVersion, err)
-		}
-		namespace.ObjectMeta.Labels["istio.io/rev"] = latestVersion
 	}
 
 	_, err := k8sClientSet.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
@@ -97,75 +103,81 @@ func createNamespace(ctx context.Context, k8sClientSet *kubernetes.Clientset, na
 			return xerrors.Errorf("%w: %w", errFailedToCreateNameSpace, err)
 		}
 		log.Println("[WARN] The namespace already exists")
-	} else {
-		log.Println("[INFO] Namespace is created successfully")
+		return updateIstioLabels(ctx, k8sClientSet, namespaceName, istioLabels)
 	}
+	log.Println("[INFO] Namespace is created successfully")
 	return nil
 }
 
-func crateDeployment(ctx context.Context, awsAccountID string, awsConfig aws.Config, k8sClientSet *kubernetes.Clientset, namespaceName, resourceName string, istioMode, isTest bool) error {
-	// Prism image
-	prismImage := fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com/%s", awsAccountID, awsConfig.Region, resourceName)
-	if isTest {
-		prismImage = localPrismImage
+// updateIstioLabels replaces the Istio labels of an existing namespace, e.g. created with another istioMode or dataplane,
+// so that the pods of the mock get the sidecar or join the ambient mesh as configured.
+// The ownership labels are not added, so that a namespace not created by the mock is not deleted with it.
+func updateIstioLabels(ctx context.Context, k8sClientSet kubernetes.Interface, namespaceName string, labels map[string]string) error {
+	namespace, err := k8sClientSet.CoreV1().Namespaces().Get(ctx, namespaceName, metav1.GetOptions{})
+	if err != nil {
+		return xerrors.Errorf("%w: %w", errFailedToGetNameSpace, err)
+	}
+	if namespace.Labels == nil {
+		namespace.Labels = map[string]string{}
+	}
+	changed := false
+	for _, key := range istioLabelKeys {
+		value, found := namespace.Labels[key]
+		if found && value != labels[key] {
+			delete(namespace.Labels, key)
+			changed = true
+		}
+	}
+	for key, value := range labels {
+		if namespace.Labels[key] != value {
+			namespace.Labels[key] = value
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
 	}
 
-	// Deployment
-	deployment := &appsv1.Deployment{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: resourceName,
-		},
-		Spec: appsv1.DeploymentSpec{
-			Replicas: util.Int32Ptr(1),
-			Selector: &metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					"app": resourceName,
-				},
-			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						"app": resourceName,
-					},
-					Annotations: map[string]string{},
-				},
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{
-						{
-							Name:  resourceName,
-							Image: prismImage,
-							Ports: []corev1.ContainerPort{
-								{
-									ContainerPort: int32(params.PrismPort),
-								},
-							},
-							Resources: corev1.ResourceRequirements{
-								Limits: corev1.ResourceList{
-									corev1.ResourceCPU:    resource.MustParse(params.PrismCPU),
-									corev1.ResourceMemory: resource.MustParse(params.PrismMemory),
-								},
-							},
-						},
-					},
-					PriorityClassName: params.PriorityClassName,
-				},
-			},
-		},
+	if _, err := k8sClientSet.CoreV1().Namespaces().Update(ctx, namespace, metav1.UpdateOptions{}); err != nil {
+		return xerrors.Errorf("%w: %w", errFailedToUpdateNameSpace, err)
 	}
+	log.Println("[INFO] The Istio labels of the namespace are updated")
+	return nil
+}
 
-	if isTest {
-		// to get image from local
-		deployment.Spec.Template.Spec.Containers[0].ImagePullPolicy = corev1.PullNever
+func createSpecConfigMap(ctx context.Context, k8sClientSet kubernetes.Interface, config *params.Config, namespaceName, resourceName, openAPI string) error {
+	configMap := NewSpecConfigMap(config, namespaceName, resourceName, openAPI)
+	_, err := k8sClientSet.CoreV1().ConfigMaps(namespaceName).Create(ctx, configMap, metav1.CreateOptions{})
+	if err != nil {
+		if !errors.IsAlreadyExists(err) {
+			return xerrors.Errorf("%w: %w", errFailedToCreateSpecConfigMap, err)
+		}
+		log.Println("[WARN] The spec configmap already exists")
+	} else {
+		log.Println("[INFO] Spec configmap is created successfully")
 	}
+	return nil
+}
 
-	if istioMode {
-		deployment.Spec.Template.ObjectMeta.Annotations["sidecar.istio.io/inject"] = "true"
-		deployment.Spec.Template.ObjectMeta.Annotations["sidecar.istio.io/proxyCPULimit"] = params.IstioProxyCPU
-		deployment.Spec.Template.ObjectMeta.Annotations["sidecar.istio.io/proxyMemoryLimit"] = params.IstioProxyMemory
-		deployment.Spec.Template.ObjectMeta.Annotations["traffic.sidecar.istio.io/includeOutboundIPRanges"] = "*"
-		deployment.Spec.Template.ObjectMeta.Annotations["proxy.istio.io/config"] = `{ "terminationDrainDuration": "30s" }`
+func createFaultProxyConfigMap(ctx context.Context, k8sClientSet kubernetes.Interface, config *params.Config, namespaceName, resourceName string) error {
+	configMap, err := NewFaultProxyConfigMap(config, namespaceName, resourceName)
+	if err != nil {
+		return err
+	}
+	_, err = k8sClientSet.CoreV1().ConfigMaps(namespaceName).Create(ctx, configMap, metav1.CreateOptions{})
+	if err != nil {
+		if !errors.IsAlreadyExists(err) {
+			return xerrors.Errorf("%w: %w", errFailedToCreateFaultProxy, err)
+		}
+		log.Println("[WARN] The fault proxy configmap already exists")
+	} else {
+		log.Println("[INFO] Fault proxy configmap is created successfully")
 	}
+	return nil
+}
 
+func crateDeployment(ctx context.Context, k8sClientSet kubernetes.Interface, config *params.Config, namespaceName, resourceName string, options DeploymentOptions) error {
+	deployment := NewDeployment(config, namespaceName, resourceName, options)
 	_, err := k8sClientSet.AppsV1().Deployments(namespaceName).Create(ctx, deployment, metav1.CreateOptions{})
 	if err != nil {
 		if !errors.IsAlreadyExists(err) {
@@ -178,25 +190,8 @@ func crateDeployment(ctx context.Context, awsAccountID string, awsConfig aws.Con
 	return nil
 }
 
-func createService(ctx context.Context, k8sClientSet *kubernetes.Clientset, namespaceName, resourceName string) error {
-	service := &corev1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: resourceName,
-		},
-		Spec: corev1.ServiceSpec{
-			Selector: map[string]string{
-				"app": resourceName,
-			},
-			Ports: []corev1.ServicePort{
-				{
-					Protocol:   corev1.ProtocolTCP,
-					Port:       servicePort,
-					TargetPort: intstr.FromInt(servicePort),
-				},
-			},
-			Type: corev1.ServiceTypeClusterIP,
-		},
-	}
+func createService(ctx context.Context, k8sClientSet kubernetes.Interface, config *params.Config, namespaceName, resourceName string) error {
+	service := NewService(config, namespaceName, resourceName)
 	_, err := k8sClientSet.CoreV1().Services(namespaceName).Create(ctx, service, metav1.CreateOptions{})
 	if err != nil {
 		if !errors.IsAlreadyExists(err) {
@@ -209,14 +204,11 @@ func createService(ctx context.Context, k8sClientSet *kubernetes.Clientset, name
 	return nil
 }
 
-func DeleteK8sResources(ctx context.Context, kubeconfig *restclient.Config, namespaceName, resourceName string) error {
-	k8sClientSet, err := kubernetes.NewForConfig(kubeconfig)
-	if err != nil {
-		return xerrors.Errorf("%w: %w", errFailedToCreateClientSet, err)
-	}
-	log.Println("[INFO] Clientset of k8s set up successfully")
-
-	err = deleteService(ctx, k8sClientSet, namespaceName, resourceName)
+// DeleteK8sResources deletes the k8s resources of the mock and its namespace.
+// The namespace is deleted only if it has the ownership labels, or if its name ends with legacySuffix, i.e. of a mock created before the labels.
+// Pass an empty legacySuffix to delete only the labeled namespace.
+func DeleteK8sResources(ctx context.Context, k8sClientSet kubernetes.Interface, namespaceName, resourceName, legacySuffix string) error {
+	err := deleteService(ctx, k8sClientSet, namespaceName, resourceName)
 	if err != nil {
 		return xerrors.Errorf("%w: %w", errFailedToDeleteService, err)
 	}
@@ -226,7 +218,17 @@ func DeleteK8sResources(ctx context.Context, kubeconfig *restclient.Config, name
 		return xerrors.Errorf("%w: %w", errFailedToDeleteDeployment, err)
 	}
 
-	err = deleteNamespace(ctx, k8sClientSet, namespaceName)
+	err = deleteSpecConfigMap(ctx, k8sClientSet, namespaceName, resourceName)
+	if err != nil {
+		return xerrors.Errorf("%w: %w", errFailedToDeleteSpecConfigMap, err)
+	}
+
+	err = deleteFaultProxyConfigMap(ctx, k8sClientSet, namespaceName, resourceName)
+	if err != nil {
+		return xerrors.Errorf("%w: %w", errFailedToDeleteFaultProxy, err)
+	}
+
+	err = deleteNamespace(ctx, k8sClientSet, namespaceName, legacySuffix)
 	if err != nil {
 		return xerrors.Errorf("%w: %w", errFailedToDeleteNameSpace, err)
 	}
@@ -234,7 +236,7 @@ func DeleteK8sResources(ctx context.Context, kubeconfig *restclient.Config, name
 	return nil
 }
 
-func deleteService(ctx context.Context, k8sClientSet *kubernetes.Clientset, namespaceName, resourceName string) error {
+func deleteService(ctx context.Context, k8sClientSet kubernetes.Interface, namespaceName, resourceName string) error {
 	err := k8sClientSet.CoreV1().Services(namespaceName).Delete(ctx, resourceName, metav1.DeleteOptions{})
 	if err != nil {
 		if !errors.IsNotFound(err) {
@@ -247,7 +249,7 @@ func deleteService(ctx context.Context, k8sClientSet *kubernetes.Clientset, name
 	return nil
 }
 
-func deleteDeployment(ctx context.Context, k8sClientSet *kubernetes.Clientset, namespaceName, resourceName string) error {
+func deleteDeployment(ctx context.Context, k8sClientSet kubernetes.Interface, namespaceName, resourceName string) error {
 	err := k8sClientSet.AppsV1().Deployments(namespaceName).Delete(ctx, resourceName, metav1.DeleteOptions{})
 	if err != nil {
 		if !errors.IsNotFound(err) {
@@ -260,73 +262,88 @@ func deleteDeployment(ctx context.Context, k8sClientSet *kubernetes.Clientset, n
 	return nil
 }
 
-func deleteNamespace(ctx context.Context, k8sClientSet *kubernetes.Clientset, namespaceName string) error {
-	err := k8sClientSet.CoreV1().Namespaces().Delete(ctx, namespaceName, metav1.DeleteOptions{})
+func deleteSpecConfigMap(ctx context.Context, k8sClientSet kubernetes.Interface, namespaceName, resourceName string) error {
+	err := k8sClientSet.CoreV1().ConfigMaps(namespaceName).Delete(ctx, SpecConfigMapName(resourceName), metav1.DeleteOptions{})
 	if err != nil {
 		if !errors.IsNotFound(err) {
-			return xerrors.Errorf("%w: %w", errFailedToDeleteNameSpace, err)
+			return xerrors.Errorf("%w: %w", errFailedToDeleteSpecConfigMap, err)
 		}
-		log.Println("[WARN] The Namespace is not found")
+		// the OpenAPI definition is in the image
+		log.Println("[INFO] The spec configmap is not found")
 	} else {
-		log.Println("[INFO] Namespace is deleted successfully")
+		log.Println("[INFO] Spec configmap is deleted successfully")
 	}
 	return nil
 }
 
-func parseVersion(version string) ([]int, error) {
-	versions := 3
-
-	// convert "x-y-z" to [x, y, z]
-	parts := strings.Split(version, "-")
-	if len(parts) != versions {
-		return nil, xerrors.Errorf("invalid version format: %s", version)
+// FaultProxyRoutes returns the routes of the fault proxy in its ConfigMap.
+func FaultProxyRoutes(ctx context.Context, k8sClientSet kubernetes.Interface, namespaceName, resourceName string) (string, error) {
+	configMap, err := k8sClientSet.CoreV1().ConfigMaps(namespaceName).Get(ctx, FaultProxyConfigMapName(resourceName), metav1.GetOptions{})
+	if err != nil {
+		return "", xerrors.Errorf("%w: %w", errFailedToGetFaultProxy, err)
 	}
+	return configMap.Data[faultproxy.RoutesKey], nil
+}
 
-	intParts := make([]int, len(parts))
-	for i, part := range parts {
-		num, err := strconv.Atoi(part)
+// SetFaultProxyRoutes replaces the routes in the ConfigMap of the fault proxy, which reloads them once the kubelet syncs the mounted file.
+func SetFaultProxyRoutes(ctx context.Context, k8sClientSet kubernetes.Interface, namespaceName, resourceName, routes string) error {
+	configMaps := k8sClientSet.CoreV1().ConfigMaps(namespaceName)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := configMaps.Get(ctx, FaultProxyConfigMapName(resourceName), metav1.GetOptions{})
 		if err != nil {
-			return nil, xerrors.Errorf("invalid number in version: %s", part)
+			return err //nolint:wrapcheck // wrapped below
 		}
-		intParts[i] = num
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		configMap.Data[faultproxy.RoutesKey] = routes
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+		return err //nolint:wrapcheck // wrapped below
+	})
+	if err != nil {
+		return xerrors.Errorf("%w: %w", errFailedToUpdateFaultProxy, err)
 	}
-	return intParts, nil
+	return nil
 }
 
-func compareVersions(v1, v2 []int) int {
-	// return 1 if v1 > v2, -1 if v1 < v2, 0 if v1 == v2
-	for i := range v1 {
-		// if just one part is greater, the version is greater
-		if v1[i] > v2[i] {
-			return 1
-		} else if v1[i] < v2[i] {
-			return -1
+func deleteFaultProxyConfigMap(ctx context.Context, k8sClientSet kubernetes.Interface, namespaceName, resourceName string) error {
+	err := k8sClientSet.CoreV1().ConfigMaps(namespaceName).Delete(ctx, FaultProxyConfigMapName(resourceName), metav1.DeleteOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return xerrors.Errorf("%w: %w", errFailedToDeleteFaultProxy, err)
 		}
+		// no latency in the routes
+		return nil
 	}
-	// if all parts are equal, the versions are equal
-	return 0
+	log.Println("[INFO] Fault proxy configmap is deleted successfully")
+	return nil
 }
 
-func getLatestVersion(versions []string) string {
-	if len(versions) == 0 {
-		return ""
+// deleteNamespace deletes the namespace only if it is created by this tool, so that an existing namespace is never deleted with its other resources.
+func deleteNamespace(ctx context.Context, k8sClientSet kubernetes.Interface, namespaceName, legacySuffix string) error {
+	namespace, err := k8sClientSet.CoreV1().Namespaces().Get(ctx, namespaceName, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return xerrors.Errorf("%w: %w", errFailedToGetNameSpace, err)
+		}
+		log.Println("[WARN] The Namespace is not found")
+		return nil
+	}
+	// the same as the legacy mocks found by ListMocks
+	legacy := legacySuffix != "" && strings.HasSuffix(namespaceName, legacySuffix)
+	if namespace.Labels[ownership.ManagedByLabel] != ownership.ManagedByValue && !legacy {
+		log.Printf("[WARN] The namespace %s is kept because it has no %s=%s label", namespaceName, ownership.ManagedByLabel, ownership.ManagedByValue)
+		return nil
 	}
 
-	// init max with the zero index element
-	maxVersion := versions[0]
-	// ignore err
-	maxVersionParts, _ := parseVersion(maxVersion)
-
-	// compare all versions
-	for _, version := range versions[1:] {
-		// ignore err
-		versionParts, _ := parseVersion(version)
-
-		if compareVersions(versionParts, maxVersionParts) > 0 {
-			maxVersion = version
-			maxVersionParts = versionParts
+	err = k8sClientSet.CoreV1().Namespaces().Delete(ctx, namespaceName, metav1.DeleteOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return xerrors.Errorf("%w: %w", errFailedToDeleteNameSpace, err)
 		}
+		log.Println("[WARN] The Namespace is not found")
+	} else {
+		log.Println("[INFO] Namespace is deleted successfully")
 	}
-
-	return maxVersion
+	return nil
 }
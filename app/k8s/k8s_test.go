@@ -3,77 +3,410 @@ package k8s_test
 import (
 	"context"
 	"testing"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/gold-kou/prism-in-k8s/app/faultproxy"
 	"github.com/gold-kou/prism-in-k8s/app/k8s"
-	"github.com/gold-kou/prism-in-k8s/app/testutil"
-	"github.com/google/uuid"
+	"github.com/gold-kou/prism-in-k8s/app/ownership"
+	"github.com/gold-kou/prism-in-k8s/app/params"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
+const (
+	testNamespaceName = "test-namespace"
+	testResourceName  = "test-resource"
+	testImage         = "test-image"
+	testOpenAPI       = "openapi: 3.0.0\n"
+)
+
+func newConfig(istioMode bool) *params.Config {
+	config := &params.Config{
+		MicroserviceName:      "test",
+		MicroserviceNamespace: "test",
+		IstioMode:             istioMode,
+	}
+	config.SetDefaults()
+	return config
+}
+
+func newIstiodPod(revision string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "istiod-" + revision,
+			Namespace: "istio-system",
+			Labels: map[string]string{
+				"app":          "istiod",
+				"istio.io/rev": revision,
+			},
+		},
+	}
+}
+
 func TestCreateK8sResources(t *testing.T) {
-	testNamespaceName := "test-namespace" + uuid.NewString()
-	testResourceName := "test-resource" + uuid.NewString()
-
-	dummyAWSAccountID := "123456789012"
-	ctx := context.TODO()
-	awsConfig, err := config.LoadDefaultConfig(ctx)
-	require.NoError(t, err)
-	kubeconfigPath := clientcmd.NewDefaultPathOptions().GetDefaultFilename()
-	kubeconfig, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
-	require.NoError(t, err)
-
-	// test target
-	err = k8s.CreateK8sResources(ctx, dummyAWSAccountID, awsConfig, kubeconfig, testNamespaceName, testResourceName, true, true)
-	require.NoError(t, err)
-
-	// verify
-	k8sClientSet, err := kubernetes.NewForConfig(kubeconfig)
-	require.NoError(t, err)
-	_, err = k8sClientSet.CoreV1().Namespaces().Get(ctx, testNamespaceName, metav1.GetOptions{})
-	assert.NoError(t, err)
-	_, err = k8sClientSet.AppsV1().Deployments(testNamespaceName).Get(ctx, testResourceName, metav1.GetOptions{})
-	assert.NoError(t, err)
-	err = testutil.WaitForPodRunning(ctx, k8sClientSet, testNamespaceName, testResourceName)
-	require.NoError(t, err)
-	_, err = k8sClientSet.CoreV1().Services(testNamespaceName).Get(ctx, testResourceName, metav1.GetOptions{})
-	assert.NoError(t, err)
-
-	// clean up
-	err = testutil.DeleteService(ctx, k8sClientSet, testNamespaceName, testResourceName)
-	require.NoError(t, err)
-	err = testutil.DeleteDeployment(ctx, k8sClientSet, testNamespaceName, testResourceName)
-	require.NoError(t, err)
-	err = testutil.DeleteNamespace(ctx, k8sClientSet, testNamespaceName)
-	require.NoError(t, err)
+	tests := []struct {
+		name         string
+		existing     []runtime.Object
+		istioMode    bool
+		options      k8s.DeploymentOptions
+		wantRevision string
+		// empty if the existing deployment is kept
+		wantImage string
+	}{
+		{
+			name:      "create all",
+			options:   k8s.DeploymentOptions{Image: testImage},
+			wantImage: testImage,
+		},
+		{
+			name: "already exists",
+			existing: []runtime.Object{
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespaceName}},
+				&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespaceName, Name: testResourceName}},
+				&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespaceName, Name: testResourceName}},
+			},
+			options: k8s.DeploymentOptions{Image: testImage},
+		},
+		{
+			name:      "openapi",
+			options:   k8s.DeploymentOptions{OpenAPI: testOpenAPI},
+			wantImage: k8s.PrismImage,
+		},
+		{
+			name:      "latest istiod revision",
+			istioMode: true,
+			existing: []runtime.Object{
+				newIstiodPod("1-21-0"),
+				newIstiodPod("1-22-3"),
+				newIstiodPod("1-9-10"),
+			},
+			options:      k8s.DeploymentOptions{Image: testImage},
+			wantRevision: "1-22-3",
+			wantImage:    testImage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			k8sClientSet := fake.NewSimpleClientset(tt.existing...)
+			tt.options.Owner = ownership.Owner{Creator: "tester"}
+
+			// test target
+			err := k8s.CreateK8sResources(ctx, k8sClientSet, newConfig(tt.istioMode), testNamespaceName, testResourceName, tt.options)
+			require.NoError(t, err)
+
+			// verify
+			namespace, err := k8sClientSet.CoreV1().Namespaces().Get(ctx, testNamespaceName, metav1.GetOptions{})
+			require.NoError(t, err)
+			if tt.istioMode {
+				assert.Equal(t, tt.wantRevision, namespace.Labels["istio.io/rev"])
+			}
+			deployment, err := k8sClientSet.AppsV1().Deployments(testNamespaceName).Get(ctx, testResourceName, metav1.GetOptions{})
+			require.NoError(t, err)
+			if tt.wantImage != "" {
+				assert.Equal(t, tt.wantImage, deployment.Spec.Template.Spec.Containers[0].Image)
+			} else {
+				assert.Empty(t, deployment.Spec.Template.Spec.Containers)
+			}
+			_, err = k8sClientSet.CoreV1().Services(testNamespaceName).Get(ctx, testResourceName, metav1.GetOptions{})
+			require.NoError(t, err)
+			configMap, err := k8sClientSet.CoreV1().ConfigMaps(testNamespaceName).Get(ctx, k8s.SpecConfigMapName(testResourceName), metav1.GetOptions{})
+			if tt.options.OpenAPI != "" {
+				require.NoError(t, err)
+				assert.Equal(t, tt.options.OpenAPI, configMap.Data[k8s.SpecConfigMapKey])
+			} else {
+				assert.True(t, apierrors.IsNotFound(err))
+			}
+		})
+	}
+}
+
+func newRevisionTag(tag, revision string) *admissionregistrationv1.MutatingWebhookConfiguration {
+	return &admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "istio-revision-tag-" + tag,
+			Labels: map[string]string{
+				"istio.io/tag": tag,
+				"istio.io/rev": revision,
+			},
+		},
+	}
+}
+
+func TestCreateK8sResourcesIstioRevision(t *testing.T) {
+	tests := []struct {
+		name          string
+		existing      []runtime.Object
+		istioRevision string
+		wantLabels    map[string]string
+		wantErr       bool
+	}{
+		{
+			name:          "istioRevision",
+			existing:      []runtime.Object{newRevisionTag("prod-stable", "1-22-3"), newIstiodPod("1-22-3")},
+			istioRevision: "canary",
+			wantLabels:    map[string]string{"istio.io/rev": "canary"},
+		},
+		{
+			name:       "default revision tag",
+			existing:   []runtime.Object{newRevisionTag("prod-stable", "1-22-3"), newRevisionTag("default", "1-21-0"), newIstiodPod("1-22-3")},
+			wantLabels: map[string]string{"istio.io/rev": "default"},
+		},
+		{
+			name:       "revision tag of the latest revision",
+			existing:   []runtime.Object{newRevisionTag("prod-stable", "1-21-0"), newRevisionTag("prod-canary", "1-22-3"), newIstiodPod("1-22-3")},
+			wantLabels: map[string]string{"istio.io/rev": "prod-canary"},
+		},
+		{
+			name:       "latest revision ignoring the others",
+			existing:   []runtime.Object{newIstiodPod("1-22-3"), newIstiodPod("default"), newIstiodPod("canary"), newIstiodPod("1-9-10")},
+			wantLabels: map[string]string{"istio.io/rev": "1-22-3"},
+		},
+		{
+			name:       "only revision",
+			existing:   []runtime.Object{newIstiodPod("canary")},
+			wantLabels: map[string]string{"istio.io/rev": "canary"},
+		},
+		{
+			name:       "no revision",
+			existing:   []runtime.Object{newIstiodPod(""), newIstiodPod("default")},
+			wantLabels: map[string]string{"istio-injection": "enabled"},
+		},
+		{
+			name:     "revisions not comparable",
+			existing: []runtime.Object{newIstiodPod("canary"), newIstiodPod("stable")},
+			wantErr:  true,
+		},
+		{
+			name:    "no istiod",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			k8sClientSet := fake.NewSimpleClientset(tt.existing...)
+			config := newConfig(true)
+			config.IstioRevision = tt.istioRevision
+
+			// test target
+			err := k8s.CreateK8sResources(ctx, k8sClientSet, config, testNamespaceName, testResourceName, k8s.DeploymentOptions{Image: testImage})
+
+			// verify
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			namespace, err := k8sClientSet.CoreV1().Namespaces().Get(ctx, testNamespaceName, metav1.GetOptions{})
+			require.NoError(t, err)
+			for key, value := range tt.wantLabels {
+				assert.Equal(t, value, namespace.Labels[key])
+			}
+			assert.False(t, namespace.Labels["istio.io/rev"] != "" && namespace.Labels["istio-injection"] != "", "only one of the injection labels")
+		})
+	}
+}
+
+func TestCreateK8sResourcesAmbient(t *testing.T) {
+	tests := []struct {
+		name       string
+		istio      params.Istio
+		existing   []runtime.Object
+		wantLabels map[string]string
+	}{
+		{
+			name:  "waypoint of the mock",
+			istio: params.Istio{Dataplane: params.DataplaneAmbient},
+			wantLabels: map[string]string{
+				"istio.io/dataplane-mode": "ambient",
+				"istio.io/use-waypoint":   "waypoint",
+			},
+		},
+		{
+			name:  "existing waypoint",
+			istio: params.Istio{Dataplane: params.DataplaneAmbient, Waypoint: "shared", WaypointNamespace: "istio-waypoints"},
+			wantLabels: map[string]string{
+				"istio.io/dataplane-mode":         "ambient",
+				"istio.io/use-waypoint":           "shared",
+				"istio.io/use-waypoint-namespace": "istio-waypoints",
+			},
+		},
+		{
+			name:  "existing namespace with the sidecar injection",
+			istio: params.Istio{Dataplane: params.DataplaneAmbient},
+			existing: []runtime.Object{
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespaceName, Labels: map[string]string{"istio-injection": "enabled", "team": "test"}}},
+			},
+			wantLabels: map[string]string{
+				"istio.io/dataplane-mode": "ambient",
+				"istio.io/use-waypoint":   "waypoint",
+				// the other labels are kept
+				"team": "test",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			// no istiod is needed for the labels of ambient
+			k8sClientSet := fake.NewSimpleClientset(tt.existing...)
+			config := newConfig(true)
+			config.Istio = tt.istio
+
+			// test target
+			err := k8s.CreateK8sResources(ctx, k8sClientSet, config, testNamespaceName, testResourceName, k8s.DeploymentOptions{Image: testImage})
+
+			// verify
+			require.NoError(t, err)
+			namespace, err := k8sClientSet.CoreV1().Namespaces().Get(ctx, testNamespaceName, metav1.GetOptions{})
+			require.NoError(t, err)
+			for key, value := range tt.wantLabels {
+				assert.Equal(t, value, namespace.Labels[key])
+			}
+			assert.NotContains(t, namespace.Labels, "istio-injection")
+			if len(tt.existing) > 0 {
+				// not to delete the namespace not created by the mock
+				for key := range ownership.Labels("test") {
+					assert.NotContains(t, namespace.Labels, key)
+				}
+			}
+			deployment, err := k8sClientSet.AppsV1().Deployments(testNamespaceName).Get(ctx, testResourceName, metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.NotContains(t, deployment.Spec.Template.Annotations, "sidecar.istio.io/inject")
+		})
+	}
+}
+
+func TestCreateK8sResourcesFaultProxy(t *testing.T) {
+	tests := []struct {
+		name    string
+		options k8s.DeploymentOptions
+		wantErr bool
+	}{
+		{
+			name:    "with the fault proxy image",
+			options: k8s.DeploymentOptions{Image: testImage, FaultProxyImage: testImage + ":faultproxy"},
+		},
+		{
+			name:    "no fault proxy image",
+			options: k8s.DeploymentOptions{Image: testImage},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			k8sClientSet := fake.NewSimpleClientset()
+			config := newConfig(false)
+			config.Routes = []params.Route{
+				{Name: "users", Match: params.RouteMatch{PathPrefix: "/users"}, Latency: params.Latency{P50: 50 * time.Millisecond}},
+			}
+
+			// test target
+			err := k8s.CreateK8sResources(ctx, k8sClientSet, config, testNamespaceName, testResourceName, tt.options)
+
+			// verify
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			configMap, err := k8sClientSet.CoreV1().ConfigMaps(testNamespaceName).Get(ctx, k8s.FaultProxyConfigMapName(testResourceName), metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Contains(t, configMap.Data[faultproxy.RoutesKey], "pathPrefix: /users")
+			deployment, err := k8sClientSet.AppsV1().Deployments(testNamespaceName).Get(ctx, testResourceName, metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Len(t, deployment.Spec.Template.Spec.Containers, 2)
+			service, err := k8sClientSet.CoreV1().Services(testNamespaceName).Get(ctx, testResourceName, metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, int32(params.FaultProxyPort), service.Spec.Ports[0].TargetPort.IntVal)
+		})
+	}
 }
 
 func TestDeleteK8sResources(t *testing.T) {
-	testNamespaceName := "test-namespace" + uuid.NewString()
-	testResourceName := "test-resource" + uuid.NewString()
-
-	ctx := context.TODO()
-	kubeconfigPath := clientcmd.NewDefaultPathOptions().GetDefaultFilename()
-	kubeconfig, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
-	require.NoError(t, err)
-	k8sClientSet, err := kubernetes.NewForConfig(kubeconfig)
-	require.NoError(t, err)
-
-	// dummy resources
-	err = testutil.CreateNamespace(ctx, k8sClientSet, testNamespaceName)
-	require.NoError(t, err)
-	err = testutil.CreateDeployment(ctx, k8sClientSet, testNamespaceName, testResourceName)
-	require.NoError(t, err)
-	err = testutil.CreateService(ctx, k8sClientSet, testNamespaceName, testResourceName)
-	require.NoError(t, err)
-
-	// test target
-	err = k8s.DeleteK8sResources(ctx, kubeconfig, testNamespaceName, testResourceName)
-	assert.NoError(t, err)
-
-	// skip verify to reduce test time
+	tests := []struct {
+		name              string
+		existing          []runtime.Object
+		legacySuffix      string
+		wantNamespaceKept bool
+	}{
+		{
+			name: "delete all",
+			existing: []runtime.Object{
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespaceName, Labels: ownership.Labels("test")}},
+				&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespaceName, Name: testResourceName}},
+				&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespaceName, Name: testResourceName}},
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespaceName, Name: k8s.SpecConfigMapName(testResourceName)}},
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespaceName, Name: k8s.FaultProxyConfigMapName(testResourceName)}},
+			},
+		},
+		{
+			name: "not found",
+		},
+		{
+			name: "partially created",
+			existing: []runtime.Object{
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespaceName, Labels: ownership.Labels("test")}},
+				&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespaceName, Name: testResourceName}},
+			},
+		},
+		{
+			name: "namespace not created by this tool",
+			existing: []runtime.Object{
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespaceName}},
+				&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespaceName, Name: testResourceName}},
+			},
+			legacySuffix:      "-prism-mock",
+			wantNamespaceKept: true,
+		},
+		{
+			name: "legacy namespace by suffix",
+			existing: []runtime.Object{
+				// created before the ownership labels
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespaceName}},
+				&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespaceName, Name: testResourceName}},
+			},
+			legacySuffix: "-namespace",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			k8sClientSet := fake.NewSimpleClientset(tt.existing...)
+
+			// test target
+			err := k8s.DeleteK8sResources(ctx, k8sClientSet, testNamespaceName, testResourceName, tt.legacySuffix)
+			require.NoError(t, err)
+
+			// verify
+			_, err = k8sClientSet.CoreV1().Namespaces().Get(ctx, testNamespaceName, metav1.GetOptions{})
+			if tt.wantNamespaceKept {
+				require.NoError(t, err)
+			} else {
+				assert.True(t, apierrors.IsNotFound(err))
+			}
+			_, err = k8sClientSet.AppsV1().Deployments(testNamespaceName).Get(ctx, testResourceName, metav1.GetOptions{})
+			assert.True(t, apierrors.IsNotFound(err))
+			_, err = k8sClientSet.CoreV1().Services(testNamespaceName).Get(ctx, testResourceName, metav1.GetOptions{})
+			assert.True(t, apierrors.IsNotFound(err))
+			_, err = k8sClientSet.CoreV1().ConfigMaps(testNamespaceName).Get(ctx, k8s.SpecConfigMapName(testResourceName), metav1.GetOptions{})
+			assert.True(t, apierrors.IsNotFound(err))
+			_, err = k8sClientSet.CoreV1().ConfigMaps(testNamespaceName).Get(ctx, k8s.FaultProxyConfigMapName(testResourceName), metav1.GetOptions{})
+			assert.True(t, apierrors.IsNotFound(err))
+		})
+	}
 }
@@ -0,0 +1,129 @@
+package k8s
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/ownership"
+	"github.com/pingcap/errors"
+	"golang.org/x/xerrors"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	errFailedToListDeployments = errors.New("failed to list deployments")
+	errFailedToListNamespaces  = errors.New("failed to list namespaces")
+)
+
+// Mock is a prism mock found in the cluster.
+type Mock struct {
+	Namespace        string
+	Name             string
+	MicroserviceName string
+	CreatedAt        time.Time
+	Creator          string
+	SpecHash         string
+	Replicas         int32
+	ReadyReplicas    int32
+	Repository       string
+	// ExpiresAt is zero if the mock never expires
+	ExpiresAt time.Time
+	// Legacy is true when the mock was found only by the namespace suffix, i.e. created before ownership labels
+	Legacy bool
+}
+
+// ListMocks finds all prism mocks across all namespaces by the ownership labels.
+// If suffix is not empty, deployments in namespaces ending with it are also returned as legacy mocks.
+func ListMocks(ctx context.Context, k8sClientSet kubernetes.Interface, suffix string) ([]Mock, error) {
+	deployments, err := k8sClientSet.AppsV1().Deployments(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		LabelSelector: ownership.Selector(),
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("%w: %w", errFailedToListDeployments, err)
+	}
+
+	mocks := []Mock{}
+	found := map[string]bool{}
+	for _, deployment := range deployments.Items {
+		mocks = append(mocks, toMock(deployment, false))
+		found[deployment.Namespace+"/"+deployment.Name] = true
+	}
+
+	if suffix != "" {
+		legacyMocks, err := listLegacyMocks(ctx, k8sClientSet, suffix, found)
+		if err != nil {
+			return nil, err
+		}
+		mocks = append(mocks, legacyMocks...)
+	}
+
+	sort.Slice(mocks, func(i, j int) bool {
+		if mocks[i].Namespace != mocks[j].Namespace {
+			return mocks[i].Namespace < mocks[j].Namespace
+		}
+		return mocks[i].Name < mocks[j].Name
+	})
+	return mocks, nil
+}
+
+func listLegacyMocks(ctx context.Context, k8sClientSet kubernetes.Interface, suffix string, found map[string]bool) ([]Mock, error) {
+	namespaces, err := k8sClientSet.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, xerrors.Errorf("%w: %w", errFailedToListNamespaces, err)
+	}
+
+	mocks := []Mock{}
+	for _, namespace := range namespaces.Items {
+		if !strings.HasSuffix(namespace.Name, suffix) {
+			continue
+		}
+		deployments, err := k8sClientSet.AppsV1().Deployments(namespace.Name).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, xerrors.Errorf("%w: %w", errFailedToListDeployments, err)
+		}
+		for _, deployment := range deployments.Items {
+			// the mock deployment has the same suffix as its namespace
+			if found[deployment.Namespace+"/"+deployment.Name] || !strings.HasSuffix(deployment.Name, suffix) {
+				continue
+			}
+			mocks = append(mocks, toMock(deployment, true))
+		}
+	}
+	return mocks, nil
+}
+
+func toMock(deployment appsv1.Deployment, legacy bool) Mock {
+	mock := Mock{
+		Namespace:        deployment.Namespace,
+		Name:             deployment.Name,
+		MicroserviceName: deployment.Labels[ownership.MicroserviceLabel],
+		CreatedAt:        deployment.CreationTimestamp.Time,
+		Creator:          deployment.Annotations[ownership.CreatedByAnnotation],
+		SpecHash:         deployment.Annotations[ownership.SpecHashAnnotation],
+		ReadyReplicas:    deployment.Status.ReadyReplicas,
+		Repository:       deployment.Annotations[ownership.RepositoryAnnotation],
+		Legacy:           legacy,
+	}
+	if deployment.Spec.Replicas != nil {
+		mock.Replicas = *deployment.Spec.Replicas
+	}
+	if expiresAt, ok := deployment.Annotations[ownership.ExpiresAtAnnotation]; ok {
+		parsed, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			log.Printf("[WARN] Ignoring invalid expiry %q of %s/%s", expiresAt, deployment.Namespace, deployment.Name)
+		} else {
+			mock.ExpiresAt = parsed
+		}
+	}
+	return mock
+}
+
+// Expired reports whether the mock has an expiry which is not after now.
+func (m Mock) Expired(now time.Time) bool {
+	return !m.ExpiresAt.IsZero() && !now.Before(m.ExpiresAt)
+}
@@ -0,0 +1,145 @@
+package k8s_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/k8s"
+	"github.com/gold-kou/prism-in-k8s/app/ownership"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testSuffix = "-prism-mock"
+
+func newNamespace(name string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
+func newOwnedDeployment(namespaceName, name string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespaceName,
+			Name:      name,
+			Labels:    ownership.Labels("test"),
+		},
+	}
+}
+
+func newDeployment(namespaceName, name string) *appsv1.Deployment {
+	return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: namespaceName, Name: name}}
+}
+
+func TestListMocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []runtime.Object
+		suffix   string
+		// namespace/name of the mocks in order
+		want       []string
+		wantLegacy []string
+	}{
+		{
+			name: "by labels",
+			existing: []runtime.Object{
+				newOwnedDeployment("b"+testSuffix, "b"+testSuffix),
+				newOwnedDeployment("a"+testSuffix, "a"+testSuffix),
+				// not created by this tool
+				newDeployment("c", "c"),
+			},
+			want: []string{"a-prism-mock/a-prism-mock", "b-prism-mock/b-prism-mock"},
+		},
+		{
+			name: "legacy by suffix",
+			existing: []runtime.Object{
+				newNamespace("a" + testSuffix),
+				newDeployment("a"+testSuffix, "a"+testSuffix),
+				// the deployment without the suffix is not a mock
+				newDeployment("a"+testSuffix, "sidecar"),
+				newNamespace("c"),
+				newDeployment("c", "c"+testSuffix),
+			},
+			suffix:     testSuffix,
+			want:       []string{"a-prism-mock/a-prism-mock"},
+			wantLegacy: []string{"a-prism-mock/a-prism-mock"},
+		},
+		{
+			name: "legacy without suffix",
+			existing: []runtime.Object{
+				newNamespace("a" + testSuffix),
+				newDeployment("a"+testSuffix, "a"+testSuffix),
+			},
+			want: []string{},
+		},
+		{
+			name: "labeled mock is not duplicated as legacy",
+			existing: []runtime.Object{
+				newNamespace("a" + testSuffix),
+				newOwnedDeployment("a"+testSuffix, "a"+testSuffix),
+				newNamespace("b" + testSuffix),
+				newDeployment("b"+testSuffix, "b"+testSuffix),
+			},
+			suffix:     testSuffix,
+			want:       []string{"a-prism-mock/a-prism-mock", "b-prism-mock/b-prism-mock"},
+			wantLegacy: []string{"b-prism-mock/b-prism-mock"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k8sClientSet := fake.NewSimpleClientset(tt.existing...)
+
+			// test target
+			mocks, err := k8s.ListMocks(context.TODO(), k8sClientSet, tt.suffix)
+			require.NoError(t, err)
+
+			// verify
+			got := []string{}
+			gotLegacy := []string{}
+			for _, mock := range mocks {
+				got = append(got, mock.Namespace+"/"+mock.Name)
+				if mock.Legacy {
+					gotLegacy = append(gotLegacy, mock.Namespace+"/"+mock.Name)
+				}
+			}
+			assert.Equal(t, tt.want, got)
+			assert.ElementsMatch(t, tt.wantLegacy, gotLegacy)
+		})
+	}
+}
+
+// TestListMocksOwner verifies the ownership annotations of NewDeployment, including the expiry, are read back by ListMocks.
+func TestListMocksOwner(t *testing.T) {
+	expiresAt := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	config := newConfig(false)
+	deployment := k8s.NewDeployment(config, testNamespaceName, testResourceName, k8s.DeploymentOptions{
+		Image: testImage,
+		Owner: ownership.Owner{
+			Creator:    "tester",
+			SpecHash:   "hash",
+			Repository: testResourceName,
+			ExpiresAt:  expiresAt,
+		},
+	})
+	k8sClientSet := fake.NewSimpleClientset(deployment)
+
+	// test target
+	mocks, err := k8s.ListMocks(context.TODO(), k8sClientSet, "")
+	require.NoError(t, err)
+
+	// verify
+	require.Len(t, mocks, 1)
+	assert.Equal(t, "test", mocks[0].MicroserviceName)
+	assert.Equal(t, "tester", mocks[0].Creator)
+	assert.Equal(t, "hash", mocks[0].SpecHash)
+	assert.Equal(t, testResourceName, mocks[0].Repository)
+	assert.True(t, expiresAt.Equal(mocks[0].ExpiresAt))
+	assert.False(t, mocks[0].Expired(expiresAt.Add(-time.Second)))
+	assert.True(t, mocks[0].Expired(expiresAt))
+}
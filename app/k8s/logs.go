@@ -0,0 +1,121 @@
+package k8s
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	errNoPod            = errors.New("no pod found")
+	errFailedToGetLogs  = errors.New("failed to get logs")
+	errFailedToReadLogs = errors.New("failed to read logs")
+)
+
+// LogLine is a line of the Prism container logs.
+type LogLine struct {
+	Pod  string
+	Time time.Time
+	Text string
+}
+
+// LogOptions are the options to get the logs of the mock pods.
+type LogOptions struct {
+	Follow bool
+	// Since is zero to get all logs
+	Since time.Duration
+	// SinceTime is used instead of Since if it is not zero
+	SinceTime time.Time
+	// FaultProxy is true to get the logs of the fault proxy containers instead of Prism
+	FaultProxy bool
+}
+
+// StreamLogs sends the log lines of the Prism or fault proxy containers of all the mock pods to lines until the logs end or the context is canceled.
+// The lines of a pod are in order, but the lines of different pods are interleaved.
+func StreamLogs(ctx context.Context, k8sClientSet kubernetes.Interface, namespaceName, resourceName string, options LogOptions, lines chan<- LogLine) error {
+	podList, err := k8sClientSet.CoreV1().Pods(namespaceName).List(ctx, metav1.ListOptions{
+		LabelSelector: "app=" + resourceName,
+	})
+	if err != nil {
+		return xerrors.Errorf("%w: %w", errFailedToListPods, err)
+	}
+	if len(podList.Items) == 0 {
+		return xerrors.Errorf("%w: %s/%s", errNoPod, namespaceName, resourceName)
+	}
+
+	logOptions := &corev1.PodLogOptions{
+		// not the Istio sidecar
+		Container:  resourceName,
+		Follow:     options.Follow,
+		Timestamps: true,
+	}
+	if options.FaultProxy {
+		logOptions.Container = faultProxyContainerName
+	}
+	if !options.SinceTime.IsZero() {
+		sinceTime := metav1.NewTime(options.SinceTime)
+		logOptions.SinceTime = &sinceTime
+	} else if options.Since > 0 {
+		sinceSeconds := int64(options.Since.Seconds())
+		logOptions.SinceSeconds = &sinceSeconds
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(podList.Items))
+	for _, pod := range podList.Items {
+		wg.Add(1)
+		go func(podName string) {
+			defer wg.Done()
+			errCh <- streamPodLogs(ctx, k8sClientSet, namespaceName, podName, logOptions, lines)
+		}(pod.Name)
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func streamPodLogs(ctx context.Context, k8sClientSet kubernetes.Interface, namespaceName, podName string, logOptions *corev1.PodLogOptions, lines chan<- LogLine) error {
+	stream, err := k8sClientSet.CoreV1().Pods(namespaceName).GetLogs(podName, logOptions).Stream(ctx)
+	if err != nil {
+		return xerrors.Errorf("%w: %s: %w", errFailedToGetLogs, podName, err)
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		lines <- parseLogLine(podName, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return xerrors.Errorf("%w: %s: %w", errFailedToReadLogs, podName, err)
+	}
+	return nil
+}
+
+// parseLogLine splits the timestamp added by the kubelet.
+func parseLogLine(podName, text string) LogLine {
+	line := LogLine{Pod: podName, Text: text}
+	timestamp, rest, found := strings.Cut(text, " ")
+	if !found {
+		return line
+	}
+	at, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return line
+	}
+	line.Time = at
+	line.Text = rest
+	return line
+}
@@ -0,0 +1,90 @@
+package k8s_test
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/gold-kou/prism-in-k8s/app/k8s"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newMockPod(name string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespaceName,
+			Labels:    map[string]string{"app": testResourceName},
+		},
+	}
+}
+
+func TestStreamLogs(t *testing.T) {
+	ctx := context.TODO()
+	k8sClientSet := fake.NewSimpleClientset(newMockPod("pod-1"), newMockPod("pod-2"))
+	lines := make(chan k8s.LogLine, 10)
+
+	// test target
+	err := k8s.StreamLogs(ctx, k8sClientSet, testNamespaceName, testResourceName, k8s.LogOptions{}, lines)
+	require.NoError(t, err)
+	close(lines)
+
+	// verify
+	pods := []string{}
+	for line := range lines {
+		// the fake clientset always returns "fake logs" without the timestamp
+		assert.Equal(t, "fake logs", line.Text)
+		assert.True(t, line.Time.IsZero())
+		pods = append(pods, line.Pod)
+	}
+	sort.Strings(pods)
+	assert.Equal(t, []string{"pod-1", "pod-2"}, pods)
+}
+
+func TestStreamLogsContainer(t *testing.T) {
+	tests := []struct {
+		name       string
+		faultProxy bool
+		want       string
+	}{
+		{name: "prism", want: testResourceName},
+		{name: "fault proxy", faultProxy: true, want: "faultproxy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k8sClientSet := fake.NewSimpleClientset(newMockPod("pod-1"))
+			lines := make(chan k8s.LogLine, 10)
+
+			// test target
+			err := k8s.StreamLogs(context.TODO(), k8sClientSet, testNamespaceName, testResourceName, k8s.LogOptions{FaultProxy: tt.faultProxy}, lines)
+
+			// verify
+			require.NoError(t, err)
+			containers := []string{}
+			for _, action := range k8sClientSet.Actions() {
+				if action.GetSubresource() == "log" {
+					logOptions, ok := action.(k8stesting.GenericAction).GetValue().(*corev1.PodLogOptions)
+					require.True(t, ok)
+					containers = append(containers, logOptions.Container)
+				}
+			}
+			assert.Equal(t, []string{tt.want}, containers)
+		})
+	}
+}
+
+func TestStreamLogsNoPod(t *testing.T) {
+	lines := make(chan k8s.LogLine, 10)
+
+	// test target
+	err := k8s.StreamLogs(context.TODO(), fake.NewSimpleClientset(), testNamespaceName, testResourceName, k8s.LogOptions{}, lines)
+
+	// verify
+	require.Error(t, err)
+}
@@ -0,0 +1,80 @@
+package k8s
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/pingcap/errors"
+	"golang.org/x/xerrors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+var (
+	errNoRunningPod        = errors.New("no running pod found")
+	errFailedToPortForward = errors.New("failed to port-forward")
+)
+
+// PortForward forwards the local port to the port of a running mock pod until stopCh is closed. A random port is used if localPort is 0.
+// It returns the local port and a channel receiving the error when the forwarding stops, e.g. by the restart of the pod.
+func PortForward(ctx context.Context, kubeconfig *restclient.Config, k8sClientSet kubernetes.Interface, namespaceName, resourceName string, localPort, port int, stopCh <-chan struct{}) (int, <-chan error, error) {
+	podList, err := k8sClientSet.CoreV1().Pods(namespaceName).List(ctx, metav1.ListOptions{
+		LabelSelector: "app=" + resourceName,
+	})
+	if err != nil {
+		return 0, nil, xerrors.Errorf("%w: %w", errFailedToListPods, err)
+	}
+	podName := ""
+	for _, pod := range podList.Items {
+		if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil {
+			podName = pod.Name
+			break
+		}
+	}
+	if podName == "" {
+		return 0, nil, xerrors.Errorf("%w: %s/%s", errNoRunningPod, namespaceName, resourceName)
+	}
+
+	transport, upgrader, err := spdy.RoundTripperFor(kubeconfig)
+	if err != nil {
+		return 0, nil, xerrors.Errorf("%w: %w", errFailedToPortForward, err)
+	}
+	serverURL, err := url.Parse(kubeconfig.Host)
+	if err != nil {
+		return 0, nil, xerrors.Errorf("%w: %w", errFailedToPortForward, err)
+	}
+	serverURL.Path = path.Join(serverURL.Path, "api", "v1", "namespaces", namespaceName, "pods", podName, "portforward")
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, serverURL)
+
+	readyCh := make(chan struct{})
+	forwarder, err := portforward.New(dialer, []string{strconv.Itoa(localPort) + ":" + strconv.Itoa(port)}, stopCh, readyCh, io.Discard, io.Discard)
+	if err != nil {
+		return 0, nil, xerrors.Errorf("%w: %w", errFailedToPortForward, err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- forwarder.ForwardPorts()
+	}()
+
+	select {
+	case <-readyCh:
+	case err := <-errCh:
+		return 0, nil, xerrors.Errorf("%w: %w", errFailedToPortForward, err)
+	case <-ctx.Done():
+		return 0, nil, xerrors.Errorf("%w: %w", errFailedToPortForward, ctx.Err())
+	}
+
+	ports, err := forwarder.GetPorts()
+	if err != nil {
+		return 0, nil, xerrors.Errorf("%w: %w", errFailedToPortForward, err)
+	}
+	return int(ports[0].Local), errCh, nil
+}
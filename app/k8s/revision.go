@@ -0,0 +1,210 @@
+package k8s
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/pingcap/errors"
+	"golang.org/x/xerrors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	istioNamespace = "istio-system"
+	// revisionLabel selects the sidecar injector of a revision or a revision tag
+	revisionLabel = "istio.io/rev"
+	// tagLabel is the tag name of the MutatingWebhookConfiguration istio-revision-tag-<tag>
+	tagLabel             = "istio.io/tag"
+	revisionTagPrefix    = "istio-revision-tag-"
+	defaultRevision      = "default"
+	injectionLabel       = "istio-injection"
+	injectionLabelEnable = "enabled"
+	// the labels of the ambient mode
+	dataplaneModeLabel        = "istio.io/dataplane-mode"
+	useWaypointLabel          = "istio.io/use-waypoint"
+	useWaypointNamespaceLabel = "istio.io/use-waypoint-namespace"
+)
+
+// istioLabelKeys are the namespace labels set by injectionLabels.
+var istioLabelKeys = []string{revisionLabel, injectionLabel, dataplaneModeLabel, useWaypointLabel, useWaypointNamespaceLabel}
+
+var (
+	errFailedToListWebhooks = errors.New("failed to list MutatingWebhookConfigurations")
+	errNoIstiod             = errors.New("istiod is not found in " + istioNamespace + ", install Istio or set istioMode to false")
+	errAmbiguousRevision    = errors.New("failed to choose the Istio revision, set istioRevision")
+)
+
+// injectionLabels returns the namespace labels for the ambient mode, or for the sidecar injection resolved in the following order:
+//   - istioRevision of the parameters
+//   - the revision tags, "default" first, which keep working when istiod is upgraded
+//   - the latest revision of the istiod pods
+//   - istio-injection=enabled for istiod without a revision
+func injectionLabels(ctx context.Context, k8sClientSet kubernetes.Interface, config *params.Config) (map[string]string, error) {
+	if config.Ambient() {
+		return ambientLabels(config), nil
+	}
+	if config.IstioRevision != "" {
+		return map[string]string{revisionLabel: config.IstioRevision}, nil
+	}
+
+	tag, err := revisionTag(ctx, k8sClientSet)
+	if err != nil {
+		return nil, err
+	}
+	if tag != "" {
+		log.Printf("[INFO] The namespace uses the Istio revision tag %s", tag)
+		return map[string]string{revisionLabel: tag}, nil
+	}
+
+	podList, err := k8sClientSet.CoreV1().Pods(istioNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "app=istiod",
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("%w: %w", errFailedToListPods, err)
+	}
+	if len(podList.Items) == 0 {
+		return nil, errNoIstiod
+	}
+	revisions := []string{}
+	for _, item := range podList.Items {
+		// istiod installed without a revision has no label or "default"
+		revision := item.ObjectMeta.Labels[revisionLabel]
+		if revision != "" && revision != defaultRevision && !slices.Contains(revisions, revision) {
+			revisions = append(revisions, revision)
+		}
+	}
+	if len(revisions) == 0 {
+		log.Printf("[INFO] The namespace uses %s=%s because istiod has no revision", injectionLabel, injectionLabelEnable)
+		return map[string]string{injectionLabel: injectionLabelEnable}, nil
+	}
+	revision, err := getLatestVersion(revisions)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[INFO] The namespace uses the Istio revision %s", revision)
+	return map[string]string{revisionLabel: revision}, nil
+}
+
+// ambientLabels returns the namespace labels to add the pods to the ambient mesh, with the traffic to the mock through the waypoint.
+func ambientLabels(config *params.Config) map[string]string {
+	labels := map[string]string{
+		dataplaneModeLabel: params.DataplaneAmbient,
+		useWaypointLabel:   config.WaypointName(),
+	}
+	if config.Istio.WaypointNamespace != "" {
+		labels[useWaypointNamespaceLabel] = config.Istio.WaypointNamespace
+	}
+	if config.IstioRevision != "" {
+		labels[revisionLabel] = config.IstioRevision
+	}
+	return labels
+}
+
+// revisionTag returns the revision tag of the istio-revision-tag-* MutatingWebhookConfigurations, or empty if there is none.
+// The "default" tag is preferred, then the tag of the latest revision.
+func revisionTag(ctx context.Context, k8sClientSet kubernetes.Interface) (string, error) {
+	webhookList, err := k8sClientSet.AdmissionregistrationV1().MutatingWebhookConfigurations().List(ctx, metav1.ListOptions{
+		LabelSelector: tagLabel,
+	})
+	if err != nil {
+		return "", xerrors.Errorf("%w: %w", errFailedToListWebhooks, err)
+	}
+	// revision by tag
+	tags := map[string]string{}
+	for _, item := range webhookList.Items {
+		if !strings.HasPrefix(item.Name, revisionTagPrefix) {
+			continue
+		}
+		tags[item.Labels[tagLabel]] = item.Labels[revisionLabel]
+	}
+	if len(tags) == 0 {
+		return "", nil
+	}
+	if _, ok := tags[defaultRevision]; ok {
+		return defaultRevision, nil
+	}
+
+	revisions := []string{}
+	for _, revision := range tags {
+		revisions = append(revisions, revision)
+	}
+	slices.Sort(revisions)
+	latestRevision, err := getLatestVersion(revisions)
+	if err != nil {
+		return "", err
+	}
+	// the first tag in the name order if several tags point to the latest revision
+	names := []string{}
+	for name, revision := range tags {
+		if revision == latestRevision {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names[0], nil
+}
+
+func parseVersion(version string) ([]int, error) {
+	versions := 3
+
+	// convert "x-y-z" to [x, y, z]
+	parts := strings.Split(version, "-")
+	if len(parts) != versions {
+		return nil, xerrors.Errorf("invalid version format: %s", version)
+	}
+
+	intParts := make([]int, len(parts))
+	for i, part := range parts {
+		num, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid number in version: %s", part)
+		}
+		intParts[i] = num
+	}
+	return intParts, nil
+}
+
+func compareVersions(v1, v2 []int) int {
+	// return 1 if v1 > v2, -1 if v1 < v2, 0 if v1 == v2
+	for i := range v1 {
+		// if just one part is greater, the version is greater
+		if v1[i] > v2[i] {
+			return 1
+		} else if v1[i] < v2[i] {
+			return -1
+		}
+	}
+	// if all parts are equal, the versions are equal
+	return 0
+}
+
+// getLatestVersion returns the latest of the revisions in the "x-y-z" format.
+// A revision in another format, e.g. "canary", is returned only if it is the only one, because it cannot be compared.
+func getLatestVersion(versions []string) (string, error) {
+	if len(versions) == 1 {
+		return versions[0], nil
+	}
+
+	maxVersion := ""
+	var maxVersionParts []int
+	for _, version := range versions {
+		versionParts, err := parseVersion(version)
+		if err != nil {
+			log.Printf("[WARN] The Istio revision %s is ignored: %v", version, err)
+			continue
+		}
+		if maxVersionParts == nil || compareVersions(versionParts, maxVersionParts) > 0 {
+			maxVersion = version
+			maxVersionParts = versionParts
+		}
+	}
+	if maxVersion == "" {
+		return "", xerrors.Errorf("%w: %s", errAmbiguousRevision, strings.Join(versions, ", "))
+	}
+	return maxVersion, nil
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/k8s"
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/gold-kou/prism-in-k8s/app/registry"
+	"golang.org/x/xerrors"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+const shortSpecHashLength = 12
+
+func listMocks(ctx context.Context, out io.Writer, config *params.Config) error {
+	mocks, err := k8s.ListMocks(ctx, k8sClientSet, config.PrismMockSuffix)
+	if err != nil {
+		return xerrors.Errorf("failed to list mocks: %w", err)
+	}
+
+	writer := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0) //nolint:mnd // padding between columns
+	fmt.Fprintln(writer, "NAMESPACE\tNAME\tAGE\tEXPIRES\tCREATOR\tSPEC HASH\tREPLICAS\tREPOSITORY")
+	for _, mock := range mocks {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%d/%d\t%s\n",
+			mock.Namespace,
+			mock.Name,
+			age(mock.CreatedAt),
+			expires(mock.ExpiresAt),
+			orNone(mock.Creator),
+			orNone(shortHash(mock.SpecHash)),
+			mock.ReadyReplicas,
+			mock.Replicas,
+			orNone(mock.Repository),
+		)
+	}
+	if err := writer.Flush(); err != nil {
+		return xerrors.Errorf("failed to write mocks: %w", err)
+	}
+
+	if !includeOrphans {
+		return nil
+	}
+	if isTest {
+		return xerrors.New("orphaned repositories cannot be listed in test mode")
+	}
+
+	repositories, err := registry.ListRepositories(ctx, ecrClient)
+	if err != nil {
+		return xerrors.Errorf("failed to list repositories: %w", err)
+	}
+	inUse := []string{}
+	for _, mock := range mocks {
+		inUse = append(inUse, mock.Repository)
+	}
+
+	fmt.Fprintln(out)
+	writer = tabwriter.NewWriter(out, 0, 0, 3, ' ', 0) //nolint:mnd // padding between columns
+	fmt.Fprintln(writer, "ORPHANED REPOSITORY\tAGE")
+	for _, repository := range registry.Orphans(repositories, inUse) {
+		fmt.Fprintf(writer, "%s\t%s\n", repository.Name, age(repository.CreatedAt))
+	}
+	if err := writer.Flush(); err != nil {
+		return xerrors.Errorf("failed to write repositories: %w", err)
+	}
+	return nil
+}
+
+func age(createdAt time.Time) string {
+	if createdAt.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(time.Since(createdAt))
+}
+
+func expires(expiresAt time.Time) string {
+	if expiresAt.IsZero() {
+		return "<never>"
+	}
+	remaining := time.Until(expiresAt)
+	if remaining <= 0 {
+		return "expired"
+	}
+	return "in " + duration.HumanDuration(remaining)
+}
+
+func shortHash(hash string) string {
+	if len(hash) > shortSpecHashLength {
+		return hash[:shortSpecHashLength]
+	}
+	return hash
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
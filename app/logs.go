@@ -0,0 +1,138 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/k8s"
+	"github.com/gold-kou/prism-in-k8s/app/openapi"
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/gold-kou/prism-in-k8s/app/prismlog"
+	"github.com/gold-kou/prism-in-k8s/app/report"
+	"golang.org/x/xerrors"
+)
+
+// showLogs shows the Prism logs of all the pods of the mock.
+// Without -follow, the lines of the pods are merged in time order.
+func showLogs(ctx context.Context, out io.Writer, config *params.Config) error {
+	var summary *report.Summary
+	if isSummary {
+		spec, err := loadSpec(ctx, config)
+		if err != nil {
+			return err
+		}
+		operations, err := openapi.ParseOperations(spec)
+		if err != nil {
+			return err //nolint:wrapcheck // already wrapped
+		}
+		summary = report.NewSummary(operations)
+	}
+
+	namespaceName, resourceName := config.NamespaceName(), config.ResourceName()
+	lines := make(chan k8s.LogLine)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		errCh <- k8s.StreamLogs(ctx, k8sClientSet, namespaceName, resourceName, k8s.LogOptions{Follow: isFollow, Since: since}, lines)
+	}()
+
+	parse := isParse || isSummary || pathFilter != "" || statusFilter != 0 || violationsOnly
+	assemblers := map[string]*prismlog.Assembler{}
+	show := func(request *prismlog.Request) {
+		if !matchesFilters(request) {
+			return
+		}
+		if isSummary {
+			summary.Add(request)
+			return
+		}
+		writeRequest(out, request)
+	}
+	handle := func(line k8s.LogLine) {
+		if !parse {
+			fmt.Fprintf(out, "[%s] %s\n", line.Pod, line.Text)
+			return
+		}
+		entry, ok := prismlog.ParseLine(line.Text)
+		if !ok {
+			return
+		}
+		assembler, ok := assemblers[line.Pod]
+		if !ok {
+			assembler = prismlog.NewAssembler(line.Pod)
+			assemblers[line.Pod] = assembler
+		}
+		for _, request := range assembler.Add(entry, line.Time) {
+			show(request)
+		}
+	}
+
+	if isFollow {
+		for line := range lines {
+			handle(line)
+		}
+	} else {
+		collected := []k8s.LogLine{}
+		for line := range lines {
+			collected = append(collected, line)
+		}
+		sort.SliceStable(collected, func(i, j int) bool {
+			return collected[i].Time.Before(collected[j].Time)
+		})
+		for _, line := range collected {
+			handle(line)
+		}
+	}
+	if err := <-errCh; err != nil {
+		return xerrors.Errorf("failed to get logs: %w", err)
+	}
+	// the requests without the response in the logs
+	pods := make([]string, 0, len(assemblers))
+	for pod := range assemblers {
+		pods = append(pods, pod)
+	}
+	sort.Strings(pods)
+	for _, pod := range pods {
+		for _, request := range assemblers[pod].Flush() {
+			show(request)
+		}
+	}
+
+	if isSummary {
+		return summary.Write(out) //nolint:wrapcheck // already wrapped
+	}
+	return nil
+}
+
+func matchesFilters(request *prismlog.Request) bool {
+	if pathFilter != "" && !strings.HasPrefix(request.Path, pathFilter) {
+		return false
+	}
+	if statusFilter != 0 && request.Status != statusFilter {
+		return false
+	}
+	if violationsOnly && len(request.Violations) == 0 {
+		return false
+	}
+	return true
+}
+
+func writeRequest(out io.Writer, request *prismlog.Request) {
+	status := strconv.Itoa(request.Status)
+	if request.Incomplete {
+		// the status and the violations may be missing because the lines overlapped with another request
+		status = "incomplete"
+		if request.Status != 0 {
+			status = strconv.Itoa(request.Status) + " incomplete"
+		}
+	}
+	fmt.Fprintf(out, "%s %s %s %s %s\n", request.Time.Format(time.RFC3339), request.Pod, request.Method, request.Path, status)
+	for _, violation := range request.Violations {
+		fmt.Fprintf(out, "    %s %s %s\n", violation.Level, violation.Location, violation.Message)
+	}
+}
@@ -0,0 +1,352 @@
+package openapi
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	yamlIndent = 2
+	// maxInlineDepth is a limit for circular $refs which cannot be moved to components, e.g. path items
+	maxInlineDepth = 32
+)
+
+var (
+	errFailedToBundle = errors.New("failed to bundle OpenAPI definition")
+	componentPattern  = regexp.MustCompile(`^/components/([^/]+)/([^/]+)$`)
+	definitionPattern = regexp.MustCompile(`^/definitions/([^/]+)$`)
+	// the names of components must match ^[a-zA-Z0-9\.\-_]+$
+	invalidNamePattern = regexp.MustCompile(`[^a-zA-Z0-9.\-_]`)
+)
+
+// bundler moves the targets of the external $refs into the components of the root document, and rewrites the $refs to them.
+type bundler struct {
+	ctx          context.Context //nolint:containedctx // used while walking the documents
+	rootLocation string
+	root         *yaml.Node
+	documents    map[string]*yaml.Node
+	// refs is the local $ref of each external $ref target, e.g. /path/schemas.yaml#/User
+	refs map[string]string
+	// names is the used names of each section of the components
+	names map[string]map[string]bool
+	// swagger is true if the root document is Swagger 2.0, which has the sections at the top level instead of the components
+	swagger  bool
+	changed  bool
+	problems []Problem
+}
+
+// swaggerSections are the sections of Swagger 2.0 for the sections of the components.
+var swaggerSections = map[string]string{
+	"schemas":    "definitions",
+	"parameters": "parameters",
+	"responses":  "responses",
+}
+
+func newBundler(ctx context.Context) *bundler {
+	return &bundler{
+		ctx:       ctx,
+		documents: map[string]*yaml.Node{},
+		refs:      map[string]string{},
+		names:     map[string]map[string]bool{},
+	}
+}
+
+// bundle returns the bundled document at the location, converted to OpenAPI 3.0 if it is Swagger 2.0.
+func (b *bundler) bundle(location string) ([]byte, error) {
+	content, err := read(b.ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, xerrors.Errorf("%w: %s: %w", errFailedToBundle, location, err)
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		// left for Validate to report
+		return content, nil
+	}
+
+	b.rootLocation = location
+	b.root = document.Content[0]
+	b.documents[location] = b.root
+	b.swagger = isSwagger(b.root)
+	if b.swagger {
+		if document.Content[0].Style&yaml.FlowStyle != 0 {
+			plainStyle(&document)
+		}
+		for section := range swaggerSections {
+			for _, name := range mappingKeys(b.sectionNode(section, false)) {
+				b.useName(section, name)
+			}
+		}
+	} else if components := value(b.root, "components"); components != nil && components.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(components.Content); i += 2 {
+			for _, name := range mappingKeys(components.Content[i+1]) {
+				b.useName(components.Content[i].Value, name)
+			}
+		}
+	}
+	if err := b.walk(b.root, location, []string{}, 0); err != nil {
+		return nil, err
+	}
+	if b.swagger {
+		// after bundling, so that the $refs of the other files are converted too
+		b.problems = convertSwagger(&document)
+		b.changed = true
+	}
+	if !b.changed {
+		return content, nil
+	}
+	return encode(&document)
+}
+
+// walk bundles the external $refs in the node of the document at base. keys is the path of the node, used to find the section of the components.
+func (b *bundler) walk(node *yaml.Node, base string, keys []string, depth int) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		if ref := value(node, "$ref"); ref != nil && ref.Kind == yaml.ScalarNode {
+			return b.bundleRef(node, ref, base, keys, depth)
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if err := b.walk(node.Content[i+1], base, append(keys[:len(keys):len(keys)], node.Content[i].Value), depth); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for _, child := range node.Content {
+			if err := b.walk(child, base, keys, depth); err != nil {
+				return err
+			}
+		}
+	case yaml.DocumentNode, yaml.ScalarNode, yaml.AliasNode:
+	}
+	return nil
+}
+
+func (b *bundler) bundleRef(node, ref *yaml.Node, base string, keys []string, depth int) error {
+	file, pointer, _ := strings.Cut(ref.Value, "#")
+	target := base
+	if file != "" {
+		target = resolveLocation(base, file)
+	}
+	if target == b.rootLocation {
+		if base != b.rootLocation {
+			ref.Value = "#" + pointer
+			b.changed = true
+		}
+		return nil
+	}
+
+	b.changed = true
+	key := target + "#" + pointer
+	if local, ok := b.refs[key]; ok {
+		ref.Value = local
+		return nil
+	}
+	document, err := b.document(target)
+	if err != nil {
+		return err
+	}
+	found := lookup(document, "#"+pointer)
+	if found == nil {
+		return xerrors.Errorf("%w: $ref %q in %s cannot be resolved", errFailedToBundle, ref.Value, base)
+	}
+
+	section, name := componentName(pointer, target, keys)
+	if b.swagger && swaggerSections[section] == "" {
+		section = ""
+	}
+	if section == "" {
+		// e.g. a path item, which has no section in the components of OpenAPI 3.0
+		if depth >= maxInlineDepth {
+			return xerrors.Errorf("%w: $ref %q in %s is circular", errFailedToBundle, ref.Value, base)
+		}
+		*node = *copyNode(found)
+		return b.walk(node, target, keys, depth+1)
+	}
+
+	name = b.useName(section, name)
+	local := "#/components/" + section + "/" + name
+	keys = []string{"components", section, name}
+	if b.swagger {
+		local = "#/" + swaggerSections[section] + "/" + name
+		keys = []string{swaggerSections[section], name}
+	}
+	b.refs[key] = local
+	ref.Value = local
+	component := copyNode(found)
+	sectionNode := b.sectionNode(section, true)
+	sectionNode.Content = append(sectionNode.Content, scalar(name), component)
+	return b.walk(component, target, keys, depth)
+}
+
+func (b *bundler) document(location string) (*yaml.Node, error) {
+	if document, ok := b.documents[location]; ok {
+		return document, nil
+	}
+	content, err := read(b.ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, xerrors.Errorf("%w: %s: %w", errFailedToBundle, location, err)
+	}
+	if len(document.Content) == 0 {
+		return nil, xerrors.Errorf("%w: %s is empty", errFailedToBundle, location)
+	}
+	b.documents[location] = document.Content[0]
+	return document.Content[0], nil
+}
+
+// useName returns the name, or the name with a number suffix if it is already used in the section.
+func (b *bundler) useName(section, name string) string {
+	if b.names[section] == nil {
+		b.names[section] = map[string]bool{}
+	}
+	unique := name
+	for i := 2; b.names[section][unique]; i++ {
+		unique = name + "_" + strconv.Itoa(i)
+	}
+	b.names[section][unique] = true
+	return unique
+}
+
+// sectionNode returns the mapping of the section of the components, or the top level section of Swagger 2.0.
+// If create is true, the missing mappings are created, otherwise nil is returned.
+func (b *bundler) sectionNode(section string, create bool) *yaml.Node {
+	parent, key := b.root, section
+	if b.swagger {
+		key = swaggerSections[section]
+	} else {
+		parent = value(b.root, "components")
+		if parent == nil {
+			if !create {
+				return nil
+			}
+			parent = mappingNode()
+			b.root.Content = append(b.root.Content, scalar("components"), parent)
+		}
+	}
+	node := value(parent, key)
+	if node == nil && create {
+		node = mappingNode()
+		parent.Content = append(parent.Content, scalar(key), node)
+	}
+	return node
+}
+
+// componentName returns the section and the name of the components for the $ref target.
+// The section is empty if the target cannot be a component and must be inlined.
+func componentName(pointer, target string, keys []string) (string, string) {
+	if matches := componentPattern.FindStringSubmatch(pointer); matches != nil {
+		return unescape(matches[1]), sanitizeName(unescape(matches[2]))
+	}
+	if matches := definitionPattern.FindStringSubmatch(pointer); matches != nil {
+		return "schemas", sanitizeName(unescape(matches[1]))
+	}
+
+	name := strings.TrimSuffix(path.Base(filepath.ToSlash(target)), path.Ext(target))
+	if pointer != "" && pointer != "/" {
+		name = unescape(pointer[strings.LastIndex(pointer, "/")+1:])
+	}
+	return sectionOf(keys), sanitizeName(name)
+}
+
+// sectionOf returns the section of the components for the value at the keys.
+func sectionOf(keys []string) string {
+	last, parent := "", ""
+	if len(keys) > 0 {
+		last = keys[len(keys)-1]
+	}
+	if len(keys) > 1 {
+		parent = keys[len(keys)-2]
+	}
+	switch {
+	case parent == "properties" || parent == "schemas":
+		return "schemas"
+	case last == "schema" || last == "items" || last == "additionalProperties" || last == "not" ||
+		last == "allOf" || last == "anyOf" || last == "oneOf":
+		return "schemas"
+	case last == "parameters":
+		return "parameters"
+	case last == "requestBody":
+		return "requestBodies"
+	case parent == "responses":
+		return "responses"
+	case parent == "headers":
+		return "headers"
+	case parent == "examples":
+		return "examples"
+	case parent == "links":
+		return "links"
+	case parent == "callbacks":
+		return "callbacks"
+	case parent == "securitySchemes":
+		return "securitySchemes"
+	default:
+		return ""
+	}
+}
+
+func resolveLocation(base, ref string) string {
+	if isURL(ref) {
+		return ref
+	}
+	if isURL(base) {
+		baseURL, err := url.Parse(base)
+		if err != nil {
+			return ref
+		}
+		refURL, err := url.Parse(ref)
+		if err != nil {
+			return ref
+		}
+		return baseURL.ResolveReference(refURL).String()
+	}
+	if filepath.IsAbs(ref) {
+		return ref
+	}
+	return filepath.Join(filepath.Dir(base), filepath.FromSlash(ref))
+}
+
+func copyNode(node *yaml.Node) *yaml.Node {
+	copied := *node
+	copied.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		copied.Content[i] = copyNode(child)
+	}
+	return &copied
+}
+
+func mappingKeys(node *yaml.Node) []string {
+	keys := []string{}
+	if node == nil || node.Kind != yaml.MappingNode {
+		return keys
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keys = append(keys, node.Content[i].Value)
+	}
+	return keys
+}
+
+func scalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+func unescape(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+}
+
+func sanitizeName(name string) string {
+	return invalidNamePattern.ReplaceAllString(name, "_")
+}
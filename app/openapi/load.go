@@ -0,0 +1,167 @@
+package openapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	gitPrefix = "git+"
+	// gitDefaultRef is fetched if the git source has no ref
+	gitDefaultRef = "HEAD"
+)
+
+var (
+	errInvalidSource     = errors.New("invalid spec source")
+	errFailedToReadSpec  = errors.New("failed to read OpenAPI definition")
+	errFailedToFetchSpec = errors.New("failed to fetch OpenAPI definition")
+	errFailedToCloneSpec = errors.New("failed to clone OpenAPI definition")
+)
+
+// SourceKind is the kind of the location of an OpenAPI definition.
+type SourceKind string
+
+const (
+	SourceLocal SourceKind = "local"
+	SourceHTTP  SourceKind = "http"
+	SourceGit   SourceKind = "git"
+)
+
+// Source is the location of an OpenAPI definition.
+type Source struct {
+	Kind SourceKind
+	// Location is the path, the URL or the git repository URL
+	Location string
+	// Ref is the branch, the tag or the commit of the git repository
+	Ref string
+	// Path is the path of the definition in the git repository
+	Path string
+}
+
+// ParseSource parses the spec source, which is one of:
+//   - a local path, e.g. app/openapi.yaml
+//   - an HTTP(S) URL, e.g. https://example.com/openapi.yaml
+//   - a git repository, a ref and a path, e.g. git+https://github.com/org/repo.git@v1.2.0#api/openapi.yaml
+func ParseSource(source string) (Source, error) {
+	switch {
+	case source == "":
+		return Source{}, xerrors.Errorf("%w: empty", errInvalidSource)
+	case strings.HasPrefix(source, gitPrefix):
+		repository, path, found := strings.Cut(strings.TrimPrefix(source, gitPrefix), "#")
+		if !found || path == "" {
+			return Source{}, xerrors.Errorf("%w: %s: the path in the repository is required after #", errInvalidSource, source)
+		}
+		parsed := Source{Kind: SourceGit, Location: repository, Ref: gitDefaultRef, Path: path}
+		// the ref is after the last @ of the path part, not the user of e.g. ssh://git@github.com/
+		_, rest, _ := strings.Cut(repository, "://")
+		if slash, at := strings.Index(rest, "/"), strings.LastIndex(rest, "@"); slash >= 0 && at > slash {
+			parsed.Location = repository[:len(repository)-len(rest)+at]
+			parsed.Ref = rest[at+1:]
+		}
+		if parsed.Location == "" || parsed.Ref == "" {
+			return Source{}, xerrors.Errorf("%w: %s", errInvalidSource, source)
+		}
+		return parsed, nil
+	case isURL(source):
+		return Source{Kind: SourceHTTP, Location: source}, nil
+	default:
+		return Source{Kind: SourceLocal, Location: source}, nil
+	}
+}
+
+// Load reads the OpenAPI definition of the source, and bundles the files and the URLs of the external $refs into it.
+// Swagger 2.0 is converted to OpenAPI 3.0, and the lossy conversions are returned as the problems of SeverityWarning.
+// The definition is returned as it is if it is OpenAPI 3 without external $refs.
+func Load(ctx context.Context, source string) ([]byte, []Problem, error) {
+	parsed, err := ParseSource(source)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	location := parsed.Location
+	switch parsed.Kind {
+	case SourceLocal:
+		location, err = filepath.Abs(location)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("%w: %w", errFailedToReadSpec, err)
+		}
+	case SourceGit:
+		dir, err := cloneGit(ctx, parsed.Location, parsed.Ref)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer os.RemoveAll(dir)
+		location = filepath.Join(dir, filepath.FromSlash(parsed.Path))
+	case SourceHTTP:
+	}
+
+	b := newBundler(ctx)
+	spec, err := b.bundle(location)
+	if err != nil {
+		return nil, nil, err
+	}
+	return spec, b.problems, nil
+}
+
+// cloneGit fetches the ref of the repository into a temporary directory without the history.
+// A fetch rather than a clone is used because clone --branch does not accept a commit.
+func cloneGit(ctx context.Context, repository, ref string) (string, error) {
+	dir, err := os.MkdirTemp("", "prism-spec-")
+	if err != nil {
+		return "", xerrors.Errorf("%w: %w", errFailedToCloneSpec, err)
+	}
+	commands := [][]string{
+		{"git", "init", "-q", dir},
+		{"git", "-C", dir, "fetch", "-q", "--depth", "1", repository, ref},
+		{"git", "-C", dir, "checkout", "-q", "FETCH_HEAD"},
+	}
+	for _, command := range commands {
+		output, err := exec.CommandContext(ctx, command[0], command[1:]...).CombinedOutput() //nolint:gosec // the repository is given by the user
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", xerrors.Errorf("%w: %s@%s: %w: %s", errFailedToCloneSpec, repository, ref, err, strings.TrimSpace(string(output)))
+		}
+	}
+	return dir, nil
+}
+
+// read reads the file or the URL.
+func read(ctx context.Context, location string) ([]byte, error) {
+	if !isURL(location) {
+		content, err := os.ReadFile(location)
+		if err != nil {
+			return nil, xerrors.Errorf("%w: %w", errFailedToReadSpec, err)
+		}
+		return content, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("%w: %w", errFailedToFetchSpec, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, xerrors.Errorf("%w: %w", errFailedToFetchSpec, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, xerrors.Errorf("%w: %s: %s", errFailedToFetchSpec, location, resp.Status)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, xerrors.Errorf("%w: %w", errFailedToFetchSpec, err)
+	}
+	return content, nil
+}
+
+func isURL(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
@@ -0,0 +1,164 @@
+package openapi_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/gold-kou/prism-in-k8s/app/openapi"
+	"github.com/gold-kou/prism-in-k8s/app/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const bundleDir = "testdata/bundle"
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		want    openapi.Source
+		wantErr bool
+	}{
+		{
+			name:   "local",
+			source: "app/openapi.yaml",
+			want:   openapi.Source{Kind: openapi.SourceLocal, Location: "app/openapi.yaml"},
+		},
+		{
+			name:   "https",
+			source: "https://example.com/openapi.yaml",
+			want:   openapi.Source{Kind: openapi.SourceHTTP, Location: "https://example.com/openapi.yaml"},
+		},
+		{
+			name:   "git with ref",
+			source: "git+https://github.com/org/repo.git@v1.2.0#api/openapi.yaml",
+			want:   openapi.Source{Kind: openapi.SourceGit, Location: "https://github.com/org/repo.git", Ref: "v1.2.0", Path: "api/openapi.yaml"},
+		},
+		{
+			name:   "git with user and slash in ref",
+			source: "git+ssh://git@github.com/org/repo.git@release/1.0#openapi.yaml",
+			want:   openapi.Source{Kind: openapi.SourceGit, Location: "ssh://git@github.com/org/repo.git", Ref: "release/1.0", Path: "openapi.yaml"},
+		},
+		{
+			name:   "git without ref",
+			source: "git+ssh://git@github.com/org/repo.git#openapi.yaml",
+			want:   openapi.Source{Kind: openapi.SourceGit, Location: "ssh://git@github.com/org/repo.git", Ref: "HEAD", Path: "openapi.yaml"},
+		},
+		{
+			name:    "git without path",
+			source:  "git+https://github.com/org/repo.git@main",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			source:  "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// test target
+			source, err := openapi.ParseSource(tt.source)
+
+			// verify
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, source)
+		})
+	}
+}
+
+func TestLoadLocal(t *testing.T) {
+	// test target
+	spec, _, err := openapi.Load(context.TODO(), filepath.Join(bundleDir, "openapi.yaml"))
+
+	// verify
+	require.NoError(t, err)
+	testutil.AssertGoldenText(t, "bundle.golden.yaml", string(spec))
+	_, err = openapi.Validate(spec)
+	assert.NoError(t, err)
+}
+
+func TestLoadHTTP(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir(bundleDir)))
+	defer server.Close()
+
+	// test target
+	spec, _, err := openapi.Load(context.TODO(), server.URL+"/openapi.yaml")
+
+	// verify
+	require.NoError(t, err)
+	testutil.AssertGoldenText(t, "bundle.golden.yaml", string(spec))
+
+	_, _, err = openapi.Load(context.TODO(), server.URL+"/unknown.yaml")
+	assert.ErrorContains(t, err, "404")
+}
+
+func TestLoadGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repository := t.TempDir()
+	output, err := exec.Command("cp", "-r", bundleDir, filepath.Join(repository, "api")).CombinedOutput()
+	require.NoError(t, err, string(output))
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "add spec"},
+		{"tag", "v1.0.0"},
+	} {
+		output, err := exec.Command("git", append([]string{"-C", repository}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+
+	for _, ref := range []string{"", "@main", "@v1.0.0"} {
+		// test target
+		spec, _, err := openapi.Load(context.TODO(), "git+file://"+repository+ref+"#api/openapi.yaml")
+
+		// verify
+		require.NoError(t, err, ref)
+		testutil.AssertGoldenText(t, "bundle.golden.yaml", string(spec))
+	}
+
+	_, _, err = openapi.Load(context.TODO(), "git+file://"+repository+"@unknown#api/openapi.yaml")
+	assert.Error(t, err)
+}
+
+func TestLoadWithoutExternalRefs(t *testing.T) {
+	path := "../openapi-sample.yaml"
+	expected, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// test target
+	spec, _, err := openapi.Load(context.TODO(), path)
+
+	// verify
+	require.NoError(t, err)
+	// kept as it is, e.g. the comments and the hash of the spec
+	assert.Equal(t, string(expected), string(spec))
+}
+
+func TestLoadUnresolvedRef(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "openapi.yaml"), []byte(`openapi: 3.0.0
+paths:
+  /users:
+    $ref: "paths.yaml#/users"
+`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "paths.yaml"), []byte("other: {}\n"), 0o600))
+
+	// test target
+	_, _, err := openapi.Load(context.TODO(), filepath.Join(dir, "openapi.yaml"))
+
+	// verify
+	assert.ErrorContains(t, err, `$ref "paths.yaml#/users"`)
+}
@@ -0,0 +1,124 @@
+// Package openapi reads the OpenAPI definition served by the mock.
+package openapi
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"sigs.k8s.io/yaml"
+)
+
+var errFailedToParse = errors.New("failed to parse OpenAPI definition")
+
+var methods = []string{
+	http.MethodGet,
+	http.MethodPut,
+	http.MethodPost,
+	http.MethodDelete,
+	http.MethodOptions,
+	http.MethodHead,
+	http.MethodPatch,
+	http.MethodTrace,
+}
+
+// Operation is an operation of the OpenAPI definition.
+type Operation struct {
+	// ID is the operationId, or the method and the path if the operationId is not set
+	ID     string
+	Method string
+	// Path is the path template, e.g. /users/{id}
+	Path string
+}
+
+// Operations finds the operation of a request.
+type Operations struct {
+	operations []Operation
+}
+
+// ParseOperations parses the operations of the OpenAPI definition in YAML or JSON.
+func ParseOperations(spec []byte) (*Operations, error) {
+	var document struct {
+		Paths map[string]map[string]interface{} `json:"paths"`
+	}
+	if err := yaml.Unmarshal(spec, &document); err != nil {
+		return nil, xerrors.Errorf("%w: %w", errFailedToParse, err)
+	}
+
+	operations := []Operation{}
+	for path, item := range document.Paths {
+		for _, method := range methods {
+			value, ok := item[strings.ToLower(method)]
+			if !ok {
+				continue
+			}
+			operation := Operation{ID: method + " " + path, Method: method, Path: path}
+			if fields, ok := value.(map[string]interface{}); ok {
+				if id, ok := fields["operationId"].(string); ok && id != "" {
+					operation.ID = id
+				}
+			}
+			operations = append(operations, operation)
+		}
+	}
+	// literal segments win over templates, e.g. /users/me over /users/{id}
+	sort.Slice(operations, func(i, j int) bool {
+		ti, tj := templateCount(operations[i].Path), templateCount(operations[j].Path)
+		if ti != tj {
+			return ti < tj
+		}
+		if operations[i].Path != operations[j].Path {
+			return operations[i].Path < operations[j].Path
+		}
+		return operations[i].Method < operations[j].Method
+	})
+	return &Operations{operations: operations}, nil
+}
+
+// Find returns the operation matching the method and the path of a request.
+func (o *Operations) Find(method, path string) (Operation, bool) {
+	method = strings.ToUpper(method)
+	for _, operation := range o.operations {
+		if operation.Method == method && matchPath(operation.Path, path) {
+			return operation, true
+		}
+	}
+	return Operation{}, false
+}
+
+func matchPath(template, path string) bool {
+	path, _, _ = strings.Cut(path, "?")
+	templateSegments := strings.Split(strings.Trim(template, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(templateSegments) != len(pathSegments) {
+		return false
+	}
+	for i, segment := range templateSegments {
+		if isTemplate(segment) {
+			if pathSegments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if segment != pathSegments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func templateCount(path string) int {
+	count := 0
+	for _, segment := range strings.Split(path, "/") {
+		if isTemplate(segment) {
+			count++
+		}
+	}
+	return count
+}
+
+func isTemplate(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
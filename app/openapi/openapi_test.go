@@ -0,0 +1,121 @@
+package openapi_test
+
+import (
+	"testing"
+
+	"github.com/gold-kou/prism-in-k8s/app/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const spec = `
+openapi: 3.0.0
+info:
+  title: test
+  version: 1.0.0
+paths:
+  /users:
+    get:
+      operationId: listUsers
+      responses: {}
+    post:
+      operationId: createUser
+      responses: {}
+  /users/{id}:
+    parameters:
+      - name: id
+        in: path
+        required: true
+    get:
+      operationId: getUser
+      responses: {}
+  /users/me:
+    get:
+      operationId: getMe
+      responses: {}
+  /health:
+    get:
+      responses: {}
+`
+
+func TestFind(t *testing.T) {
+	operations, err := openapi.ParseOperations([]byte(spec))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   openapi.Operation
+		found  bool
+	}{
+		{
+			name:   "literal",
+			method: "GET",
+			path:   "/users",
+			want:   openapi.Operation{ID: "listUsers", Method: "GET", Path: "/users"},
+			found:  true,
+		},
+		{
+			name:   "method",
+			method: "post",
+			path:   "/users",
+			want:   openapi.Operation{ID: "createUser", Method: "POST", Path: "/users"},
+			found:  true,
+		},
+		{
+			name:   "template",
+			method: "GET",
+			path:   "/users/1",
+			want:   openapi.Operation{ID: "getUser", Method: "GET", Path: "/users/{id}"},
+			found:  true,
+		},
+		{
+			name:   "literal over template",
+			method: "GET",
+			path:   "/users/me",
+			want:   openapi.Operation{ID: "getMe", Method: "GET", Path: "/users/me"},
+			found:  true,
+		},
+		{
+			name:   "query",
+			method: "GET",
+			path:   "/users?limit=1",
+			want:   openapi.Operation{ID: "listUsers", Method: "GET", Path: "/users"},
+			found:  true,
+		},
+		{
+			name:   "no operationId",
+			method: "GET",
+			path:   "/health",
+			want:   openapi.Operation{ID: "GET /health", Method: "GET", Path: "/health"},
+			found:  true,
+		},
+		{
+			name:   "no path",
+			method: "GET",
+			path:   "/unknown",
+		},
+		{
+			name:   "no method",
+			method: "DELETE",
+			path:   "/users",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// test target
+			operation, found := operations.Find(tt.method, tt.path)
+
+			// verify
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.want, operation)
+		})
+	}
+}
+
+func TestParseOperationsError(t *testing.T) {
+	_, err := openapi.ParseOperations([]byte("paths: ["))
+	assert.Error(t, err)
+}
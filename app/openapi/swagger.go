@@ -0,0 +1,737 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	swaggerVersion     = "2.0"
+	convertedVersion   = "3.0.3"
+	defaultMediaType   = "application/json"
+	formURLEncodedType = "application/x-www-form-urlencoded"
+	multipartFormType  = "multipart/form-data"
+	defaultScheme      = "https"
+)
+
+var (
+	// the keys of a Swagger 2.0 parameter moved into the schema of an OpenAPI 3 parameter
+	parameterSchemaKeys = []string{
+		"type", "format", "items", "enum", "default", "maximum", "exclusiveMaximum", "minimum", "exclusiveMinimum",
+		"maxLength", "minLength", "pattern", "maxItems", "minItems", "uniqueItems", "multipleOf",
+	}
+	// the keys of a Swagger 2.0 operation kept as they are
+	operationKeys = []string{"tags", "summary", "description", "externalDocs", "operationId", "deprecated", "security"}
+	// the sections of the components of the $refs of Swagger 2.0
+	swaggerRefPrefixes = map[string]string{
+		"#/definitions/": "#/components/schemas/",
+		"#/parameters/":  "#/components/parameters/",
+		"#/responses/":   "#/components/responses/",
+	}
+	oauth2Flows = map[string]string{
+		"implicit":    "implicit",
+		"password":    "password",
+		"application": "clientCredentials",
+		"accessCode":  "authorizationCode",
+	}
+)
+
+// ConvertSwagger converts the Swagger 2.0 definition in YAML or JSON to OpenAPI 3.0.
+// It returns the lossy conversions as the problems of SeverityWarning.
+func ConvertSwagger(spec []byte) ([]byte, []Problem, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(spec, &document); err != nil {
+		return nil, nil, xerrors.Errorf("%w: %w", errInvalidSpec, err)
+	}
+	if len(document.Content) == 0 || !isSwagger(document.Content[0]) {
+		return nil, nil, xerrors.Errorf("%w: swagger: %q is not found", errInvalidSpec, swaggerVersion)
+	}
+	if document.Content[0].Style&yaml.FlowStyle != 0 {
+		plainStyle(&document)
+	}
+	problems := convertSwagger(&document)
+	converted, err := encode(&document)
+	if err != nil {
+		return nil, nil, err
+	}
+	return converted, problems, nil
+}
+
+func isSwagger(root *yaml.Node) bool {
+	version := value(root, "swagger")
+	return version != nil && version.Value == swaggerVersion
+}
+
+// convertSwagger replaces the root of the Swagger 2.0 document with the converted OpenAPI 3.0 one.
+func convertSwagger(document *yaml.Node) []Problem {
+	c := &converter{
+		root:     document.Content[0],
+		problems: []Problem{},
+		consumes: stringValues(value(document.Content[0], "consumes")),
+		produces: stringValues(value(document.Content[0], "produces")),
+	}
+	document.Content[0] = c.convert()
+	return c.problems
+}
+
+type converter struct {
+	root     *yaml.Node
+	problems []Problem
+	// consumes and produces are the global media types
+	consumes []string
+	produces []string
+}
+
+func (c *converter) warnf(node *yaml.Node, path, format string, args ...interface{}) {
+	c.problems = append(c.problems, Problem{Line: node.Line, Path: path, Message: fmt.Sprintf(format, args...), Severity: SeverityWarning})
+}
+
+func (c *converter) convert() *yaml.Node {
+	converted := mappingNode()
+	setValue(converted, "openapi", scalar(convertedVersion))
+	if info := value(c.root, "info"); info != nil {
+		setValue(converted, "info", info)
+	}
+	if servers := c.servers(); len(servers.Content) > 0 {
+		setValue(converted, "servers", servers)
+	}
+	for _, key := range []string{"tags", "externalDocs", "security"} {
+		if node := value(c.root, key); node != nil {
+			setValue(converted, key, node)
+		}
+	}
+	setValue(converted, "paths", c.paths())
+	if components := c.components(); len(components.Content) > 0 {
+		setValue(converted, "components", components)
+	}
+	copyExtensions(c.root, converted)
+	rewriteRefs(converted)
+	return converted
+}
+
+// servers returns the servers of host, basePath and schemes.
+func (c *converter) servers() *yaml.Node {
+	servers := sequenceNode()
+	host, basePath := value(c.root, "host"), value(c.root, "basePath")
+	if host == nil {
+		if basePath != nil && basePath.Value != "/" {
+			servers.Content = append(servers.Content, server(basePath.Value))
+		}
+		return servers
+	}
+	path := ""
+	if basePath != nil && basePath.Value != "/" {
+		path = basePath.Value
+	}
+	schemes := stringValues(value(c.root, "schemes"))
+	if len(schemes) == 0 {
+		schemes = []string{defaultScheme}
+	}
+	for _, scheme := range schemes {
+		servers.Content = append(servers.Content, server(scheme+"://"+host.Value+path))
+	}
+	return servers
+}
+
+func (c *converter) paths() *yaml.Node {
+	paths := mappingNode()
+	swaggerPaths := value(c.root, "paths")
+	if swaggerPaths == nil || swaggerPaths.Kind != yaml.MappingNode {
+		return paths
+	}
+	for i := 0; i+1 < len(swaggerPaths.Content); i += 2 {
+		key, item := swaggerPaths.Content[i], swaggerPaths.Content[i+1]
+		if strings.HasPrefix(key.Value, "x-") || item.Kind != yaml.MappingNode {
+			setValue(paths, key.Value, item)
+			continue
+		}
+		setValue(paths, key.Value, c.pathItem(item, "paths."+key.Value))
+	}
+	return paths
+}
+
+func (c *converter) pathItem(item *yaml.Node, path string) *yaml.Node {
+	converted := mappingNode()
+	if ref := value(item, "$ref"); ref != nil {
+		setValue(converted, "$ref", ref)
+	}
+	// the body and formData parameters of the path item go to the request bodies of the operations
+	pathParameters, pathBody := c.splitParameters(value(item, "parameters"), path+".parameters")
+	if len(pathParameters.Content) > 0 {
+		setValue(converted, "parameters", pathParameters)
+	}
+	for _, method := range methods {
+		operation := value(item, strings.ToLower(method))
+		if operation == nil || operation.Kind != yaml.MappingNode {
+			continue
+		}
+		setValue(converted, strings.ToLower(method), c.operation(operation, pathBody, path+"."+strings.ToLower(method)))
+	}
+	copyExtensions(item, converted)
+	return converted
+}
+
+// requestParameters is the body and formData parameters of an operation.
+type requestParameters struct {
+	body *yaml.Node
+	// bodyRef is set if the body parameter is a $ref to the global parameters
+	bodyRef  string
+	formData []*yaml.Node
+}
+
+func (c *converter) operation(operation *yaml.Node, pathBody requestParameters, path string) *yaml.Node {
+	converted := mappingNode()
+	for _, key := range operationKeys {
+		if node := value(operation, key); node != nil {
+			setValue(converted, key, node)
+		}
+	}
+	if schemes := value(operation, "schemes"); schemes != nil {
+		c.warnf(schemes, path+".schemes", "the schemes of an operation are not converted, the global servers are used")
+	}
+
+	parameters, body := c.splitParameters(value(operation, "parameters"), path+".parameters")
+	if body.body == nil && body.bodyRef == "" && len(body.formData) == 0 {
+		body = pathBody
+	}
+	if len(parameters.Content) > 0 {
+		setValue(converted, "parameters", parameters)
+	}
+	consumes := c.consumes
+	if node := value(operation, "consumes"); node != nil {
+		consumes = stringValues(node)
+	}
+	if requestBody := c.requestBody(body, consumes, path); requestBody != nil {
+		setValue(converted, "requestBody", requestBody)
+	}
+
+	produces := c.produces
+	if node := value(operation, "produces"); node != nil {
+		produces = stringValues(node)
+	}
+	if responses := value(operation, "responses"); responses != nil && responses.Kind == yaml.MappingNode {
+		convertedResponses := mappingNode()
+		for i := 0; i+1 < len(responses.Content); i += 2 {
+			status, response := responses.Content[i], responses.Content[i+1]
+			setValue(convertedResponses, status.Value, c.response(response, produces, path+".responses."+status.Value))
+		}
+		setValue(converted, "responses", convertedResponses)
+	}
+	copyExtensions(operation, converted)
+	return converted
+}
+
+// splitParameters returns the converted parameters except the body and formData ones, which are returned separately.
+func (c *converter) splitParameters(parameters *yaml.Node, path string) (*yaml.Node, requestParameters) {
+	converted := sequenceNode()
+	body := requestParameters{}
+	if parameters == nil || parameters.Kind != yaml.SequenceNode {
+		return converted, body
+	}
+	for i, parameter := range parameters.Content {
+		parameterPath := fmt.Sprintf("%s[%d]", path, i)
+		resolved := parameter
+		ref := value(parameter, "$ref")
+		if ref != nil {
+			resolved = lookup(c.root, ref.Value)
+			if resolved == nil {
+				// left for Validate to report
+				converted.Content = append(converted.Content, parameter)
+				continue
+			}
+		}
+		switch in := value(resolved, "in"); {
+		case in != nil && in.Value == "body":
+			if body.body != nil || body.bodyRef != "" {
+				c.warnf(parameter, parameterPath, "only one body parameter is allowed, it is dropped")
+				continue
+			}
+			if ref != nil {
+				body.bodyRef = ref.Value
+			} else {
+				body.body = parameter
+			}
+		case in != nil && in.Value == "formData":
+			body.formData = append(body.formData, resolved)
+		case ref != nil:
+			converted.Content = append(converted.Content, parameter)
+		default:
+			converted.Content = append(converted.Content, c.parameter(parameter, parameterPath))
+		}
+	}
+	if (body.body != nil || body.bodyRef != "") && len(body.formData) > 0 {
+		c.warnf(parameters, path, "body and formData parameters cannot be used together, the formData parameters are dropped")
+		body.formData = nil
+	}
+	return converted, body
+}
+
+// parameter converts a parameter except body and formData.
+func (c *converter) parameter(parameter *yaml.Node, path string) *yaml.Node {
+	converted := mappingNode()
+	schema := mappingNode()
+	for i := 0; i+1 < len(parameter.Content); i += 2 {
+		key, node := parameter.Content[i].Value, parameter.Content[i+1]
+		switch {
+		case slices.Contains(parameterSchemaKeys, key):
+			setValue(schema, key, node)
+		case key == "collectionFormat":
+		case key == "x-example":
+			setValue(converted, "example", node)
+		default:
+			setValue(converted, key, node)
+		}
+	}
+	in := value(parameter, "in")
+	if typ := value(schema, "type"); typ != nil && typ.Value == "file" {
+		c.warnf(parameter, path, "type file is only allowed in formData, it is converted to a binary string")
+	}
+	c.convertSchema(schema)
+	if len(schema.Content) > 0 {
+		setValue(converted, "schema", schema)
+	}
+	if collectionFormat := value(parameter, "collectionFormat"); collectionFormat != nil && in != nil {
+		c.collectionFormat(converted, collectionFormat, in.Value, path)
+	}
+	return converted
+}
+
+// collectionFormat sets the style and explode of the collectionFormat of an array parameter.
+func (c *converter) collectionFormat(parameter, collectionFormat *yaml.Node, in, path string) {
+	switch {
+	case collectionFormat.Value == "csv" && in == "query":
+		setValue(parameter, "style", scalar("form"))
+		setValue(parameter, "explode", boolNode(false))
+	case collectionFormat.Value == "csv":
+		// the default style of path and header is simple, which is comma separated
+	case collectionFormat.Value == "multi" && in == "query":
+		setValue(parameter, "style", scalar("form"))
+		setValue(parameter, "explode", boolNode(true))
+	case collectionFormat.Value == "ssv" && in == "query":
+		setValue(parameter, "style", scalar("spaceDelimited"))
+	case collectionFormat.Value == "pipes" && in == "query":
+		setValue(parameter, "style", scalar("pipeDelimited"))
+	default:
+		c.warnf(collectionFormat, path+".collectionFormat", "collectionFormat %s in %s has no equivalent style, the default style is used", collectionFormat.Value, in)
+	}
+}
+
+func (c *converter) requestBody(body requestParameters, consumes []string, path string) *yaml.Node {
+	switch {
+	case body.bodyRef != "":
+		requestBody := mappingNode()
+		setValue(requestBody, "$ref", scalar("#/components/requestBodies/"+strings.TrimPrefix(body.bodyRef, "#/parameters/")))
+		return requestBody
+	case body.body != nil:
+		return c.bodyParameter(body.body, consumes)
+	case len(body.formData) > 0:
+		return c.formData(body.formData, consumes, path)
+	default:
+		return nil
+	}
+}
+
+// bodyParameter converts the body parameter to a request body with a media type per consumes.
+func (c *converter) bodyParameter(parameter *yaml.Node, consumes []string) *yaml.Node {
+	requestBody := mappingNode()
+	if description := value(parameter, "description"); description != nil {
+		setValue(requestBody, "description", description)
+	}
+	if len(consumes) == 0 {
+		consumes = []string{defaultMediaType}
+	}
+	content := mappingNode()
+	for _, mediaType := range consumes {
+		media := mappingNode()
+		if schema := value(parameter, "schema"); schema != nil {
+			schema = copyNode(schema)
+			c.convertSchema(schema)
+			setValue(media, "schema", schema)
+		}
+		if example := value(parameter, "x-example"); example != nil {
+			setValue(media, "example", example)
+		}
+		setValue(content, mediaType, media)
+	}
+	setValue(requestBody, "content", content)
+	if required := value(parameter, "required"); required != nil {
+		setValue(requestBody, "required", required)
+	}
+	return requestBody
+}
+
+// formData converts the formData parameters to a request body with an object schema.
+func (c *converter) formData(parameters []*yaml.Node, consumes []string, path string) *yaml.Node {
+	schema := mappingNode()
+	setValue(schema, "type", scalar("object"))
+	properties := mappingNode()
+	required := sequenceNode()
+	hasFile := false
+	for _, parameter := range parameters {
+		name := value(parameter, "name")
+		if name == nil {
+			continue
+		}
+		property := mappingNode()
+		for _, key := range append([]string{"description"}, parameterSchemaKeys...) {
+			if node := value(parameter, key); node != nil {
+				setValue(property, key, node)
+			}
+		}
+		if typ := value(property, "type"); typ != nil && typ.Value == "file" {
+			hasFile = true
+		}
+		if collectionFormat := value(parameter, "collectionFormat"); collectionFormat != nil && collectionFormat.Value != "multi" {
+			c.warnf(collectionFormat, path+".parameters."+name.Value, "collectionFormat %s of formData is not converted", collectionFormat.Value)
+		}
+		c.convertSchema(property)
+		setValue(properties, name.Value, property)
+		if isRequired := value(parameter, "required"); isRequired != nil && isRequired.Value == "true" {
+			required.Content = append(required.Content, scalar(name.Value))
+		}
+	}
+	setValue(schema, "properties", properties)
+	if len(required.Content) > 0 {
+		setValue(schema, "required", required)
+	}
+
+	mediaTypes := []string{}
+	for _, mediaType := range consumes {
+		if mediaType == formURLEncodedType || mediaType == multipartFormType {
+			mediaTypes = append(mediaTypes, mediaType)
+		}
+	}
+	if len(mediaTypes) == 0 {
+		mediaTypes = []string{formURLEncodedType}
+		if hasFile {
+			mediaTypes = []string{multipartFormType}
+		}
+	}
+	content := mappingNode()
+	for _, mediaType := range mediaTypes {
+		if hasFile && mediaType == formURLEncodedType {
+			c.warnf(parameters[0], path, "files cannot be sent as %s, only %s is converted", formURLEncodedType, multipartFormType)
+			continue
+		}
+		media := mappingNode()
+		setValue(media, "schema", copyNode(schema))
+		setValue(content, mediaType, media)
+	}
+	if len(content.Content) == 0 {
+		media := mappingNode()
+		setValue(media, "schema", schema)
+		setValue(content, multipartFormType, media)
+	}
+	requestBody := mappingNode()
+	setValue(requestBody, "content", content)
+	return requestBody
+}
+
+// response converts the schema and the examples of the response to a media type per produces.
+func (c *converter) response(response *yaml.Node, produces []string, path string) *yaml.Node {
+	if value(response, "$ref") != nil || response.Kind != yaml.MappingNode {
+		return response
+	}
+	converted := mappingNode()
+	description := value(response, "description")
+	if description == nil {
+		description = scalar("")
+	}
+	setValue(converted, "description", description)
+
+	if headers := value(response, "headers"); headers != nil && headers.Kind == yaml.MappingNode {
+		convertedHeaders := mappingNode()
+		for i := 0; i+1 < len(headers.Content); i += 2 {
+			convertedHeaders.Content = append(convertedHeaders.Content, headers.Content[i], c.header(headers.Content[i+1], path+".headers."+headers.Content[i].Value))
+		}
+		setValue(converted, "headers", convertedHeaders)
+	}
+
+	schema := value(response, "schema")
+	examples := value(response, "examples")
+	mediaTypes := append([]string{}, produces...)
+	if examples != nil && examples.Kind == yaml.MappingNode {
+		for _, mediaType := range mappingKeys(examples) {
+			if !slices.Contains(mediaTypes, mediaType) {
+				mediaTypes = append(mediaTypes, mediaType)
+			}
+		}
+	}
+	if len(mediaTypes) == 0 && schema != nil {
+		mediaTypes = []string{defaultMediaType}
+	}
+	if schema != nil || examples != nil {
+		content := mappingNode()
+		for _, mediaType := range mediaTypes {
+			media := mappingNode()
+			if schema != nil {
+				converted := copyNode(schema)
+				c.convertSchema(converted)
+				setValue(media, "schema", converted)
+			}
+			if examples != nil {
+				if example := value(examples, mediaType); example != nil {
+					setValue(media, "example", example)
+				}
+			}
+			setValue(content, mediaType, media)
+		}
+		setValue(converted, "content", content)
+	}
+	copyExtensions(response, converted)
+	return converted
+}
+
+func (c *converter) header(header *yaml.Node, path string) *yaml.Node {
+	converted := mappingNode()
+	schema := mappingNode()
+	for i := 0; i+1 < len(header.Content); i += 2 {
+		key, node := header.Content[i].Value, header.Content[i+1]
+		switch {
+		case slices.Contains(parameterSchemaKeys, key):
+			setValue(schema, key, node)
+		case key == "collectionFormat":
+			if node.Value != "csv" {
+				c.warnf(node, path+".collectionFormat", "collectionFormat %s of a header has no equivalent style, the default style is used", node.Value)
+			}
+		default:
+			setValue(converted, key, node)
+		}
+	}
+	if len(schema.Content) > 0 {
+		setValue(converted, "schema", schema)
+	}
+	return converted
+}
+
+func (c *converter) components() *yaml.Node {
+	components := mappingNode()
+	if definitions := value(c.root, "definitions"); definitions != nil && definitions.Kind == yaml.MappingNode {
+		schemas := mappingNode()
+		for i := 0; i+1 < len(definitions.Content); i += 2 {
+			schema := definitions.Content[i+1]
+			c.convertSchema(schema)
+			setValue(schemas, definitions.Content[i].Value, schema)
+		}
+		setValue(components, "schemas", schemas)
+	}
+
+	if responses := value(c.root, "responses"); responses != nil && responses.Kind == yaml.MappingNode {
+		convertedResponses := mappingNode()
+		for i := 0; i+1 < len(responses.Content); i += 2 {
+			name := responses.Content[i].Value
+			setValue(convertedResponses, name, c.response(responses.Content[i+1], c.produces, "responses."+name))
+		}
+		setValue(components, "responses", convertedResponses)
+	}
+
+	if parameters := value(c.root, "parameters"); parameters != nil && parameters.Kind == yaml.MappingNode {
+		convertedParameters := mappingNode()
+		requestBodies := mappingNode()
+		for i := 0; i+1 < len(parameters.Content); i += 2 {
+			name, parameter := parameters.Content[i].Value, parameters.Content[i+1]
+			switch in := value(parameter, "in"); {
+			case in != nil && in.Value == "body":
+				setValue(requestBodies, name, c.bodyParameter(parameter, c.consumes))
+			case in != nil && in.Value == "formData":
+				// inlined into the request bodies of the operations
+			default:
+				setValue(convertedParameters, name, c.parameter(parameter, "parameters."+name))
+			}
+		}
+		if len(convertedParameters.Content) > 0 {
+			setValue(components, "parameters", convertedParameters)
+		}
+		if len(requestBodies.Content) > 0 {
+			setValue(components, "requestBodies", requestBodies)
+		}
+	}
+
+	if definitions := value(c.root, "securityDefinitions"); definitions != nil && definitions.Kind == yaml.MappingNode {
+		schemes := mappingNode()
+		for i := 0; i+1 < len(definitions.Content); i += 2 {
+			name := definitions.Content[i].Value
+			setValue(schemes, name, c.securityScheme(definitions.Content[i+1], "securityDefinitions."+name))
+		}
+		setValue(components, "securitySchemes", schemes)
+	}
+	return components
+}
+
+func (c *converter) securityScheme(definition *yaml.Node, path string) *yaml.Node {
+	converted := mappingNode()
+	typ := value(definition, "type")
+	if description := value(definition, "description"); description != nil {
+		setValue(converted, "description", description)
+	}
+	switch {
+	case typ != nil && typ.Value == "basic":
+		setValue(converted, "type", scalar("http"))
+		setValue(converted, "scheme", scalar("basic"))
+	case typ != nil && typ.Value == "apiKey":
+		setValue(converted, "type", typ)
+		for _, key := range []string{"name", "in"} {
+			if node := value(definition, key); node != nil {
+				setValue(converted, key, node)
+			}
+		}
+	case typ != nil && typ.Value == "oauth2":
+		setValue(converted, "type", typ)
+		flow := value(definition, "flow")
+		if flow == nil || oauth2Flows[flow.Value] == "" {
+			c.warnf(definition, path, "unknown OAuth2 flow, the flows are empty")
+			setValue(converted, "flows", mappingNode())
+			break
+		}
+		convertedFlow := mappingNode()
+		for _, key := range []string{"authorizationUrl", "tokenUrl"} {
+			if node := value(definition, key); node != nil {
+				setValue(convertedFlow, key, node)
+			}
+		}
+		scopes := value(definition, "scopes")
+		if scopes == nil {
+			scopes = mappingNode()
+		}
+		setValue(convertedFlow, "scopes", scopes)
+		flows := mappingNode()
+		setValue(flows, oauth2Flows[flow.Value], convertedFlow)
+		setValue(converted, "flows", flows)
+	default:
+		c.warnf(definition, path, "unknown security scheme type, it is copied as it is")
+		return definition
+	}
+	copyExtensions(definition, converted)
+	return converted
+}
+
+// convertSchema converts the Swagger 2.0 only keywords of the schema and its subschemas in place.
+func (c *converter) convertSchema(schema *yaml.Node) {
+	if schema == nil || schema.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(schema.Content); i += 2 {
+		key, node := schema.Content[i], schema.Content[i+1]
+		switch key.Value {
+		case "x-nullable":
+			key.Value = "nullable"
+		case "type":
+			if node.Value == "file" {
+				node.Value = "string"
+				setValue(schema, "format", scalar("binary"))
+			}
+		case "discriminator":
+			if node.Kind == yaml.ScalarNode {
+				discriminator := mappingNode()
+				setValue(discriminator, "propertyName", scalar(node.Value))
+				schema.Content[i+1] = discriminator
+			}
+		case "items", "additionalProperties", "not":
+			c.convertSchema(node)
+		case "properties":
+			for j := 1; j < len(node.Content); j += 2 {
+				c.convertSchema(node.Content[j])
+			}
+		case "allOf", "anyOf", "oneOf":
+			for _, child := range node.Content {
+				c.convertSchema(child)
+			}
+		}
+	}
+}
+
+// rewriteRefs rewrites the $refs to the sections of Swagger 2.0 to the components.
+func rewriteRefs(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == "$ref" && node.Content[i+1].Kind == yaml.ScalarNode {
+				for prefix, replacement := range swaggerRefPrefixes {
+					if strings.HasPrefix(node.Content[i+1].Value, prefix) {
+						node.Content[i+1].Value = replacement + strings.TrimPrefix(node.Content[i+1].Value, prefix)
+					}
+				}
+			}
+		}
+	}
+	for _, child := range node.Content {
+		rewriteRefs(child)
+	}
+}
+
+func encode(document *yaml.Node) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buffer)
+	encoder.SetIndent(yamlIndent)
+	if err := encoder.Encode(document); err != nil {
+		return nil, xerrors.Errorf("%w: %w", errFailedToBundle, err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, xerrors.Errorf("%w: %w", errFailedToBundle, err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// plainStyle clears the styles of JSON, so that it is encoded in the block style YAML.
+func plainStyle(node *yaml.Node) {
+	// the scalars which need quotes are still quoted by the encoder
+	node.Style = 0
+	for _, child := range node.Content {
+		plainStyle(child)
+	}
+}
+
+func server(url string) *yaml.Node {
+	node := mappingNode()
+	setValue(node, "url", scalar(url))
+	return node
+}
+
+func copyExtensions(from, to *yaml.Node) {
+	for i := 0; i+1 < len(from.Content); i += 2 {
+		if strings.HasPrefix(from.Content[i].Value, "x-") && from.Content[i].Value != "x-example" && from.Content[i].Value != "x-nullable" {
+			setValue(to, from.Content[i].Value, from.Content[i+1])
+		}
+	}
+}
+
+// setValue sets the value of the key of the mapping node, keeping the order of the existing keys.
+func setValue(node *yaml.Node, key string, child *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = child
+			return
+		}
+	}
+	node.Content = append(node.Content, scalar(key), child)
+}
+
+func stringValues(node *yaml.Node) []string {
+	values := []string{}
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return values
+	}
+	for _, child := range node.Content {
+		values = append(values, child.Value)
+	}
+	return values
+}
+
+func mappingNode() *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+}
+
+func sequenceNode() *yaml.Node {
+	return &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+}
+
+func boolNode(b bool) *yaml.Node {
+	if b {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"}
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "false"}
+}
@@ -0,0 +1,88 @@
+package openapi_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gold-kou/prism-in-k8s/app/openapi"
+	"github.com/gold-kou/prism-in-k8s/app/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const swaggerDir = "testdata/swagger"
+
+func TestLoadSwagger(t *testing.T) {
+	// test target
+	spec, problems, err := openapi.Load(context.TODO(), filepath.Join(swaggerDir, "swagger.yaml"))
+
+	// verify
+	require.NoError(t, err)
+	testutil.AssertGoldenText(t, "swagger.golden.yaml", string(spec))
+	_, err = openapi.Validate(spec)
+	require.NoError(t, err)
+
+	messages := []string{}
+	for _, problem := range problems {
+		assert.Equal(t, openapi.SeverityWarning, problem.Severity)
+		messages = append(messages, problem.String())
+	}
+	assert.Equal(t, []string{
+		"line 19: paths./pets.get.schemes: the schemes of an operation are not converted, the global servers are used",
+		"line 32: paths./pets.get.parameters[1].collectionFormat: collectionFormat tsv in header has no equivalent style, the default style is used",
+	}, messages)
+}
+
+func TestConvertSwagger(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "json",
+			spec: `{"swagger": "2.0", "info": {"title": "test", "version": "1.0.0"}, "paths": {}}`,
+			want: `openapi: 3.0.3
+info:
+  title: test
+  version: 1.0.0
+paths: {}
+`,
+		},
+		{
+			name:    "openapi 3",
+			spec:    "openapi: 3.0.0\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// test target
+			converted, _, err := openapi.ConvertSwagger([]byte(tt.spec))
+
+			// verify
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(converted))
+		})
+	}
+}
+
+func TestConvertSwaggerLossy(t *testing.T) {
+	spec, err := os.ReadFile(filepath.Join(swaggerDir, "swagger.yaml"))
+	require.NoError(t, err)
+
+	// test target
+	_, problems, err := openapi.ConvertSwagger(spec)
+
+	// verify
+	require.NoError(t, err)
+	assert.Len(t, problems, 2)
+}
@@ -0,0 +1,397 @@
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+// Severity is the severity of a problem found in the OpenAPI definition.
+type Severity string
+
+const (
+	// SeverityError makes Prism fail to start or to mock the operation.
+	SeverityError Severity = "error"
+	// SeverityWarning lets Prism start, but the mock may not respond as expected.
+	SeverityWarning Severity = "warning"
+)
+
+var (
+	errInvalidSpec = errors.New("invalid OpenAPI definition")
+	versionPattern = regexp.MustCompile(`^3\.[01]\.\d+$`)
+	parameterIns   = map[string]bool{"query": true, "header": true, "path": true, "cookie": true}
+)
+
+// Problem is a problem found in the OpenAPI definition.
+type Problem struct {
+	Line     int
+	Path     string
+	Message  string
+	Severity Severity
+}
+
+func (p Problem) String() string {
+	if p.Path == "" {
+		return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s", p.Line, p.Path, p.Message)
+}
+
+// Validate validates the structure of the OpenAPI 3.0 or 3.1 definition in YAML or JSON.
+// It returns all the problems found, and an error listing the problems of SeverityError if any.
+func Validate(spec []byte) ([]Problem, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(spec, &document); err != nil {
+		// the message of yaml.v3 has the line number
+		return nil, xerrors.Errorf("%w: %w", errInvalidSpec, err)
+	}
+
+	v := &validator{keyLines: map[*yaml.Node]int{}, problems: []Problem{}}
+	if len(document.Content) == 0 {
+		v.errorf(&document, "", "the definition is empty")
+	} else {
+		v.root = document.Content[0]
+		v.indexKeyLines(v.root)
+		v.validateDocument()
+	}
+
+	errs := []string{}
+	for _, problem := range v.problems {
+		if problem.Severity == SeverityError {
+			errs = append(errs, problem.String())
+		}
+	}
+	if len(errs) > 0 {
+		return v.problems, fmt.Errorf("%w:\n%s", errInvalidSpec, strings.Join(errs, "\n"))
+	}
+	return v.problems, nil
+}
+
+type validator struct {
+	root *yaml.Node
+	// keyLines is the line of the key of each value, to report a problem of an object at its key rather than its first field
+	keyLines map[*yaml.Node]int
+	is31     bool
+	problems []Problem
+}
+
+func (v *validator) indexKeyLines(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			v.keyLines[node.Content[i+1]] = node.Content[i].Line
+		}
+	}
+	for _, child := range node.Content {
+		v.indexKeyLines(child)
+	}
+}
+
+func (v *validator) line(node *yaml.Node) int {
+	if line, ok := v.keyLines[node]; ok {
+		return line
+	}
+	return node.Line
+}
+
+func (v *validator) errorf(node *yaml.Node, path, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Line: v.line(node), Path: path, Message: fmt.Sprintf(format, args...), Severity: SeverityError})
+}
+
+func (v *validator) warnf(node *yaml.Node, path, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Line: v.line(node), Path: path, Message: fmt.Sprintf(format, args...), Severity: SeverityWarning})
+}
+
+func (v *validator) validateDocument() {
+	if v.root.Kind != yaml.MappingNode {
+		v.errorf(v.root, "", "the definition must be an object")
+		return
+	}
+
+	version := value(v.root, "openapi")
+	switch {
+	case version != nil && versionPattern.MatchString(version.Value):
+		v.is31 = strings.HasPrefix(version.Value, "3.1.")
+	case version != nil:
+		v.errorf(version, "openapi", "unsupported version %q, 3.0.x or 3.1.x is supported", version.Value)
+	case value(v.root, "swagger") != nil:
+		v.errorf(value(v.root, "swagger"), "swagger", "Swagger 2.0 must be converted to OpenAPI 3, e.g. by loading it from spec.source")
+	default:
+		v.errorf(v.root, "", "openapi is required")
+	}
+
+	info := v.requireMapping(v.root, "", "info")
+	if info != nil {
+		v.requireScalar(info, "info", "title")
+		v.requireScalar(info, "info", "version")
+	}
+
+	// only OpenAPI 3.1 allows a definition without paths, e.g. webhooks only
+	if v.is31 && value(v.root, "paths") == nil {
+		if value(v.root, "webhooks") == nil && value(v.root, "components") == nil {
+			v.errorf(v.root, "", "one of paths, webhooks and components is required")
+		}
+	} else if paths := v.requireMapping(v.root, "", "paths"); paths != nil {
+		v.validatePaths(paths)
+	}
+
+	v.validateRefs(v.root, "")
+}
+
+func (v *validator) validatePaths(paths *yaml.Node) {
+	for i := 0; i+1 < len(paths.Content); i += 2 {
+		key, item := paths.Content[i], paths.Content[i+1]
+		path := "paths." + key.Value
+		if strings.HasPrefix(key.Value, "x-") {
+			continue
+		}
+		if !strings.HasPrefix(key.Value, "/") {
+			v.errorf(key, path, "the path must start with /")
+		}
+		item = v.resolve(item)
+		if item == nil {
+			continue
+		}
+		if item.Kind != yaml.MappingNode {
+			v.errorf(item, path, "the path item must be an object")
+			continue
+		}
+		if parameters := value(item, "parameters"); parameters != nil {
+			v.validateParameters(parameters, path+".parameters")
+		}
+		for _, method := range methods {
+			operation := value(item, strings.ToLower(method))
+			if operation != nil {
+				v.validateOperation(operation, path+"."+strings.ToLower(method))
+			}
+		}
+	}
+}
+
+func (v *validator) validateOperation(operation *yaml.Node, path string) {
+	if operation.Kind != yaml.MappingNode {
+		v.errorf(operation, path, "the operation must be an object")
+		return
+	}
+	if parameters := value(operation, "parameters"); parameters != nil {
+		v.validateParameters(parameters, path+".parameters")
+	}
+
+	responses := value(operation, "responses")
+	if responses == nil {
+		// responses is optional since OpenAPI 3.1, but Prism has nothing to mock
+		if v.is31 {
+			v.warnf(operation, path, "no responses, the mock cannot respond")
+		} else {
+			v.errorf(operation, path, "responses is required")
+		}
+		return
+	}
+	if responses.Kind != yaml.MappingNode || len(responses.Content) == 0 {
+		v.errorf(responses, path+".responses", "responses must be an object with at least one response")
+		return
+	}
+	for i := 0; i+1 < len(responses.Content); i += 2 {
+		status, response := responses.Content[i], responses.Content[i+1]
+		if strings.HasPrefix(status.Value, "x-") {
+			continue
+		}
+		v.validateResponse(response, path+".responses."+status.Value)
+	}
+}
+
+func (v *validator) validateParameters(parameters *yaml.Node, path string) {
+	if parameters.Kind != yaml.SequenceNode {
+		v.errorf(parameters, path, "parameters must be an array")
+		return
+	}
+	for i, parameter := range parameters.Content {
+		parameterPath := fmt.Sprintf("%s[%d]", path, i)
+		parameter = v.resolve(parameter)
+		if parameter == nil {
+			continue
+		}
+		if parameter.Kind != yaml.MappingNode {
+			v.errorf(parameter, parameterPath, "the parameter must be an object")
+			continue
+		}
+		v.requireScalar(parameter, parameterPath, "name")
+		in := v.requireScalar(parameter, parameterPath, "in")
+		if in == nil {
+			continue
+		}
+		if !parameterIns[in.Value] {
+			v.errorf(in, parameterPath+".in", "unknown location %q, one of query, header, path and cookie is expected", in.Value)
+		}
+		if required := value(parameter, "required"); in.Value == "path" && (required == nil || required.Value != "true") {
+			v.errorf(parameter, parameterPath, "path parameters must be required")
+		}
+	}
+}
+
+func (v *validator) validateResponse(response *yaml.Node, path string) {
+	response = v.resolve(response)
+	if response == nil {
+		return
+	}
+	if response.Kind != yaml.MappingNode {
+		v.errorf(response, path, "the response must be an object")
+		return
+	}
+	v.requireScalar(response, path, "description")
+
+	content := value(response, "content")
+	if content == nil {
+		return
+	}
+	if content.Kind != yaml.MappingNode {
+		v.errorf(content, path+".content", "content must be an object")
+		return
+	}
+	for i := 0; i+1 < len(content.Content); i += 2 {
+		mediaType, media := content.Content[i], content.Content[i+1]
+		mediaPath := path + ".content." + mediaType.Value
+		if media.Kind != yaml.MappingNode {
+			v.errorf(media, mediaPath, "the media type must be an object")
+			continue
+		}
+		if value(media, "example") != nil || value(media, "examples") != nil {
+			continue
+		}
+		schema := value(media, "schema")
+		if schema == nil {
+			v.warnf(media, mediaPath, "no schema or examples, the static mock returns an empty body")
+			continue
+		}
+		if resolved := v.resolve(schema); resolved != nil && value(resolved, "example") == nil && value(resolved, "examples") == nil {
+			v.warnf(media, mediaPath, "no examples, the static mock returns a body generated from the schema")
+		}
+	}
+}
+
+// validateRefs reports the $refs which cannot be resolved in the definition.
+func (v *validator) validateRefs(node *yaml.Node, path string) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, child := node.Content[i], node.Content[i+1]
+			childPath := joinPath(path, key.Value)
+			if key.Value == "$ref" && child.Kind == yaml.ScalarNode {
+				v.validateRef(child, childPath)
+				continue
+			}
+			v.validateRefs(child, childPath)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			v.validateRefs(child, fmt.Sprintf("%s[%d]", path, i))
+		}
+	case yaml.DocumentNode, yaml.ScalarNode, yaml.AliasNode:
+	}
+}
+
+func (v *validator) validateRef(ref *yaml.Node, path string) {
+	if !strings.HasPrefix(ref.Value, "#") {
+		v.errorf(ref, path, "external $ref %q is not supported, only the definition file is copied into the image", ref.Value)
+		return
+	}
+	if lookup(v.root, ref.Value) == nil {
+		v.errorf(ref, path, "$ref %q cannot be resolved", ref.Value)
+	}
+}
+
+// resolve follows the local $ref of the node. It returns nil if the $ref cannot be resolved, which is reported by validateRefs.
+func (v *validator) resolve(node *yaml.Node) *yaml.Node {
+	// a limit for circular references
+	for range 32 {
+		if node.Kind != yaml.MappingNode {
+			return node
+		}
+		ref := value(node, "$ref")
+		if ref == nil {
+			return node
+		}
+		node = lookup(v.root, ref.Value)
+		if node == nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (v *validator) requireMapping(node *yaml.Node, path, key string) *yaml.Node {
+	child := value(node, key)
+	if child == nil {
+		v.errorf(node, path, "%s is required", key)
+		return nil
+	}
+	if child.Kind != yaml.MappingNode {
+		v.errorf(child, joinPath(path, key), "%s must be an object", key)
+		return nil
+	}
+	return child
+}
+
+func (v *validator) requireScalar(node *yaml.Node, path, key string) *yaml.Node {
+	child := value(node, key)
+	if child == nil || (child.Kind == yaml.ScalarNode && child.Value == "") {
+		v.errorf(node, path, "%s is required", key)
+		return nil
+	}
+	if child.Kind != yaml.ScalarNode {
+		v.errorf(child, joinPath(path, key), "%s must be a string", key)
+		return nil
+	}
+	return child
+}
+
+// value returns the value of the key of the mapping node, or nil if not found.
+func value(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// lookup returns the node of the local $ref, e.g. #/components/schemas/User, or nil if not found.
+func lookup(root *yaml.Node, ref string) *yaml.Node {
+	pointer := strings.TrimPrefix(ref, "#")
+	if pointer == "" {
+		return root
+	}
+	node := root
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = unescape(token)
+		if node.Kind == yaml.SequenceNode {
+			var index int
+			if _, err := fmt.Sscanf(token, "%d", &index); err != nil || index < 0 || index >= len(node.Content) {
+				return nil
+			}
+			node = node.Content[index]
+			continue
+		}
+		node = value(node, token)
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,220 @@
+package openapi_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gold-kou/prism-in-k8s/app/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want []string
+		// wantErr is true if any problem is an error
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			spec: `openapi: 3.0.3
+info:
+  title: test
+  version: 1.0.0
+paths:
+  /users/{id}:
+    get:
+      parameters:
+        - $ref: "#/components/parameters/id"
+      responses:
+        "200":
+          $ref: "#/components/responses/User"
+components:
+  parameters:
+    id:
+      name: id
+      in: path
+      required: true
+  responses:
+    User:
+      description: A user
+      content:
+        application/json:
+          schema:
+            $ref: "#/components/schemas/User"
+  schemas:
+    User:
+      type: object
+      example:
+        id: "1"
+`,
+			want: []string{},
+		},
+		{
+			name:    "syntax error",
+			spec:    "openapi: 3.0.0\ninfo: [\n",
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			spec:    "",
+			want:    []string{"line 0: the definition is empty"},
+			wantErr: true,
+		},
+		{
+			name: "swagger",
+			spec: `swagger: "2.0"
+info:
+  title: test
+  version: 1.0.0
+paths: {}
+`,
+			want:    []string{`line 1: swagger: Swagger 2.0 must be converted to OpenAPI 3, e.g. by loading it from spec.source`},
+			wantErr: true,
+		},
+		{
+			name: "structure",
+			spec: `openapi: 3.0.0
+info:
+  title: test
+paths:
+  users:
+    get:
+      parameters:
+        - name: id
+          in: body
+        - name: id
+          in: path
+    post:
+      responses:
+        "201":
+          content:
+            application/json:
+              example: {}
+    delete:
+      summary: no responses
+`,
+			want: []string{
+				"line 2: info: version is required",
+				"line 5: paths.users: the path must start with /",
+				"line 9: paths.users.get.parameters[0].in: unknown location \"body\", one of query, header, path and cookie is expected",
+				"line 10: paths.users.get.parameters[1]: path parameters must be required",
+				"line 6: paths.users.get: responses is required",
+				"line 14: paths.users.post.responses.201: description is required",
+				"line 18: paths.users.delete: responses is required",
+			},
+			wantErr: true,
+		},
+		{
+			name: "unresolved refs",
+			spec: `openapi: 3.0.0
+info:
+  title: test
+  version: 1.0.0
+paths:
+  /users:
+    get:
+      responses:
+        "200":
+          $ref: "#/components/responses/Users"
+        "400":
+          $ref: "errors.yaml#/BadRequest"
+`,
+			want: []string{
+				`line 10: paths./users.get.responses.200.$ref: $ref "#/components/responses/Users" cannot be resolved`,
+				`line 12: paths./users.get.responses.400.$ref: external $ref "errors.yaml#/BadRequest" is not supported, only the definition file is copied into the image`,
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing examples are warnings",
+			spec: `openapi: 3.1.0
+info:
+  title: test
+  version: 1.0.0
+paths:
+  /users:
+    get:
+      responses:
+        "200":
+          description: Users
+          content:
+            application/json:
+              schema:
+                type: array
+            text/plain: {}
+    post: {}
+`,
+			want: []string{
+				"line 12: paths./users.get.responses.200.content.application/json: no examples, the static mock returns a body generated from the schema",
+				"line 15: paths./users.get.responses.200.content.text/plain: no schema or examples, the static mock returns an empty body",
+				"line 16: paths./users.post: no responses, the mock cannot respond",
+			},
+		},
+		{
+			name: "unsupported version",
+			spec: `openapi: 4.0.0
+info:
+  title: test
+  version: 1.0.0
+paths: {}
+`,
+			want:    []string{`line 1: openapi: unsupported version "4.0.0", 3.0.x or 3.1.x is supported`},
+			wantErr: true,
+		},
+		{
+			name: "3.1 without paths",
+			spec: `openapi: 3.1.0
+info:
+  title: test
+  version: 1.0.0
+webhooks: {}
+`,
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// test target
+			problems, err := openapi.Validate([]byte(tt.spec))
+
+			// verify
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			if tt.want == nil {
+				return
+			}
+			got := []string{}
+			for _, problem := range problems {
+				got = append(got, problem.String())
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidateErrorMessage(t *testing.T) {
+	_, err := openapi.Validate([]byte("openapi: 3.0.0\npaths: {}\n"))
+	require.Error(t, err)
+	assert.Equal(t, "invalid OpenAPI definition:\nline 1: info is required", err.Error())
+}
+
+func TestValidateBundledDefinitions(t *testing.T) {
+	for _, path := range []string{"../openapi-sample.yaml", "../e2e/testdata/openapi.yaml"} {
+		spec, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		// test target
+		_, err = openapi.Validate(spec)
+
+		// verify
+		assert.NoError(t, err, path)
+	}
+}
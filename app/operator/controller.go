@@ -0,0 +1,264 @@
+package operator
+
+import (
+	"context"
+	"log"
+
+	"github.com/gold-kou/prism-in-k8s/app/istio"
+	"github.com/gold-kou/prism-in-k8s/app/k8s"
+	"github.com/gold-kou/prism-in-k8s/app/prismmock"
+	"golang.org/x/xerrors"
+	"google.golang.org/protobuf/proto"
+	"istio.io/client-go/pkg/apis/networking/v1alpha3"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	restclient "k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+const (
+	controllerName   = "prismmock"
+	leaderElectionID = "prism-in-k8s-operator"
+)
+
+// Options are the settings of the operator.
+type Options struct {
+	// MetricsBindAddress is "0" to disable the metrics endpoint
+	MetricsBindAddress string
+	LeaderElection     bool
+}
+
+// Reconciler reconciles the Deployment, Service, VirtualService and spec ConfigMap of a PrismMock.
+type Reconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// NewScheme returns the scheme with all types managed by the operator.
+func NewScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(v1alpha3.AddToScheme(scheme))
+	return scheme
+}
+
+// Start runs the operator until the context is canceled.
+func Start(ctx context.Context, kubeconfig *restclient.Config, options Options) error {
+	scheme := NewScheme()
+	mgr, err := ctrl.NewManager(kubeconfig, ctrl.Options{
+		Scheme:           scheme,
+		Metrics:          metricsserver.Options{BindAddress: options.MetricsBindAddress},
+		LeaderElection:   options.LeaderElection,
+		LeaderElectionID: leaderElectionID,
+	})
+	if err != nil {
+		return xerrors.Errorf("failed to create manager: %w", err)
+	}
+
+	builder := ctrl.NewControllerManagedBy(mgr).
+		Named(controllerName).
+		For(NewPrismMock()).
+		Owns(&appsv1.Deployment{}).
+		Owns(&corev1.Service{}).
+		Owns(&corev1.ConfigMap{})
+	// VirtualServices can be watched only when Istio is installed
+	if _, err := mgr.GetRESTMapper().RESTMapping(v1alpha3.SchemeGroupVersion.WithKind("VirtualService").GroupKind(), v1alpha3.SchemeGroupVersion.Version); err == nil {
+		builder = builder.Owns(&v1alpha3.VirtualService{})
+	} else {
+		log.Println("[WARN] VirtualService is not served, so it is not watched")
+	}
+
+	err = builder.Complete(&Reconciler{Client: mgr.GetClient(), Scheme: scheme})
+	if err != nil {
+		return xerrors.Errorf("failed to create controller: %w", err)
+	}
+
+	log.Println("[INFO] Operator is started")
+	if err := mgr.Start(ctx); err != nil {
+		return xerrors.Errorf("failed to run manager: %w", err)
+	}
+	return nil
+}
+
+// Reconcile brings the resources of the PrismMock to the desired state and reports the readiness in its status.
+func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	prismMock := NewPrismMock()
+	if err := r.Get(ctx, req.NamespacedName, prismMock); err != nil {
+		// owned resources are deleted by the garbage collector
+		return ctrl.Result{}, client.IgnoreNotFound(err) //nolint:wrapcheck // returned to controller-runtime
+	}
+
+	status, err := decodeStatus(prismMock)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	status.ObservedGeneration = prismMock.GetGeneration()
+
+	spec, err := decodeSpec(prismMock)
+	if err != nil {
+		// retrying does not help until the spec is fixed
+		log.Printf("[WARN] %s/%s: %v", req.Namespace, req.Name, err)
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               readyCondition,
+			Status:             metav1.ConditionFalse,
+			Reason:             "InvalidSpec",
+			Message:            err.Error(),
+			ObservedGeneration: prismMock.GetGeneration(),
+		})
+		return ctrl.Result{}, r.updateStatus(ctx, prismMock, status)
+	}
+
+	deployment, err := r.reconcileResources(ctx, prismMock, spec)
+	if err != nil {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               readyCondition,
+			Status:             metav1.ConditionFalse,
+			Reason:             "ReconcileFailed",
+			Message:            err.Error(),
+			ObservedGeneration: prismMock.GetGeneration(),
+		})
+		if statusErr := r.updateStatus(ctx, prismMock, status); statusErr != nil {
+			log.Printf("[WARN] %s/%s: %v", req.Namespace, req.Name, statusErr)
+		}
+		return ctrl.Result{}, err
+	}
+
+	status.Replicas = deployment.Status.Replicas
+	status.ReadyReplicas = deployment.Status.ReadyReplicas
+	status.URL = "http://" + prismMock.GetName() + "." + prismMock.GetNamespace() + ".svc.cluster.local"
+	condition := metav1.Condition{
+		Type:               readyCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Progressing",
+		Message:            "waiting for the Prism pods to be ready",
+		ObservedGeneration: prismMock.GetGeneration(),
+	}
+	if deployment.Spec.Replicas != nil && deployment.Status.UpdatedReplicas == *deployment.Spec.Replicas && deployment.Status.ReadyReplicas >= *deployment.Spec.Replicas {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Available"
+		condition.Message = "all Prism pods are ready"
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+	return ctrl.Result{}, r.updateStatus(ctx, prismMock, status)
+}
+
+func (r *Reconciler) reconcileResources(ctx context.Context, prismMock *unstructured.Unstructured, spec *prismmock.Mock) (*appsv1.Deployment, error) {
+	namespaceName := prismMock.GetNamespace()
+	resourceName := prismMock.GetName()
+
+	if spec.OpenAPI != "" {
+		configMap := k8s.NewSpecConfigMap(&spec.Config, namespaceName, resourceName, spec.OpenAPI)
+		desired := configMap.DeepCopy()
+		err := r.apply(ctx, prismMock, configMap, func() {
+			configMap.Labels = desired.Labels
+			configMap.Data = desired.Data
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	options := k8s.DeploymentOptions{
+		Image:   spec.Image,
+		OpenAPI: spec.OpenAPI,
+	}
+	deployment := k8s.NewDeployment(&spec.Config, namespaceName, resourceName, options)
+	desiredDeployment := deployment.DeepCopy()
+	err := r.apply(ctx, prismMock, deployment, func() {
+		deployment.Labels = desiredDeployment.Labels
+		deployment.Annotations = desiredDeployment.Annotations
+		deployment.Spec = desiredDeployment.Spec
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	service := k8s.NewService(&spec.Config, namespaceName, resourceName)
+	desiredService := service.DeepCopy()
+	err = r.apply(ctx, prismMock, service, func() {
+		service.Labels = desiredService.Labels
+		// keep the ClusterIP allocated by the API server
+		service.Spec.Selector = desiredService.Spec.Selector
+		service.Spec.Ports = desiredService.Spec.Ports
+		service.Spec.Type = desiredService.Spec.Type
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if spec.IstioMode {
+		err = r.applyVirtualService(ctx, prismMock, istio.NewVirtualService(&spec.Config, namespaceName, resourceName))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return deployment, nil
+}
+
+// apply creates or updates the object owned by the PrismMock. mutate sets the desired state to the object read from the cluster.
+func (r *Reconciler) apply(ctx context.Context, prismMock *unstructured.Unstructured, obj client.Object, mutate func()) error {
+	result, err := controllerutil.CreateOrUpdate(ctx, r.Client, obj, func() error {
+		mutate()
+		return controllerutil.SetControllerReference(prismMock, obj, r.Scheme) //nolint:wrapcheck // wrapped below
+	})
+	if err != nil {
+		return xerrors.Errorf("failed to apply %T %s: %w", obj, obj.GetName(), err)
+	}
+	if result != controllerutil.OperationResultNone {
+		log.Printf("[INFO] %T %s/%s is %s", obj, obj.GetNamespace(), obj.GetName(), result)
+	}
+	return nil
+}
+
+// applyVirtualService is the same as apply, but compares the spec as protobuf which controllerutil.CreateOrUpdate cannot.
+func (r *Reconciler) applyVirtualService(ctx context.Context, prismMock *unstructured.Unstructured, desired *v1alpha3.VirtualService) error {
+	if err := controllerutil.SetControllerReference(prismMock, desired, r.Scheme); err != nil {
+		return xerrors.Errorf("failed to set owner of VirtualService %s: %w", desired.Name, err)
+	}
+
+	current := &v1alpha3.VirtualService{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(desired), current)
+	if apierrors.IsNotFound(err) {
+		if err := r.Create(ctx, desired); err != nil {
+			return xerrors.Errorf("failed to apply VirtualService %s: %w", desired.Name, err)
+		}
+		log.Printf("[INFO] VirtualService %s/%s is created", desired.Namespace, desired.Name)
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("failed to apply VirtualService %s: %w", desired.Name, err)
+	}
+
+	if proto.Equal(&current.Spec, &desired.Spec) && equality.Semantic.DeepEqual(current.Labels, desired.Labels) && equality.Semantic.DeepEqual(current.OwnerReferences, desired.OwnerReferences) {
+		return nil
+	}
+	current.Labels = desired.Labels
+	current.OwnerReferences = desired.OwnerReferences
+	desired.Spec.DeepCopyInto(&current.Spec)
+	if err := r.Update(ctx, current); err != nil {
+		return xerrors.Errorf("failed to apply VirtualService %s: %w", desired.Name, err)
+	}
+	log.Printf("[INFO] VirtualService %s/%s is updated", desired.Namespace, desired.Name)
+	return nil
+}
+
+func (r *Reconciler) updateStatus(ctx context.Context, prismMock *unstructured.Unstructured, status *Status) error {
+	if err := encodeStatus(prismMock, status); err != nil {
+		return err
+	}
+	if err := r.Status().Update(ctx, prismMock); err != nil {
+		return xerrors.Errorf("failed to update status: %w", err)
+	}
+	return nil
+}
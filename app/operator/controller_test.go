@@ -0,0 +1,199 @@
+package operator_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gold-kou/prism-in-k8s/app/k8s"
+	"github.com/gold-kou/prism-in-k8s/app/operator"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+const testOpenAPI = `openapi: 3.0.0
+info:
+  title: Test API
+  version: 1.0.0
+paths: {}
+`
+
+func startEnvtest(t *testing.T) client.Client {
+	t.Helper()
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set, use `make test-envtest`")
+	}
+
+	testEnv := &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd")},
+		ErrorIfCRDPathMissing: true,
+	}
+	kubeconfig, err := testEnv.Start()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, testEnv.Stop())
+	})
+
+	k8sClient, err := client.New(kubeconfig, client.Options{Scheme: operator.NewScheme()})
+	require.NoError(t, err)
+	return k8sClient
+}
+
+func createPrismMock(ctx context.Context, t *testing.T, k8sClient client.Client, spec map[string]interface{}) types.NamespacedName {
+	t.Helper()
+	testNamespaceName := "test-namespace" + uuid.NewString()
+	testResourceName := "test-resource" + uuid.NewString()
+
+	err := k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespaceName}})
+	require.NoError(t, err)
+
+	prismMock := operator.NewPrismMock()
+	prismMock.SetNamespace(testNamespaceName)
+	prismMock.SetName(testResourceName)
+	prismMock.Object["spec"] = spec
+	err = k8sClient.Create(ctx, prismMock)
+	require.NoError(t, err)
+	return types.NamespacedName{Namespace: testNamespaceName, Name: testResourceName}
+}
+
+func getReadyCondition(ctx context.Context, t *testing.T, k8sClient client.Client, key types.NamespacedName) *metav1.Condition {
+	t.Helper()
+	prismMock := operator.NewPrismMock()
+	err := k8sClient.Get(ctx, key, prismMock)
+	require.NoError(t, err)
+
+	rawConditions, _, err := unstructured.NestedSlice(prismMock.Object, "status", "conditions")
+	require.NoError(t, err)
+	conditions := []metav1.Condition{}
+	for _, rawCondition := range rawConditions {
+		condition := rawCondition.(map[string]interface{}) //nolint:forcetypeassert // test
+		conditions = append(conditions, metav1.Condition{
+			Type:   condition["type"].(string),                           //nolint:forcetypeassert // test
+			Status: metav1.ConditionStatus(condition["status"].(string)), //nolint:forcetypeassert // test
+			Reason: condition["reason"].(string),                         //nolint:forcetypeassert // test
+		})
+	}
+	return meta.FindStatusCondition(conditions, "Ready")
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.TODO()
+	k8sClient := startEnvtest(t)
+	key := createPrismMock(ctx, t, k8sClient, map[string]interface{}{
+		"openapi":   testOpenAPI,
+		"prismPort": int64(4010),
+	})
+	reconciler := &operator.Reconciler{Client: k8sClient, Scheme: operator.NewScheme()}
+
+	// test target
+	_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+
+	// verify
+	configMap := &corev1.ConfigMap{}
+	err = k8sClient.Get(ctx, types.NamespacedName{Namespace: key.Namespace, Name: k8s.SpecConfigMapName(key.Name)}, configMap)
+	require.NoError(t, err)
+	assert.Equal(t, testOpenAPI, configMap.Data[k8s.SpecConfigMapKey])
+	assert.Equal(t, key.Name, metav1.GetControllerOf(configMap).Name)
+
+	deployment := &appsv1.Deployment{}
+	err = k8sClient.Get(ctx, key, deployment)
+	require.NoError(t, err)
+	assert.Equal(t, key.Name, metav1.GetControllerOf(deployment).Name)
+	assert.Equal(t, k8s.PrismImage, deployment.Spec.Template.Spec.Containers[0].Image)
+	assert.Contains(t, deployment.Spec.Template.Spec.Containers[0].Args, "4010")
+
+	service := &corev1.Service{}
+	err = k8sClient.Get(ctx, key, service)
+	require.NoError(t, err)
+	assert.Equal(t, key.Name, metav1.GetControllerOf(service).Name)
+
+	// no pods run in envtest
+	condition := getReadyCondition(ctx, t, k8sClient, key)
+	require.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Equal(t, "Progressing", condition.Reason)
+
+	// pretend the pods to be ready
+	deployment.Status.Replicas = 1
+	deployment.Status.UpdatedReplicas = 1
+	deployment.Status.ReadyReplicas = 1
+	err = k8sClient.Status().Update(ctx, deployment)
+	require.NoError(t, err)
+	_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+
+	condition = getReadyCondition(ctx, t, k8sClient, key)
+	require.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionTrue, condition.Status)
+}
+
+func TestReconcileInvalidSpec(t *testing.T) {
+	tests := []struct {
+		name string
+		spec map[string]interface{}
+	}{
+		{
+			name: "neither openapi nor image",
+			spec: map[string]interface{}{
+				"prismPort": int64(4010),
+			},
+		},
+		{
+			name: "invalid parameter",
+			spec: map[string]interface{}{
+				"openapi":  testOpenAPI,
+				"prismCpu": "half",
+			},
+		},
+		{
+			name: "unsupported key",
+			spec: map[string]interface{}{
+				"openapi": testOpenAPI,
+				"routes": []interface{}{
+					map[string]interface{}{"name": "users", "timeout": "1s"},
+				},
+			},
+		},
+		{
+			name: "unknown key",
+			spec: map[string]interface{}{
+				"openapi":  testOpenAPI,
+				"prismCPU": "500m",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			k8sClient := startEnvtest(t)
+			key := createPrismMock(ctx, t, k8sClient, tt.spec)
+			reconciler := &operator.Reconciler{Client: k8sClient, Scheme: operator.NewScheme()}
+
+			// test target
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			require.NoError(t, err)
+
+			// verify
+			err = k8sClient.Get(ctx, key, &appsv1.Deployment{})
+			assert.True(t, apierrors.IsNotFound(err))
+			condition := getReadyCondition(ctx, t, k8sClient, key)
+			require.NotNil(t, condition)
+			assert.Equal(t, metav1.ConditionFalse, condition.Status)
+			assert.Equal(t, "InvalidSpec", condition.Reason)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package operator
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/gold-kou/prism-in-k8s/app/prismmock"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	readyCondition = "Ready"
+)
+
+// GroupVersionKind is the GroupVersionKind of the PrismMock custom resource defined in config/crd/prismmock.yaml.
+var GroupVersionKind = schema.GroupVersionKind{
+	Group:   "prism.gold-kou.github.io",
+	Version: "v1alpha1",
+	Kind:    "PrismMock",
+}
+
+var errInvalidSpec = errors.New("invalid PrismMock spec")
+
+// supportedKeys are the keys of the spec handled by the operator.
+// The other keys of config/params.yaml, e.g. ttl, trafficSplit, destinationRule, routes and istio, need an image build
+// or resources out of the namespace of the PrismMock, so they are rejected rather than silently ignored.
+var supportedKeys = map[string]bool{
+	"openapi":           true,
+	"image":             true,
+	"microserviceName":  true,
+	"prismPort":         true,
+	"prismCpu":          true,
+	"prismMemory":       true,
+	"istioMode":         true,
+	"istioProxyCpu":     true,
+	"istioProxyMemory":  true,
+	"priorityClassName": true,
+}
+
+// Status is the status of PrismMock.
+type Status struct { //nolint:tagliatelle // Kubernetes API conventions
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Replicas           int32              `json:"replicas"`
+	ReadyReplicas      int32              `json:"readyReplicas"`
+	URL                string             `json:"url,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// NewPrismMock returns an empty PrismMock to be filled by the client.
+func NewPrismMock() *unstructured.Unstructured {
+	prismMock := &unstructured.Unstructured{}
+	prismMock.SetGroupVersionKind(GroupVersionKind)
+	return prismMock
+}
+
+// decodeSpec decodes and validates the spec of PrismMock as prismmock.Mock, so the keys are the same as config/params.yaml.
+// A key not in supportedKeys is an error.
+func decodeSpec(prismMock *unstructured.Unstructured) (*prismmock.Mock, error) {
+	rawSpec, _, err := unstructured.NestedMap(prismMock.Object, "spec")
+	if err != nil {
+		return nil, xerrors.Errorf("%w: %w", errInvalidSpec, err)
+	}
+	unsupported := []string{}
+	for key := range rawSpec {
+		if !supportedKeys[key] {
+			unsupported = append(unsupported, key)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return nil, xerrors.Errorf("%w: %s not supported by the operator", errInvalidSpec, strings.Join(unsupported, ", "))
+	}
+
+	// go through YAML to reuse the tags of prismmock.Mock
+	marshaled, err := yaml.Marshal(rawSpec)
+	if err != nil {
+		return nil, xerrors.Errorf("%w: %w", errInvalidSpec, err)
+	}
+	var spec prismmock.Mock
+	if err := yaml.UnmarshalStrict(marshaled, &spec); err != nil {
+		return nil, xerrors.Errorf("%w: %w", errInvalidSpec, err)
+	}
+
+	if (spec.OpenAPI == "") == (spec.Image == "") {
+		return nil, xerrors.Errorf("%w: exactly one of openapi and image must be set", errInvalidSpec)
+	}
+	if spec.OpenAPI != "" {
+		if err := prismmock.ValidateOpenAPI(spec.OpenAPI); err != nil {
+			return nil, xerrors.Errorf("%w: openapi: %w", errInvalidSpec, err)
+		}
+	}
+	if spec.MicroserviceName == "" {
+		spec.MicroserviceName = prismMock.GetName()
+	}
+	spec.SetDefaults()
+	// the names are given by the PrismMock, so only the options are validated
+	if err := params.ValidateOptions(&spec.Config); err != nil {
+		return nil, xerrors.Errorf("%w: %w", errInvalidSpec, err)
+	}
+	return &spec, nil
+}
+
+func decodeStatus(prismMock *unstructured.Unstructured) (*Status, error) {
+	var status Status
+	rawStatus, found, err := unstructured.NestedMap(prismMock.Object, "status")
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode status: %w", err)
+	}
+	if !found {
+		return &status, nil
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawStatus, &status); err != nil {
+		return nil, xerrors.Errorf("failed to decode status: %w", err)
+	}
+	return &status, nil
+}
+
+func encodeStatus(prismMock *unstructured.Unstructured, status *Status) error {
+	rawStatus, err := runtime.DefaultUnstructuredConverter.ToUnstructured(status)
+	if err != nil {
+		return xerrors.Errorf("failed to encode status: %w", err)
+	}
+	if err := unstructured.SetNestedMap(prismMock.Object, rawStatus, "status"); err != nil {
+		return xerrors.Errorf("failed to encode status: %w", err)
+	}
+	return nil
+}
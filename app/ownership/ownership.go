@@ -0,0 +1,87 @@
+package ownership
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// labels set on every resource created by this tool
+	ManagedByLabel    = "app.kubernetes.io/managed-by"
+	ManagedByValue    = "prism-in-k8s"
+	MicroserviceLabel = "prism-in-k8s/microservice"
+
+	// annotations set on the mock deployment
+	CreatedByAnnotation  = "prism-in-k8s/created-by"
+	SpecHashAnnotation   = "prism-in-k8s/spec-hash"
+	RepositoryAnnotation = "prism-in-k8s/repository"
+	ExpiresAtAnnotation  = "prism-in-k8s/expires-at"
+
+	// annotation set on the VirtualService of the mock, the namespace/name of the VirtualService of the real microservice
+	// into which the header route to the mock is inserted
+	HeaderRouteAnnotation = "prism-in-k8s/header-route-in"
+	// the namespace/name of the VirtualService of the real microservice whose routes mirror to the mock
+	MirrorAnnotation = "prism-in-k8s/mirror-in"
+
+	// tag set on the ECR repository
+	ManagedByTagKey = "managed-by"
+)
+
+// Owner describes who created a mock and from which OpenAPI definition.
+type Owner struct {
+	Creator    string
+	SpecHash   string
+	Repository string
+	// ExpiresAt is zero if the mock never expires
+	ExpiresAt time.Time
+}
+
+// Labels returns the ownership labels for the mock of the given microservice.
+func Labels(microserviceName string) map[string]string {
+	return map[string]string{
+		ManagedByLabel:    ManagedByValue,
+		MicroserviceLabel: microserviceName,
+	}
+}
+
+// Selector returns the label selector matching all resources created by this tool.
+func Selector() string {
+	return ManagedByLabel + "=" + ManagedByValue
+}
+
+// Annotations returns the ownership annotations, skipping empty values.
+func (o Owner) Annotations() map[string]string {
+	annotations := map[string]string{}
+	if o.Creator != "" {
+		annotations[CreatedByAnnotation] = o.Creator
+	}
+	if o.SpecHash != "" {
+		annotations[SpecHashAnnotation] = o.SpecHash
+	}
+	if o.Repository != "" {
+		annotations[RepositoryAnnotation] = o.Repository
+	}
+	if !o.ExpiresAt.IsZero() {
+		annotations[ExpiresAtAnnotation] = o.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	return annotations
+}
+
+// HashFile returns the hex encoded SHA-256 of the file content.
+func HashFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", xerrors.Errorf("failed to read %s: %w", path, err)
+	}
+	return HashSpec(content), nil
+}
+
+// HashSpec returns the hex encoded SHA-256 of the OpenAPI definition.
+func HashSpec(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -3,12 +3,14 @@ package params
 import (
 	"errors"
 	"fmt"
-	"log"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"golang.org/x/xerrors"
 	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 const (
@@ -19,100 +21,273 @@ const (
 	defaultIstioMode        = true
 	defaultIstioProxyCPU    = "500m"
 	defaultIstioProxyMemory = "512Mi"
+	maxPercentage           = 100
+	maxHTTPStatus           = 599
+	maxPort                 = 65535
+
+	// used when microserviceName or microserviceNamespace is empty
+	defaultResourceName  = "test-microservice"
+	defaultNamespaceName = "test-namespace"
 )
 
+// DefaultWaypointName is the name of the waypoint deployed with the mock in ambient.
+const DefaultWaypointName = "waypoint"
+
 var (
 	errEmptyParameter           = errors.New("empty parameter found")
 	errUnsupportedParameterType = errors.New("unsupported parameter type")
+	errInvalidParameter         = errors.New("invalid parameter")
 	errFailedToOpenConfigFile   = errors.New("failed to open config file")
 	errFailedToDecodeConfigFile = errors.New("failed to decode config file")
 )
 
-var (
+type Config struct {
 	// required parameters
-	MicroserviceName      string
-	MicroserviceNamespace string
-	PrismMockSuffix       string
+	MicroserviceName      string `yaml:"microserviceName"`
+	MicroserviceNamespace string `yaml:"microserviceNamespace"`
+	PrismMockSuffix       string `yaml:"prismMockSuffix"`
 	// optional parameters
-	Timeout           time.Duration
-	PrismPort         int
-	PrismCPU          string
-	PrismMemory       string
-	IstioMode         bool
-	IstioProxyCPU     string
-	IstioProxyMemory  string
-	PriorityClassName string
-	EcrTags           []ECRTag
-)
+	Timeout     time.Duration `yaml:"timeout"`
+	PrismPort   int           `yaml:"prismPort"`
+	PrismCPU    string        `yaml:"prismCpu"`
+	PrismMemory string        `yaml:"prismMemory"`
+	IstioMode   bool          `yaml:"istioMode"`
+	// IstioRevision is the revision or the revision tag for the sidecar injection. It is detected from the cluster if empty.
+	IstioRevision     string          `yaml:"istioRevision"`
+	Istio             Istio           `yaml:"istio"`
+	IstioProxyCPU     string          `yaml:"istioProxyCpu"`
+	IstioProxyMemory  string          `yaml:"istioProxyMemory"`
+	PriorityClassName string          `yaml:"priorityClassName"`
+	EcrTags           []ECRTag        `yaml:"ecrTags"`
+	TTL               time.Duration   `yaml:"ttl"`
+	Spec              Spec            `yaml:"spec"`
+	TrafficSplit      TrafficSplit    `yaml:"trafficSplit"`
+	TrafficMirror     TrafficMirror   `yaml:"trafficMirror"`
+	DestinationRule   DestinationRule `yaml:"destinationRule"`
+	Routes            []Route         `yaml:"routes"`
+	// FaultProxyImage is the image of cmd/faultproxy. It is built and pushed with the Prism image if empty.
+	FaultProxyImage string `yaml:"faultProxyImage"`
+}
 
-type Config struct {
-	MicroserviceName      string        `yaml:"microserviceName"`
-	MicroserviceNamespace string        `yaml:"microserviceNamespace"`
-	PrismMockSuffix       string        `yaml:"prismMockSuffix"`
-	Timeout               time.Duration `yaml:"timeout"`
-	PrismPort             int           `yaml:"prismPort"`
-	PrismCPU              string        `yaml:"prismCpu"`
-	PrismMemory           string        `yaml:"prismMemory"`
-	IstioMode             bool          `yaml:"istioMode"`
-	IstioProxyCPU         string        `yaml:"istioProxyCpu"`
-	IstioProxyMemory      string        `yaml:"istioProxyMemory"`
-	PriorityClassName     string        `yaml:"priorityClassName"`
-	EcrTags               []ECRTag      `yaml:"ecrTags"`
+// Spec is the location of the OpenAPI definition.
+type Spec struct {
+	// Source is a local path, an HTTP(S) URL or git+<repository>@<ref>#<path>. app/openapi.yaml is used if empty.
+	Source string `yaml:"source"`
 }
 
-type ECRTag struct {
-	Key   string `yaml:"key"`
-	Value string `yaml:"value"`
+// Istio is the data plane of Istio used by the mock.
+type Istio struct {
+	// Dataplane is sidecar or ambient. sidecar is used if empty.
+	Dataplane string `yaml:"dataplane"`
+	// Waypoint is the name of an existing waypoint for the mock in ambient. A waypoint is deployed in the namespace of the mock if empty.
+	Waypoint string `yaml:"waypoint"`
+	// WaypointNamespace is the namespace of Waypoint. The namespace of the mock is used if empty.
+	WaypointNamespace string `yaml:"waypointNamespace"`
 }
 
-func init() {
-	path := os.Getenv("PARAMS_CONFIG_PATH")
-	if path == "" {
-		log.Fatal("PARAMS_CONFIG_PATH is not set")
-	}
-	config, err := LoadConfig(path)
-	if err != nil {
-		log.Fatalf("Error loading config: %v", err)
-	}
+const (
+	DataplaneSidecar = "sidecar"
+	DataplaneAmbient = "ambient"
+)
 
-	// required parameters
-	MicroserviceName = config.MicroserviceName
-	MicroserviceNamespace = config.MicroserviceNamespace
-	PrismMockSuffix = config.PrismMockSuffix
+// Ambient returns true if the mock runs in the ambient mode of Istio without the sidecars.
+func (c *Config) Ambient() bool {
+	return c.IstioMode && c.Istio.Dataplane == DataplaneAmbient
+}
 
-	// optional parameters
-	Timeout = defaultTimeout
-	if config.Timeout != 0 {
-		Timeout = config.Timeout
-	}
-	PrismPort = defaultPrismPort
-	if config.PrismPort != 0 {
-		PrismPort = config.PrismPort
+// WaypointName returns the name of the waypoint used by the mock in ambient.
+func (c *Config) WaypointName() string {
+	if c.Istio.Waypoint != "" {
+		return c.Istio.Waypoint
 	}
-	PrismCPU = defaultPrismCPU
-	if config.PrismCPU != "" {
-		PrismCPU = config.PrismCPU
-	}
-	PrismMemory = defaultPrismMemory
-	if config.PrismMemory != "" {
-		PrismMemory = config.PrismMemory
-	}
-	IstioMode = false
-	if config.IstioMode {
-		IstioMode = config.IstioMode
+	return DefaultWaypointName
+}
+
+// TrafficSplit sends a part of the traffic to the real microservice to the mock. It requires istioMode.
+type TrafficSplit struct {
+	// Weight is the percentage of the traffic sent to the mock, from 0 to 100. No traffic is split if 0.
+	Weight int `yaml:"weight"`
+	// Headers route the requests matching any of them to the mock regardless of Weight
+	Headers []HeaderMatch `yaml:"headers"`
+}
+
+// HeaderMatch matches a request header by one of Exact, Prefix and Regex.
+type HeaderMatch struct {
+	Name   string `yaml:"name"`
+	Exact  string `yaml:"exact"`
+	Prefix string `yaml:"prefix"`
+	// Regex is in the RE2 syntax, e.g. ".*mock=true.*" for a baggage entry
+	Regex string `yaml:"regex"`
+}
+
+// Enabled returns true if any traffic to the real microservice is sent to the mock.
+func (t TrafficSplit) Enabled() bool {
+	return t.Weight > 0 || len(t.Headers) > 0
+}
+
+// TrafficMirror mirrors the traffic to the real microservice to the mock, so that Prism validates it against the OpenAPI definition.
+// The responses of the mock are discarded. It requires istioMode.
+type TrafficMirror struct {
+	// Percentage is the percentage of the requests mirrored, from 0 to 100. No traffic is mirrored if 0.
+	Percentage float64 `yaml:"percentage"`
+}
+
+// Enabled returns true if the traffic to the real microservice is mirrored to the mock.
+func (t TrafficMirror) Enabled() bool {
+	return t.Percentage > 0
+}
+
+// DestinationRule limits the connections to the mock like a real dependency with limited capacity. It requires istioMode.
+// The zero values are left to the defaults of Istio.
+type DestinationRule struct {
+	ConnectionPool   ConnectionPool   `yaml:"connectionPool"`
+	OutlierDetection OutlierDetection `yaml:"outlierDetection"`
+}
+
+type ConnectionPool struct {
+	MaxConnections           int `yaml:"maxConnections"`
+	HTTP1MaxPendingRequests  int `yaml:"http1MaxPendingRequests"`
+	HTTP2MaxRequests         int `yaml:"http2MaxRequests"`
+	MaxRequestsPerConnection int `yaml:"maxRequestsPerConnection"`
+}
+
+type OutlierDetection struct {
+	Consecutive5xxErrors int           `yaml:"consecutive5xxErrors"`
+	Interval             time.Duration `yaml:"interval"`
+	BaseEjectionTime     time.Duration `yaml:"baseEjectionTime"`
+	MaxEjectionPercent   int           `yaml:"maxEjectionPercent"`
+}
+
+// Enabled returns true if any of the settings is set.
+func (d DestinationRule) Enabled() bool {
+	return d != DestinationRule{}
+}
+
+// Route is the behavior of the mock for the matching requests. The first matching route of Routes is used.
+type Route struct {
+	Name  string     `yaml:"name"`
+	Match RouteMatch `yaml:"match"`
+	// Latency is added by the fault proxy in front of Prism, because Istio supports only a fixed delay
+	Latency Latency `yaml:"latency"`
+	// Timeout and Retries are set on the route of the VirtualService of the mock, so the clients get them from their sidecars. They require istioMode.
+	Timeout time.Duration `yaml:"timeout"`
+	Retries Retries       `yaml:"retries"`
+	// Fault is injected by the VirtualService of the mock in istioMode, or by the fault proxy otherwise
+	Fault Fault `yaml:"fault"`
+}
+
+// Fault delays or aborts a percentage of the requests like the fault injection of Istio.
+type Fault struct {
+	Delay FaultDelay `yaml:"delay"`
+	Abort FaultAbort `yaml:"abort"`
+}
+
+type FaultDelay struct {
+	FixedDelay time.Duration `yaml:"fixedDelay"`
+	// Percentage is from 0 to 100. All the requests are delayed if 0.
+	Percentage float64 `yaml:"percentage"`
+}
+
+type FaultAbort struct {
+	HTTPStatus int `yaml:"httpStatus"`
+	// Percentage is from 0 to 100. All the requests are aborted if 0.
+	Percentage float64 `yaml:"percentage"`
+}
+
+// Enabled returns true if the delay or the abort is set.
+func (f Fault) Enabled() bool {
+	return f.Delay.FixedDelay != 0 || f.Abort.HTTPStatus != 0
+}
+
+// AppliedPercentage returns the percentage of the requests delayed.
+func (d FaultDelay) AppliedPercentage() float64 {
+	return appliedPercentage(d.Percentage)
+}
+
+// AppliedPercentage returns the percentage of the requests aborted.
+func (a FaultAbort) AppliedPercentage() float64 {
+	return appliedPercentage(a.Percentage)
+}
+
+func appliedPercentage(percentage float64) float64 {
+	if percentage == 0 {
+		return maxPercentage
 	}
-	IstioProxyCPU = defaultIstioProxyCPU
-	if config.IstioProxyCPU != "" {
-		IstioProxyCPU = config.IstioProxyCPU
+	return percentage
+}
+
+// Retries is the retry policy of the clients. Istio's default policy is used if Attempts is 0.
+type Retries struct {
+	Attempts      int           `yaml:"attempts"`
+	PerTryTimeout time.Duration `yaml:"perTryTimeout"`
+	// RetryOn is the comma separated conditions of Envoy, e.g. "5xx,reset,connect-failure"
+	RetryOn string `yaml:"retryOn"`
+}
+
+// Enabled returns true if the retry policy is set.
+func (r Retries) Enabled() bool {
+	return r != Retries{}
+}
+
+// RouteMatch matches the requests with all of the set fields. An empty one matches all the requests.
+type RouteMatch struct {
+	PathPrefix string `yaml:"pathPrefix"`
+	Method     string `yaml:"method"`
+	// Headers match the exact values of the headers
+	Headers map[string]string `yaml:"headers"`
+}
+
+// Latency is a distribution of the delays, either the percentiles or the mean and the standard deviation of a distribution.
+type Latency struct {
+	P50 time.Duration `yaml:"p50"`
+	P90 time.Duration `yaml:"p90"`
+	P99 time.Duration `yaml:"p99"`
+	// Distribution is normal or lognormal
+	Distribution string        `yaml:"distribution"`
+	Mean         time.Duration `yaml:"mean"`
+	StdDev       time.Duration `yaml:"stddev"`
+}
+
+const (
+	DistributionNormal    = "normal"
+	DistributionLogNormal = "lognormal"
+	// FaultProxyPort is the port of the fault proxy in front of Prism in the same pod
+	FaultProxyPort = 8080
+)
+
+// Enabled returns true if any delay is set.
+func (l Latency) Enabled() bool {
+	return l != Latency{}
+}
+
+// FaultProxyEnabled returns true if the fault proxy is needed in front of Prism.
+func (c *Config) FaultProxyEnabled() bool {
+	for _, route := range c.Routes {
+		if route.Latency.Enabled() || (route.Fault.Enabled() && !c.IstioMode) {
+			return true
+		}
 	}
-	IstioProxyMemory = defaultIstioProxyMemory
-	if config.IstioProxyMemory != "" {
-		IstioProxyMemory = config.IstioProxyMemory
+	return false
+}
+
+// FaultProxyRoutes returns the routes applied by the fault proxy. The faults are left to Istio in istioMode.
+func (c *Config) FaultProxyRoutes() []Route {
+	routes := make([]Route, 0, len(c.Routes))
+	for _, route := range c.Routes {
+		if c.IstioMode {
+			route.Fault = Fault{}
+		}
+		routes = append(routes, route)
 	}
-	PriorityClassName = config.PriorityClassName
-	EcrTags = config.EcrTags
+	return routes
+}
+
+type ECRTag struct {
+	Key   string `yaml:"key"`
+	Value string `yaml:"value"`
 }
 
+// LoadConfig reads the config file and fills the unset optional parameters with their default values.
 func LoadConfig(filename string) (*Config, error) {
 	file, err := os.Open(filename)
 	if err != nil {
@@ -125,21 +300,65 @@ func LoadConfig(filename string) (*Config, error) {
 	if err := decoder.Decode(&config); err != nil {
 		return nil, fmt.Errorf("%w: %w", errFailedToDecodeConfigFile, err)
 	}
+	config.SetDefaults()
 
 	return &config, nil
 }
 
-func ValidateParams() error {
+// SetDefaults fills the unset optional parameters with their default values.
+func (c *Config) SetDefaults() {
+	if c.Timeout == 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.PrismPort == 0 {
+		c.PrismPort = defaultPrismPort
+	}
+	if c.PrismCPU == "" {
+		c.PrismCPU = defaultPrismCPU
+	}
+	if c.PrismMemory == "" {
+		c.PrismMemory = defaultPrismMemory
+	}
+	if c.IstioProxyCPU == "" {
+		c.IstioProxyCPU = defaultIstioProxyCPU
+	}
+	if c.IstioProxyMemory == "" {
+		c.IstioProxyMemory = defaultIstioProxyMemory
+	}
+}
+
+// MicroserviceHost returns the host of the Service of the real microservice.
+func (c *Config) MicroserviceHost() string {
+	return c.MicroserviceName + "." + c.MicroserviceNamespace + ".svc.cluster.local"
+}
+
+// ResourceName returns the name of the mock resources.
+func (c *Config) ResourceName() string {
+	if c.MicroserviceName == "" || c.MicroserviceNamespace == "" {
+		return defaultResourceName
+	}
+	return c.MicroserviceName + c.PrismMockSuffix
+}
+
+// NamespaceName returns the namespace of the mock resources.
+func (c *Config) NamespaceName() string {
+	if c.MicroserviceName == "" || c.MicroserviceNamespace == "" {
+		return defaultNamespaceName
+	}
+	return c.MicroserviceNamespace + c.PrismMockSuffix
+}
+
+func ValidateParams(config *Config) error {
 	params := map[string]interface{}{
-		"microserviceName":      MicroserviceName,
-		"microserviceNamespace": MicroserviceNamespace,
-		"prismMockSuffix":       PrismMockSuffix,
-		"timeout":               Timeout,
-		"prismPort":             PrismPort,
-		"prismCPU":              PrismCPU,
-		"prismMemory":           PrismMemory,
-		"istioProxyCPU":         IstioProxyCPU,
-		"istioProxyMemory":      IstioProxyMemory,
+		"microserviceName":      config.MicroserviceName,
+		"microserviceNamespace": config.MicroserviceNamespace,
+		"prismMockSuffix":       config.PrismMockSuffix,
+		"timeout":               config.Timeout,
+		"prismPort":             config.PrismPort,
+		"prismCPU":              config.PrismCPU,
+		"prismMemory":           config.PrismMemory,
+		"istioProxyCPU":         config.IstioProxyCPU,
+		"istioProxyMemory":      config.IstioProxyMemory,
 	}
 
 	for name, value := range params {
@@ -160,5 +379,172 @@ func ValidateParams() error {
 			return xerrors.Errorf("%w: %s", errUnsupportedParameterType, name)
 		}
 	}
+	return ValidateOptions(config)
+}
+
+// ValidateOptions validates the optional parameters with the defaults set,
+// e.g. of the spec of a PrismMock resource whose names are not given by the parameters.
+func ValidateOptions(config *Config) error {
+	if config.PrismPort <= 0 || config.PrismPort > maxPort {
+		return xerrors.Errorf("%w: prismPort must be from 1 to %d: %d", errInvalidParameter, maxPort, config.PrismPort)
+	}
+	quantities := map[string]string{
+		"prismCpu":         config.PrismCPU,
+		"prismMemory":      config.PrismMemory,
+		"istioProxyCpu":    config.IstioProxyCPU,
+		"istioProxyMemory": config.IstioProxyMemory,
+	}
+	for name, quantity := range quantities {
+		if _, err := resource.ParseQuantity(quantity); err != nil {
+			return xerrors.Errorf("%w: %s must be a quantity, e.g. 500m or 512Mi: %q", errInvalidParameter, name, quantity)
+		}
+	}
+	if config.TTL < 0 {
+		// the mock would be expired as soon as it is created and deleted by the next gc
+		return xerrors.Errorf("%w: ttl must not be negative: %s", errInvalidParameter, config.TTL)
+	}
+	if config.IstioRevision != "" && !config.IstioMode {
+		return xerrors.Errorf("%w: istioRevision requires istioMode", errInvalidParameter)
+	}
+	switch config.Istio.Dataplane {
+	case "", DataplaneSidecar:
+		if config.Istio.Waypoint != "" || config.Istio.WaypointNamespace != "" {
+			return xerrors.Errorf("%w: istio.waypoint requires istio.dataplane %s", errInvalidParameter, DataplaneAmbient)
+		}
+	case DataplaneAmbient:
+		if !config.IstioMode {
+			return xerrors.Errorf("%w: istio.dataplane %s requires istioMode", errInvalidParameter, DataplaneAmbient)
+		}
+		if config.Istio.Waypoint == "" && config.Istio.WaypointNamespace != "" {
+			return xerrors.Errorf("%w: istio.waypointNamespace requires istio.waypoint", errInvalidParameter)
+		}
+	default:
+		return xerrors.Errorf("%w: istio.dataplane must be %s or %s: %s", errInvalidParameter, DataplaneSidecar, DataplaneAmbient, config.Istio.Dataplane)
+	}
+	if weight := config.TrafficSplit.Weight; weight < 0 || weight > maxPercentage {
+		return xerrors.Errorf("%w: trafficSplit.weight must be from 0 to %d: %d", errInvalidParameter, maxPercentage, weight)
+	}
+	for i, header := range config.TrafficSplit.Headers {
+		matchers := 0
+		for _, matcher := range []string{header.Exact, header.Prefix, header.Regex} {
+			if matcher != "" {
+				matchers++
+			}
+		}
+		if header.Name == "" || matchers != 1 {
+			return xerrors.Errorf("%w: trafficSplit.headers[%d] must have a name and one of exact, prefix and regex", errInvalidParameter, i)
+		}
+	}
+	if config.TrafficSplit.Enabled() && !config.IstioMode {
+		return xerrors.Errorf("%w: trafficSplit requires istioMode", errInvalidParameter)
+	}
+	if percentage := config.TrafficMirror.Percentage; percentage < 0 || percentage > maxPercentage {
+		return xerrors.Errorf("%w: trafficMirror.percentage must be from 0 to %d: %g", errInvalidParameter, maxPercentage, percentage)
+	}
+	if config.TrafficMirror.Enabled() && !config.IstioMode {
+		return xerrors.Errorf("%w: trafficMirror requires istioMode", errInvalidParameter)
+	}
+	if err := validateDestinationRule(config.DestinationRule); err != nil {
+		return err
+	}
+	if config.DestinationRule.Enabled() && !config.IstioMode {
+		return xerrors.Errorf("%w: destinationRule requires istioMode", errInvalidParameter)
+	}
+	for i, route := range config.Routes {
+		if err := validateLatency(route.Latency); err != nil {
+			return xerrors.Errorf("routes[%d].latency: %w", i, err)
+		}
+		if err := validateRetries(route.Retries); err != nil {
+			return xerrors.Errorf("routes[%d].retries: %w", i, err)
+		}
+		if err := validateFault(route.Fault); err != nil {
+			return xerrors.Errorf("routes[%d].fault: %w", i, err)
+		}
+		if route.Timeout < 0 {
+			return xerrors.Errorf("%w: routes[%d].timeout must not be negative", errInvalidParameter, i)
+		}
+		if (route.Timeout != 0 || route.Retries.Enabled()) && !config.IstioMode {
+			return xerrors.Errorf("%w: routes[%d].timeout and retries require istioMode", errInvalidParameter, i)
+		}
+	}
+	if config.FaultProxyEnabled() && config.PrismPort == FaultProxyPort {
+		return xerrors.Errorf("%w: prismPort %d is used by the fault proxy", errInvalidParameter, FaultProxyPort)
+	}
+	return nil
+}
+
+func validateDestinationRule(destinationRule DestinationRule) error {
+	connectionPool, outlierDetection := destinationRule.ConnectionPool, destinationRule.OutlierDetection
+	numbers := map[string]int{
+		"connectionPool.maxConnections":           connectionPool.MaxConnections,
+		"connectionPool.http1MaxPendingRequests":  connectionPool.HTTP1MaxPendingRequests,
+		"connectionPool.http2MaxRequests":         connectionPool.HTTP2MaxRequests,
+		"connectionPool.maxRequestsPerConnection": connectionPool.MaxRequestsPerConnection,
+		"outlierDetection.consecutive5xxErrors":   outlierDetection.Consecutive5xxErrors,
+		"outlierDetection.maxEjectionPercent":     outlierDetection.MaxEjectionPercent,
+	}
+	for name, number := range numbers {
+		if number < 0 {
+			return xerrors.Errorf("%w: destinationRule.%s must not be negative: %d", errInvalidParameter, name, number)
+		}
+	}
+	if outlierDetection.Interval < 0 || outlierDetection.BaseEjectionTime < 0 {
+		return xerrors.Errorf("%w: the durations of destinationRule.outlierDetection must not be negative", errInvalidParameter)
+	}
+	if outlierDetection.MaxEjectionPercent > maxPercentage {
+		return xerrors.Errorf("%w: destinationRule.outlierDetection.maxEjectionPercent must be up to %d: %d", errInvalidParameter, maxPercentage, outlierDetection.MaxEjectionPercent)
+	}
+	return nil
+}
+
+func validateRetries(retries Retries) error {
+	if retries.Attempts < 0 || retries.PerTryTimeout < 0 {
+		return xerrors.Errorf("%w: attempts and perTryTimeout must not be negative", errInvalidParameter)
+	}
+	if retries.Enabled() && retries.Attempts == 0 {
+		return xerrors.Errorf("%w: perTryTimeout and retryOn need attempts", errInvalidParameter)
+	}
+	for _, condition := range strings.Split(retries.RetryOn, ",") {
+		if retries.RetryOn != "" && strings.TrimSpace(condition) == "" {
+			return xerrors.Errorf("%w: empty condition in retryOn %q", errInvalidParameter, retries.RetryOn)
+		}
+	}
+	return nil
+}
+
+func validateFault(fault Fault) error {
+	delay, abort := fault.Delay, fault.Abort
+	if delay.FixedDelay < 0 || (delay.FixedDelay == 0 && delay.Percentage != 0) {
+		return xerrors.Errorf("%w: delay needs a positive fixedDelay", errInvalidParameter)
+	}
+	if (abort.HTTPStatus == 0 && abort.Percentage != 0) || (abort.HTTPStatus != 0 && (abort.HTTPStatus < http.StatusOK || abort.HTTPStatus > maxHTTPStatus)) {
+		return xerrors.Errorf("%w: abort needs an httpStatus from %d to %d: %d", errInvalidParameter, http.StatusOK, maxHTTPStatus, abort.HTTPStatus)
+	}
+	for _, percentage := range []float64{delay.Percentage, abort.Percentage} {
+		if percentage < 0 || percentage > maxPercentage {
+			return xerrors.Errorf("%w: percentage must be from 0 to %d: %g", errInvalidParameter, maxPercentage, percentage)
+		}
+	}
+	return nil
+}
+
+func validateLatency(latency Latency) error {
+	percentiles := latency.P50 != 0 || latency.P90 != 0 || latency.P99 != 0
+	switch {
+	case percentiles && latency.Distribution != "":
+		return xerrors.Errorf("%w: either the percentiles or the distribution can be set", errInvalidParameter)
+	case percentiles:
+		if latency.P50 < 0 || latency.P90 < latency.P50 || latency.P99 < latency.P90 {
+			return xerrors.Errorf("%w: the percentiles must be 0 <= p50 <= p90 <= p99", errInvalidParameter)
+		}
+	case latency.Distribution == DistributionNormal || latency.Distribution == DistributionLogNormal:
+		if latency.Mean <= 0 || latency.StdDev < 0 {
+			return xerrors.Errorf("%w: the distribution needs a positive mean and a non-negative stddev", errInvalidParameter)
+		}
+	case latency.Distribution != "":
+		return xerrors.Errorf("%w: unknown distribution %q, normal or lognormal", errInvalidParameter, latency.Distribution)
+	case latency.Mean != 0 || latency.StdDev != 0:
+		return xerrors.Errorf("%w: mean and stddev need a distribution", errInvalidParameter)
+	}
 	return nil
 }
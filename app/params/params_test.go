@@ -0,0 +1,76 @@
+package params_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/stretchr/testify/require"
+)
+
+func newConfig() *params.Config {
+	config := &params.Config{
+		MicroserviceName:      "sample",
+		MicroserviceNamespace: "sample",
+		PrismMockSuffix:       "-prism-mock",
+	}
+	config.SetDefaults()
+	return config
+}
+
+func TestValidateParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(config *params.Config)
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			modify: func(*params.Config) {},
+		},
+		{
+			name: "ttl",
+			modify: func(config *params.Config) {
+				config.TTL = 72 * time.Hour
+			},
+		},
+		{
+			name: "negative ttl",
+			modify: func(config *params.Config) {
+				config.TTL = -time.Hour
+			},
+			wantErr: true,
+		},
+		{
+			name: "port out of range",
+			modify: func(config *params.Config) {
+				config.PrismPort = 70000
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid quantity",
+			modify: func(config *params.Config) {
+				config.PrismCPU = "half"
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newConfig()
+			tt.modify(config)
+
+			// test target
+			err := params.ValidateParams(config)
+
+			// verify
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+// Package prismlog parses the request logs of Prism.
+// It supports both the default pretty format and JSON lines of pino.
+package prismlog
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	httpServerLogger = "HTTP SERVER"
+	requestReceived  = "Request received"
+	violationPrefix  = "Violation: "
+	maxStatusCode    = 599
+	minStatusCode    = 100
+	pinoLevelDebug   = 20
+	pinoLevelInfo    = 30
+	pinoLevelWarning = 40
+	pinoLevelError   = 50
+	// staleRequestTimeout is how long a request can be open until it is given up as incomplete
+	staleRequestTimeout = 1 * time.Minute
+)
+
+var (
+	ansiPattern = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+	// e.g. "[10:00:00 AM] › [HTTP SERVER] get /users ℹ  info      Request received"
+	prettyPattern = regexp.MustCompile(`^\[[^\]]+\]\s+›\s+\[([A-Z ]+)\]\s*(?:([a-z]+) (\S+) )?\S+\s+([a-z]+)\s+(.*)$`)
+	statusPattern = regexp.MustCompile(`status code (\d{3})`)
+	errorPattern  = regexp.MustCompile(`errors#([A-Z_]+)`)
+	// statuses of the Prism errors, see https://docs.stoplight.io/docs/prism/ZG9jOjE1MTY5Njk0-errors
+	errorStatuses = map[string]int{
+		"NO_PATH_MATCHED_ERROR":       404,
+		"NO_SERVER_MATCHED_ERROR":     404,
+		"NO_METHOD_MATCHED_ERROR":     405,
+		"NO_SERVER_CONFIGURATION":     404,
+		"UNPROCESSABLE_ENTITY":        422,
+		"NOT_ACCEPTABLE":              406,
+		"NOT_FOUND":                   404,
+		"UNAUTHORIZED":                401,
+		"INVALID_CONTENT_TYPE":        415,
+		"NO_RESPONSE_DEFINED":         500,
+		"NO_COMPLEX_OBJECT_TEXT":      500,
+		"SCHEMA_TOO_COMPLEX":          500,
+		"UNKNOWN":                     500,
+		"INVALID_FORMAT":              500,
+		"NO_SUCCESS_RESPONSE_DEFINED": 500,
+	}
+)
+
+// Entry is a log line of Prism.
+type Entry struct {
+	Logger  string
+	Level   string
+	Message string
+	// Method and Path are set on the lines of HTTP SERVER
+	Method string
+	Path   string
+	// Time is set by JSON lines only, the pretty format has the clock only
+	Time time.Time
+}
+
+// Violation is a contract violation of a request or a response reported by the validator of Prism.
+type Violation struct {
+	// Location is e.g. request.body, request.query or response.header
+	Location string
+	Message  string
+	Level    string
+}
+
+// Request is a request handled by Prism with the violations found in it.
+type Request struct {
+	Pod    string
+	Time   time.Time
+	Method string
+	Path   string
+	Status int
+	// Error is the code of the Prism error the request is terminated with, e.g. NO_PATH_MATCHED_ERROR
+	Error      string
+	Violations []Violation
+	// Incomplete is true if the lines of the request could not be attributed to it for sure,
+	// e.g. another request was received before its response. Status is 0 if unknown, and Violations may be missing.
+	Incomplete bool
+}
+
+// ParseLine parses a line of the Prism log. It returns false if the line is not a log of Prism.
+func ParseLine(line string) (Entry, bool) {
+	line = strings.TrimSpace(ansiPattern.ReplaceAllString(line, ""))
+	if strings.HasPrefix(line, "{") {
+		return parseJSONLine(line)
+	}
+	matches := prettyPattern.FindStringSubmatch(line)
+	if matches == nil {
+		return Entry{}, false
+	}
+	return Entry{
+		Logger:  strings.TrimSpace(matches[1]),
+		Method:  strings.ToUpper(matches[2]),
+		Path:    matches[3],
+		Level:   matches[4],
+		Message: strings.TrimSpace(matches[5]),
+	}, true
+}
+
+func parseJSONLine(line string) (Entry, bool) {
+	var record struct {
+		Level int    `json:"level"`
+		Time  int64  `json:"time"`
+		Name  string `json:"name"`
+		Msg   string `json:"msg"`
+		Input *struct {
+			Method string `json:"method"`
+			URL    struct {
+				Path string `json:"path"`
+			} `json:"url"`
+		} `json:"input"`
+	}
+	if err := json.Unmarshal([]byte(line), &record); err != nil || record.Msg == "" {
+		return Entry{}, false
+	}
+	entry := Entry{
+		Logger:  record.Name,
+		Level:   pinoLevel(record.Level),
+		Message: record.Msg,
+	}
+	if record.Time != 0 {
+		entry.Time = time.UnixMilli(record.Time).UTC()
+	}
+	if record.Input != nil {
+		entry.Method = strings.ToUpper(record.Input.Method)
+		entry.Path = record.Input.URL.Path
+	}
+	return entry, true
+}
+
+func pinoLevel(level int) string {
+	switch {
+	case level >= pinoLevelError:
+		return "error"
+	case level >= pinoLevelWarning:
+		return "warning"
+	case level >= pinoLevelInfo:
+		return "info"
+	case level >= pinoLevelDebug:
+		return "debug"
+	default:
+		return "trace"
+	}
+}
+
+// Violation returns the violation reported by the entry.
+func (e Entry) Violation() (Violation, bool) {
+	if !strings.HasPrefix(e.Message, violationPrefix) {
+		return Violation{}, false
+	}
+	location, message, _ := strings.Cut(strings.TrimPrefix(e.Message, violationPrefix), " ")
+	return Violation{Location: location, Message: message, Level: e.Level}, true
+}
+
+// Status returns the status code of the response reported by the entry.
+func (e Entry) Status() (int, bool) {
+	if matches := statusPattern.FindStringSubmatch(e.Message); matches != nil {
+		status, err := strconv.Atoi(matches[1])
+		if err == nil && status >= minStatusCode && status <= maxStatusCode {
+			return status, true
+		}
+	}
+	if code, ok := e.Error(); ok {
+		if status, ok := errorStatuses[code]; ok {
+			return status, true
+		}
+	}
+	return 0, false
+}
+
+// Error returns the code of the Prism error reported by the entry.
+func (e Entry) Error() (string, bool) {
+	matches := errorPattern.FindStringSubmatch(e.Message)
+	if matches == nil {
+		return "", false
+	}
+	return matches[1], true
+}
+
+// Assembler groups the entries of a pod into requests.
+//
+// Prism handles the requests concurrently, but only the lines of HTTP SERVER have the method and the path of the request.
+// While more than one request is open, the other lines, e.g. the violations and the response status, cannot be attributed,
+// so the overlapping requests are returned as incomplete instead of taking the lines of another request.
+type Assembler struct {
+	pod string
+	// open are the requests received without the response yet, in order
+	open []*Request
+	// overlapped is true since a request is received while another is open, until no request is open
+	overlapped bool
+}
+
+func NewAssembler(pod string) *Assembler {
+	return &Assembler{pod: pod}
+}
+
+// Add adds the entry logged at the time, and returns the requests completed by it.
+// A request is completed by its response status, or is given up as incomplete if it is open for staleRequestTimeout.
+func (a *Assembler) Add(entry Entry, at time.Time) []*Request {
+	if !entry.Time.IsZero() {
+		at = entry.Time
+	}
+	if entry.Logger == httpServerLogger && entry.Message == requestReceived {
+		completed := a.giveUpStale(at)
+		if len(a.open) > 0 {
+			a.overlapped = true
+		}
+		a.open = append(a.open, &Request{
+			Pod:        a.pod,
+			Time:       at,
+			Method:     entry.Method,
+			Path:       entry.Path,
+			Violations: []Violation{},
+		})
+		return completed
+	}
+	if len(a.open) == 0 {
+		return nil
+	}
+
+	// the lines with the method and the path are attributed even while the requests overlap
+	correlated := entry.Method != ""
+	request := a.open[0]
+	if correlated {
+		request = a.find(entry.Method, entry.Path)
+		if request == nil {
+			return nil
+		}
+	}
+	attributable := correlated || !a.overlapped
+
+	if violation, ok := entry.Violation(); ok {
+		if attributable {
+			request.Violations = append(request.Violations, violation)
+		}
+		return nil
+	}
+	status, ok := entry.Status()
+	if !ok {
+		return nil
+	}
+	// otherwise one of the open requests is responded but which one is unknown, so the oldest is completed without the status
+	if attributable {
+		request.Status = status
+		if code, ok := entry.Error(); ok {
+			request.Error = code
+		}
+	}
+	return []*Request{a.complete(request)}
+}
+
+// Flush returns the open requests as incomplete, e.g. at the end of the logs.
+func (a *Assembler) Flush() []*Request {
+	completed := []*Request{}
+	for len(a.open) > 0 {
+		a.overlapped = true
+		completed = append(completed, a.complete(a.open[0]))
+	}
+	return completed
+}
+
+func (a *Assembler) find(method, path string) *Request {
+	for _, request := range a.open {
+		if request.Method == method && request.Path == path {
+			return request
+		}
+	}
+	return nil
+}
+
+func (a *Assembler) giveUpStale(at time.Time) []*Request {
+	completed := []*Request{}
+	for len(a.open) > 0 && at.Sub(a.open[0].Time) > staleRequestTimeout {
+		a.open[0].Incomplete = true
+		completed = append(completed, a.complete(a.open[0]))
+	}
+	return completed
+}
+
+// complete removes the request from the open requests.
+func (a *Assembler) complete(request *Request) *Request {
+	if a.overlapped {
+		request.Incomplete = true
+	}
+	for i, open := range a.open {
+		if open == request {
+			a.open = append(a.open[:i], a.open[i+1:]...)
+			break
+		}
+	}
+	if len(a.open) == 0 {
+		a.overlapped = false
+	}
+	return request
+}
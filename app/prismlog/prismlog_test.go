@@ -0,0 +1,200 @@
+package prismlog_test
+
+import (
+	"bufio"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/prismlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assemble(t *testing.T, path string) []*prismlog.Request {
+	t.Helper()
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	at := time.Date(2024, 1, 2, 1, 0, 0, 0, time.UTC)
+	assembler := prismlog.NewAssembler("pod")
+	requests := []*prismlog.Request{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry, ok := prismlog.ParseLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		requests = append(requests, assembler.Add(entry, at)...)
+	}
+	require.NoError(t, scanner.Err())
+	return append(requests, assembler.Flush()...)
+}
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		want  prismlog.Entry
+		valid bool
+	}{
+		{
+			name:  "pretty request",
+			line:  "[1:00:02 AM] › [HTTP SERVER] get /users ℹ  info      Request received",
+			want:  prismlog.Entry{Logger: "HTTP SERVER", Level: "info", Message: "Request received", Method: "GET", Path: "/users"},
+			valid: true,
+		},
+		{
+			name:  "pretty violation with colors",
+			line:  "\x1b[90m[1:00:03 AM]\x1b[39m › \x1b[90m    [VALIDATOR]\x1b[39m \x1b[31m✖  error\x1b[39m     Violation: request.body Request body must have required property 'name'",
+			want:  prismlog.Entry{Logger: "VALIDATOR", Level: "error", Message: "Violation: request.body Request body must have required property 'name'"},
+			valid: true,
+		},
+		{
+			name:  "json",
+			line:  `{"level":50,"time":1704157203001,"name":"VALIDATOR","msg":"Violation: request.body Request body must have required property 'name'"}`,
+			want:  prismlog.Entry{Logger: "VALIDATOR", Level: "error", Message: "Violation: request.body Request body must have required property 'name'", Time: time.UnixMilli(1704157203001).UTC()},
+			valid: true,
+		},
+		{
+			name: "not prism",
+			line: "2024-01-02T01:00:00Z some other output",
+		},
+		{
+			name: "json without msg",
+			line: `{"level":30}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, ok := prismlog.ParseLine(tt.line)
+			assert.Equal(t, tt.valid, ok)
+			assert.Equal(t, tt.want, entry)
+		})
+	}
+}
+
+func TestAssemblerPretty(t *testing.T) {
+	requests := assemble(t, "testdata/pretty.log")
+
+	require.Len(t, requests, 7)
+	assert.Equal(t, "GET", requests[0].Method)
+	assert.Equal(t, "/users", requests[0].Path)
+	assert.Equal(t, 200, requests[0].Status)
+	assert.Empty(t, requests[0].Violations)
+	assert.Empty(t, requests[0].Error)
+
+	assert.Equal(t, "POST", requests[1].Method)
+	assert.Equal(t, 422, requests[1].Status)
+	assert.Equal(t, []prismlog.Violation{
+		{Location: "request.body", Message: "Request body must have required property 'name'", Level: "error"},
+		{Location: "request.header.x-api-key", Message: "Request header must have required property 'x-api-key'", Level: "error"},
+	}, requests[1].Violations)
+
+	assert.Equal(t, "/unknown", requests[2].Path)
+	assert.Equal(t, 404, requests[2].Status)
+	assert.Equal(t, "NO_PATH_MATCHED_ERROR", requests[2].Error)
+	for _, request := range requests[:3] {
+		assert.False(t, request.Incomplete)
+	}
+
+	// the lines of the overlapping requests cannot be attributed
+	for _, request := range requests[3:5] {
+		assert.True(t, request.Incomplete)
+		assert.Zero(t, request.Status)
+		assert.Empty(t, request.Violations)
+	}
+	assert.Equal(t, "GET", requests[3].Method)
+	assert.Equal(t, "POST", requests[4].Method)
+
+	assert.False(t, requests[5].Incomplete)
+	assert.Equal(t, 200, requests[5].Status)
+
+	// no response at the end of the logs
+	assert.True(t, requests[6].Incomplete)
+	assert.Zero(t, requests[6].Status)
+}
+
+func TestAssemblerOverlap(t *testing.T) {
+	at := time.Date(2024, 1, 2, 1, 0, 0, 0, time.UTC)
+	received := func(method, path string) prismlog.Entry {
+		return prismlog.Entry{Logger: "HTTP SERVER", Level: "info", Message: "Request received", Method: method, Path: path}
+	}
+	responded := prismlog.Entry{Logger: "NEGOTIATOR", Level: "info", Message: "Responding with the requested status code 200"}
+
+	t.Run("terminated with error while overlapped", func(t *testing.T) {
+		assembler := prismlog.NewAssembler("pod")
+		assert.Empty(t, assembler.Add(received("GET", "/users"), at))
+		assert.Empty(t, assembler.Add(received("GET", "/unknown"), at))
+
+		// test target
+		requests := assembler.Add(prismlog.Entry{
+			Logger:  "HTTP SERVER",
+			Level:   "error",
+			Message: "Request terminated with error: https://stoplight.io/prism/errors#NO_PATH_MATCHED_ERROR: Route not resolved, no path matched",
+			Method:  "GET",
+			Path:    "/unknown",
+		}, at)
+
+		// verify
+		require.Len(t, requests, 1)
+		// the line has the method and the path, so the status is of the request
+		assert.Equal(t, "/unknown", requests[0].Path)
+		assert.Equal(t, 404, requests[0].Status)
+		assert.Equal(t, "NO_PATH_MATCHED_ERROR", requests[0].Error)
+		assert.True(t, requests[0].Incomplete)
+
+		requests = assembler.Add(responded, at)
+		require.Len(t, requests, 1)
+		assert.Equal(t, "/users", requests[0].Path)
+		assert.True(t, requests[0].Incomplete)
+	})
+
+	t.Run("stale request", func(t *testing.T) {
+		assembler := prismlog.NewAssembler("pod")
+		assert.Empty(t, assembler.Add(received("GET", "/users"), at))
+
+		// test target
+		requests := assembler.Add(received("GET", "/users/1"), at.Add(2*time.Minute))
+
+		// verify
+		require.Len(t, requests, 1)
+		assert.Equal(t, "/users", requests[0].Path)
+		assert.True(t, requests[0].Incomplete)
+		// the next request does not overlap with the stale one
+		requests = assembler.Add(responded, at.Add(2*time.Minute))
+		require.Len(t, requests, 1)
+		assert.Equal(t, "/users/1", requests[0].Path)
+		assert.Equal(t, 200, requests[0].Status)
+		assert.False(t, requests[0].Incomplete)
+	})
+}
+
+func TestAssemblerJSON(t *testing.T) {
+	requests := assemble(t, "testdata/json.log")
+
+	require.Len(t, requests, 4)
+	assert.Equal(t, 200, requests[0].Status)
+	assert.Equal(t, time.UnixMilli(1704157202000).UTC(), requests[0].Time)
+	assert.Equal(t, "POST", requests[1].Method)
+	assert.Equal(t, 422, requests[1].Status)
+	require.Len(t, requests[1].Violations, 1)
+	assert.Equal(t, "request.body", requests[1].Violations[0].Location)
+	for _, request := range requests[:2] {
+		assert.False(t, request.Incomplete)
+	}
+
+	// the error line has the method and the path, so it is attributed to the overlapping request
+	assert.Equal(t, "/unknown", requests[2].Path)
+	assert.Equal(t, 404, requests[2].Status)
+	assert.Equal(t, "NO_PATH_MATCHED_ERROR", requests[2].Error)
+	assert.Equal(t, "/users", requests[3].Path)
+	assert.Zero(t, requests[3].Status)
+	// the violation cannot be attributed
+	for _, request := range requests[2:] {
+		assert.True(t, request.Incomplete)
+		assert.Empty(t, request.Violations)
+	}
+}
@@ -0,0 +1,309 @@
+// Package prismmock creates, deletes and inspects Prism mocks in a Kubernetes cluster.
+// It is the library behind the prism-mock CLI and can be used from Go programs and tests without any config file.
+package prismmock
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/istio"
+	"github.com/gold-kou/prism-in-k8s/app/k8s"
+	"github.com/gold-kou/prism-in-k8s/app/openapi"
+	"github.com/gold-kou/prism-in-k8s/app/ownership"
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"golang.org/x/xerrors"
+	"istio.io/client-go/pkg/clientset/versioned"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const waitInterval = 1 * time.Second
+
+var (
+	errNoKubeClient  = errors.New("KubeClient is required")
+	errNoIstioClient = errors.New("IstioClient is required in istioMode")
+	errNoDynamic     = errors.New("DynamicClient is required to deploy and delete the waypoint in ambient")
+	errNoImage       = errors.New("one of OpenAPI, Image and Registry is required")
+	errNoFaultProxy  = errors.New("faultProxyImage or a Registry implementing FaultProxyRegistry is required for the latency of the routes")
+	errSameNamespace = errors.New("the namespace of the mock must differ from microserviceNamespace")
+)
+
+// Mock is the spec of a mock. It has the same parameters as config/params.yaml.
+type Mock struct {
+	params.Config `yaml:",inline"`
+	// OpenAPI is the OpenAPI definition mounted into the upstream Prism image via a ConfigMap
+	OpenAPI string `yaml:"openapi"`
+	// Image is a Prism image with the OpenAPI definition built in. If OpenAPI and Image are empty, Registry builds one.
+	Image           string            `yaml:"image"`
+	ImagePullPolicy corev1.PullPolicy `yaml:"-"`
+	// SpecHash identifies the OpenAPI definition built in Image. It is computed if OpenAPI is set.
+	SpecHash string `yaml:"-"`
+}
+
+// Registry builds the Prism image with the OpenAPI definition of Dockerfile.prism.
+type Registry interface {
+	// BuildAndPush returns the pushed image
+	BuildAndPush(ctx context.Context, repositoryName string) (string, error)
+	Delete(ctx context.Context, repositoryName string) error
+}
+
+// FaultProxyRegistry is implemented by the registries which also build the image of cmd/faultproxy from Dockerfile.faultproxy.
+type FaultProxyRegistry interface {
+	// BuildAndPushFaultProxy returns the pushed image
+	BuildAndPushFaultProxy(ctx context.Context, repositoryName string) (string, error)
+}
+
+// Options are the dependencies of Client.
+type Options struct {
+	KubeClient kubernetes.Interface
+	// IstioClient is required if istioMode is enabled
+	IstioClient versioned.Interface
+	// DynamicClient is required to deploy and delete the waypoint if istio.dataplane is ambient and istio.waypoint is empty.
+	// If set, Delete deletes the waypoint of the mock whatever the dataplane is.
+	DynamicClient dynamic.Interface
+	// Registry is optional. If nil, Mock.OpenAPI or Mock.Image must be set and no repository is deleted.
+	Registry Registry
+	// Creator is recorded in the ownership annotations
+	Creator string
+}
+
+// Client manages mocks with the given clients.
+type Client struct {
+	options Options
+}
+
+// Status is the state of a mock in the cluster.
+type Status struct {
+	Namespace     string
+	Name          string
+	Exists        bool
+	Replicas      int32
+	ReadyReplicas int32
+	Ready         bool
+	// URL is the base URL of the mock inside the cluster
+	URL string
+}
+
+func New(options Options) (*Client, error) {
+	if options.KubeClient == nil {
+		return nil, errNoKubeClient
+	}
+	return &Client{options: options}, nil
+}
+
+// Names returns the namespace and the name of the mock resources.
+func (m *Mock) Names() (string, string) {
+	config := m.config()
+	return config.NamespaceName(), config.ResourceName()
+}
+
+// URL returns the base URL of the mock inside the cluster.
+func (m *Mock) URL() string {
+	namespaceName, resourceName := m.Names()
+	return "http://" + resourceName + "." + namespaceName + ".svc.cluster.local"
+}
+
+// config returns a copy of the parameters with the default values.
+func (m *Mock) config() *params.Config {
+	config := m.Config
+	config.SetDefaults()
+	return &config
+}
+
+// Create creates the image if needed, the Kubernetes resources and the Istio resources of the mock.
+// Existing resources are left as they are.
+func (c *Client) Create(ctx context.Context, mock *Mock) error {
+	config := mock.config()
+	if err := validate(config); err != nil {
+		return err
+	}
+	namespaceName, resourceName := mock.Names()
+	if config.IstioMode && c.options.IstioClient == nil {
+		return errNoIstioClient
+	}
+	if config.Ambient() && config.Istio.Waypoint == "" && c.options.DynamicClient == nil {
+		return errNoDynamic
+	}
+	if mock.OpenAPI != "" {
+		// fail before creating anything rather than letting Prism crash-loop
+		if err := ValidateOpenAPI(mock.OpenAPI); err != nil {
+			return err
+		}
+	}
+
+	options := k8s.DeploymentOptions{
+		Image:           mock.Image,
+		ImagePullPolicy: mock.ImagePullPolicy,
+		OpenAPI:         mock.OpenAPI,
+		Owner: ownership.Owner{
+			Creator:  c.options.Creator,
+			SpecHash: mock.SpecHash,
+		},
+	}
+	if config.TTL != 0 {
+		options.Owner.ExpiresAt = metav1.Now().Add(config.TTL)
+	}
+	if mock.OpenAPI == "" && mock.Image == "" {
+		if c.options.Registry == nil {
+			return errNoImage
+		}
+		image, err := c.options.Registry.BuildAndPush(ctx, resourceName)
+		if err != nil {
+			return xerrors.Errorf("failed to build image: %w", err)
+		}
+		options.Image = image
+		options.Owner.Repository = resourceName
+	}
+
+	options.FaultProxyImage = config.FaultProxyImage
+	if config.FaultProxyEnabled() && options.FaultProxyImage == "" {
+		registry, ok := c.options.Registry.(FaultProxyRegistry)
+		if !ok {
+			return errNoFaultProxy
+		}
+		image, err := registry.BuildAndPushFaultProxy(ctx, resourceName)
+		if err != nil {
+			return xerrors.Errorf("failed to build fault proxy image: %w", err)
+		}
+		options.FaultProxyImage = image
+		options.Owner.Repository = resourceName
+	}
+
+	err := k8s.CreateK8sResources(ctx, c.options.KubeClient, config, namespaceName, resourceName, options)
+	if err != nil {
+		return xerrors.Errorf("failed to create k8s resources: %w", err)
+	}
+
+	if config.Ambient() {
+		err = istio.CreateWaypoint(ctx, c.options.DynamicClient, config, namespaceName)
+		if err != nil {
+			return xerrors.Errorf("failed to create waypoint: %w", err)
+		}
+		if config.TrafficSplit.Enabled() || config.TrafficMirror.Enabled() {
+			log.Println("[WARN] The traffic split and the mirror take effect only if the real microservice also uses a waypoint in ambient")
+		}
+	}
+	if config.IstioMode {
+		err = istio.CreateIstioResources(ctx, c.options.IstioClient, config, namespaceName, resourceName)
+		if err != nil {
+			return xerrors.Errorf("failed to create Istio resources: %w", err)
+		}
+	}
+	log.Println("[INFO] All resources for prism mock are created successfully")
+	return nil
+}
+
+// Delete deletes the resources created by Create. Missing resources are ignored.
+// The namespace is deleted only if it is created by Create.
+func (c *Client) Delete(ctx context.Context, mock *Mock) error {
+	config := mock.config()
+	if err := validate(config); err != nil {
+		return err
+	}
+	namespaceName, resourceName := mock.Names()
+
+	if config.IstioMode {
+		if c.options.IstioClient == nil {
+			return errNoIstioClient
+		}
+		err := istio.DeleteIstioResources(ctx, c.options.IstioClient, namespaceName, resourceName)
+		if err != nil {
+			return xerrors.Errorf("failed to delete Istio resources: %w", err)
+		}
+	}
+	// the waypoint is deleted regardless of the dataplane because the mock may have been created with another config
+	switch {
+	case c.options.DynamicClient != nil:
+		err := istio.DeleteWaypoint(ctx, c.options.DynamicClient, namespaceName)
+		if err != nil {
+			return xerrors.Errorf("failed to delete waypoint: %w", err)
+		}
+	case config.Ambient() && config.Istio.Waypoint == "":
+		return errNoDynamic
+	}
+
+	err := k8s.DeleteK8sResources(ctx, c.options.KubeClient, namespaceName, resourceName, config.PrismMockSuffix)
+	if err != nil {
+		return xerrors.Errorf("failed to delete k8s resources: %w", err)
+	}
+
+	if c.options.Registry != nil {
+		err = c.options.Registry.Delete(ctx, resourceName)
+		if err != nil {
+			return xerrors.Errorf("failed to delete image: %w", err)
+		}
+	}
+	log.Println("[INFO] All resources for prism mock are deleted successfully")
+	return nil
+}
+
+// validate validates the parameters, so that the resources of the real microservice are never created or deleted as the mock.
+func validate(config *params.Config) error {
+	if err := params.ValidateParams(config); err != nil {
+		return err //nolint:wrapcheck // already wrapped
+	}
+	if config.NamespaceName() == config.MicroserviceNamespace {
+		return xerrors.Errorf("%w: %s", errSameNamespace, config.MicroserviceNamespace)
+	}
+	return nil
+}
+
+// Status returns the state of the mock Deployment.
+func (c *Client) Status(ctx context.Context, mock *Mock) (*Status, error) {
+	namespaceName, resourceName := mock.Names()
+	status := &Status{
+		Namespace: namespaceName,
+		Name:      resourceName,
+		URL:       mock.URL(),
+	}
+
+	deployment, err := c.options.KubeClient.AppsV1().Deployments(namespaceName).Get(ctx, resourceName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return status, nil
+		}
+		return nil, xerrors.Errorf("failed to get deployment: %w", err)
+	}
+
+	status.Exists = true
+	status.Replicas = deployment.Status.Replicas
+	status.ReadyReplicas = deployment.Status.ReadyReplicas
+	if deployment.Spec.Replicas != nil {
+		status.Ready = deployment.Status.UpdatedReplicas == *deployment.Spec.Replicas && deployment.Status.ReadyReplicas >= *deployment.Spec.Replicas
+	}
+	return status, nil
+}
+
+// WaitReady polls Status until all the pods of the mock are ready or the context is done.
+func (c *Client) WaitReady(ctx context.Context, mock *Mock) (*Status, error) {
+	var status *Status
+	err := wait.PollUntilContextCancel(ctx, waitInterval, true, func(ctx context.Context) (bool, error) {
+		var err error
+		status, err = c.Status(ctx, mock)
+		if err != nil {
+			return false, err
+		}
+		return status.Ready, nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to wait for the mock to be ready: %w", err)
+	}
+	return status, nil
+}
+
+// ValidateOpenAPI returns an error with the line numbers if the OpenAPI definition is invalid, and logs the warnings.
+func ValidateOpenAPI(spec string) error {
+	problems, err := openapi.Validate([]byte(spec))
+	for _, problem := range problems {
+		if problem.Severity == openapi.SeverityWarning {
+			log.Printf("[WARN] OpenAPI definition: %s", problem)
+		}
+	}
+	return err //nolint:wrapcheck // the problems are in the message
+}
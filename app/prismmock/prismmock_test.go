@@ -0,0 +1,169 @@
+package prismmock_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gold-kou/prism-in-k8s/app/istio"
+	"github.com/gold-kou/prism-in-k8s/app/k8s"
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/gold-kou/prism-in-k8s/app/prismmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	istiofake "istio.io/client-go/pkg/clientset/versioned/fake"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testOpenAPI = `openapi: 3.0.0
+info:
+  title: Test API
+  version: 1.0.0
+paths: {}
+`
+
+func newMock(istioMode bool) *prismmock.Mock {
+	return &prismmock.Mock{
+		Config: params.Config{
+			MicroserviceName:      "test",
+			MicroserviceNamespace: "test",
+			PrismMockSuffix:       "-prism-mock",
+			IstioMode:             istioMode,
+		},
+		OpenAPI: testOpenAPI,
+	}
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.TODO()
+	// istioMode needs istiod
+	istiod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "istio-system", Name: "istiod", Labels: map[string]string{"app": "istiod"}}}
+	k8sClientSet := fake.NewSimpleClientset(istiod)
+	istioClientSet := istiofake.NewSimpleClientset()
+	client, err := prismmock.New(prismmock.Options{KubeClient: k8sClientSet, IstioClient: istioClientSet, Creator: "tester"})
+	require.NoError(t, err)
+	mock := newMock(true)
+
+	// create
+	err = client.Create(ctx, mock)
+	require.NoError(t, err)
+	_, err = istioClientSet.NetworkingV1alpha3().VirtualServices("test-prism-mock").Get(ctx, "test-prism-mock", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	// status
+	status, err := client.Status(ctx, mock)
+	require.NoError(t, err)
+	assert.True(t, status.Exists)
+	// no pods run with the fake clientset
+	assert.False(t, status.Ready)
+	assert.Equal(t, "http://test-prism-mock.test-prism-mock.svc.cluster.local", status.URL)
+
+	// delete
+	err = client.Delete(ctx, mock)
+	require.NoError(t, err)
+	status, err = client.Status(ctx, mock)
+	require.NoError(t, err)
+	assert.False(t, status.Exists)
+}
+
+func TestClientAmbient(t *testing.T) {
+	ctx := context.TODO()
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	client, err := prismmock.New(prismmock.Options{
+		KubeClient:    fake.NewSimpleClientset(),
+		IstioClient:   istiofake.NewSimpleClientset(),
+		DynamicClient: dynamicClient,
+		Creator:       "tester",
+	})
+	require.NoError(t, err)
+	mock := newMock(true)
+	mock.Istio.Dataplane = params.DataplaneAmbient
+
+	// test target
+	err = client.Create(ctx, mock)
+
+	// verify
+	require.NoError(t, err)
+	waypoint, err := dynamicClient.Resource(istio.GatewayResource).Namespace("test-prism-mock").Get(ctx, "waypoint", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "Gateway", waypoint.GetKind())
+
+	// test target
+	err = client.Delete(ctx, mock)
+
+	// verify
+	require.NoError(t, err)
+	_, err = dynamicClient.Resource(istio.GatewayResource).Namespace("test-prism-mock").Get(ctx, "waypoint", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func TestClientErrors(t *testing.T) {
+	ctx := context.TODO()
+
+	_, err := prismmock.New(prismmock.Options{})
+	require.Error(t, err)
+
+	// no IstioClient in istioMode
+	client, err := prismmock.New(prismmock.Options{KubeClient: fake.NewSimpleClientset()})
+	require.NoError(t, err)
+	err = client.Create(ctx, newMock(true))
+	require.Error(t, err)
+
+	// no DynamicClient to deploy the waypoint in ambient
+	mock := newMock(true)
+	mock.Istio.Dataplane = params.DataplaneAmbient
+	client, err = prismmock.New(prismmock.Options{KubeClient: fake.NewSimpleClientset(), IstioClient: istiofake.NewSimpleClientset()})
+	require.NoError(t, err)
+	err = client.Create(ctx, mock)
+	require.Error(t, err)
+
+	// neither OpenAPI, Image nor Registry
+	mock = newMock(false)
+	mock.OpenAPI = ""
+	err = client.Create(ctx, mock)
+	require.Error(t, err)
+
+	// invalid OpenAPI definition
+	mock = newMock(false)
+	mock.OpenAPI = "openapi: 3.0.0\n"
+	err = client.Create(ctx, mock)
+	require.ErrorContains(t, err, "line 1: info is required")
+}
+
+func TestClientEmptySuffix(t *testing.T) {
+	ctx := context.TODO()
+	// the real microservice
+	k8sClientSet := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "test"}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "test"}},
+	)
+	client, err := prismmock.New(prismmock.Options{KubeClient: k8sClientSet})
+	require.NoError(t, err)
+	mock := newMock(false)
+	mock.PrismMockSuffix = ""
+	namespaceName, resourceName := mock.Names()
+	require.Equal(t, "test", namespaceName)
+	require.Equal(t, "test", resourceName)
+
+	// test target
+	createErr := client.Create(ctx, mock)
+	deleteErr := client.Delete(ctx, mock)
+
+	// verify
+	require.Error(t, createErr)
+	require.Error(t, deleteErr)
+	_, err = k8sClientSet.CoreV1().Namespaces().Get(ctx, "test", metav1.GetOptions{})
+	require.NoError(t, err)
+	_, err = k8sClientSet.AppsV1().Deployments("test").Get(ctx, "test", metav1.GetOptions{})
+	require.NoError(t, err)
+	_, err = k8sClientSet.CoreV1().Services("test").Get(ctx, "test", metav1.GetOptions{})
+	require.NoError(t, err)
+	_, err = k8sClientSet.CoreV1().ConfigMaps("test").Get(ctx, k8s.SpecConfigMapName("test"), metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
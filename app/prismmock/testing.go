@@ -0,0 +1,102 @@
+package prismmock
+
+import (
+	"context"
+	"os/user"
+	"strconv"
+	"testing"
+
+	"github.com/gold-kou/prism-in-k8s/app/k8s"
+	"istio.io/client-go/pkg/clientset/versioned"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Started is a mock provisioned by Start.
+type Started struct {
+	Mock   *Mock
+	Client *Client
+	// URL is the base URL of the mock inside the cluster
+	URL string
+	// LocalURL is the base URL of the mock port-forwarded to localhost
+	LocalURL string
+}
+
+// Start creates the mock in the cluster of the current kubeconfig context, waits until it is ready and port-forwards it.
+// The mock is deleted when the test and all its subtests complete. Any error fails the test immediately.
+//
+// Mock.OpenAPI or Mock.Image is required because no image is built.
+// Use a unique microserviceName or microserviceNamespace per test to run tests in parallel.
+func Start(t testing.TB, mock *Mock) *Started {
+	t.Helper()
+
+	kubeconfigPath := clientcmd.NewDefaultPathOptions().GetDefaultFilename()
+	kubeconfig, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	if err != nil {
+		t.Fatalf("failed to build Kubeconfig: %v", err)
+	}
+	k8sClientSet, err := kubernetes.NewForConfig(kubeconfig)
+	if err != nil {
+		t.Fatalf("failed to create k8s clientset: %v", err)
+	}
+	istioClientSet, err := versioned.NewForConfig(kubeconfig)
+	if err != nil {
+		t.Fatalf("failed to create Istio clientset: %v", err)
+	}
+	// to deploy the waypoint in ambient
+	dynamicClient, err := dynamic.NewForConfig(kubeconfig)
+	if err != nil {
+		t.Fatalf("failed to create dynamic client: %v", err)
+	}
+	options := Options{
+		KubeClient:    k8sClientSet,
+		IstioClient:   istioClientSet,
+		DynamicClient: dynamicClient,
+	}
+	if currentUser, err := user.Current(); err == nil {
+		options.Creator = currentUser.Username
+	}
+	client, err := New(options)
+	if err != nil {
+		t.Fatalf("failed to create prismmock client: %v", err)
+	}
+
+	config := mock.config()
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+
+	// register the clean up first to delete the resources created before a failure
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+		defer cancel()
+		if err := client.Delete(ctx, mock); err != nil {
+			t.Errorf("failed to delete the mock: %v", err)
+		}
+	})
+	err = client.Create(ctx, mock)
+	if err != nil {
+		t.Fatalf("failed to create the mock: %v", err)
+	}
+	_, err = client.WaitReady(ctx, mock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stopCh := make(chan struct{})
+	t.Cleanup(func() {
+		close(stopCh)
+	})
+	namespaceName, resourceName := mock.Names()
+	localPort, _, err := k8s.PortForward(ctx, kubeconfig, k8sClientSet, namespaceName, resourceName, 0, k8s.PodPort(config), stopCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Started{
+		Mock:     mock,
+		Client:   client,
+		URL:      mock.URL(),
+		LocalURL: "http://localhost:" + strconv.Itoa(localPort),
+	}
+}
@@ -0,0 +1,42 @@
+//go:build e2e
+
+package prismmock_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/gold-kou/prism-in-k8s/app/prismmock"
+	"github.com/gold-kou/prism-in-k8s/app/testutil"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestStart(t *testing.T) {
+	mock := &prismmock.Mock{
+		Config: params.Config{
+			MicroserviceName:      "test-microservice" + uuid.NewString(),
+			MicroserviceNamespace: "test-namespace" + uuid.NewString(),
+			PrismMockSuffix:       "-prism-mock",
+		},
+		// to get image from local
+		Image:           testutil.LocalPrismImage,
+		ImagePullPolicy: corev1.PullNever,
+	}
+
+	// test target
+	started := prismmock.Start(t, mock)
+
+	// verify
+	assert.Equal(t, mock.URL(), started.URL)
+	req, err := http.NewRequestWithContext(context.TODO(), http.MethodGet, started.LocalURL+"/users", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
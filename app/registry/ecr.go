@@ -8,14 +8,19 @@ import (
 	"log"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
 	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/gold-kou/prism-in-k8s/app/ownership"
 	"github.com/gold-kou/prism-in-k8s/app/params"
 	"golang.org/x/xerrors"
 )
 
+// faultProxyTag is the tag of the fault proxy image in the repository of the mock
+const faultProxyTag = "faultproxy"
+
 var (
 	errFailedToBuildDockerImage = errors.New("failed to build docker image")
 	errFailedToCreateECR        = errors.New("failed to create ECR repository")
@@ -23,48 +28,109 @@ var (
 	errFailedToLoginECR         = errors.New("failed to log in ECR")
 	errFailedToPushImage        = errors.New("failed to push image to ECR")
 	errFailedToDeleteECR        = errors.New("failed to delete ECR repository")
+	errFailedToListECR          = errors.New("failed to list ECR repositories")
 )
 
-func BuildAndPushECR(ctx context.Context, awsConfig aws.Config, awsAccountID, resourceName string) error {
+// Repository is an ECR repository created by this tool.
+type Repository struct {
+	Name      string
+	CreatedAt time.Time
+}
+
+// ECRAPI is the part of the ECR client used by this package. *ecr.Client and fake.ECR implement it.
+type ECRAPI interface {
+	ecr.DescribeRepositoriesAPIClient
+	CreateRepository(ctx context.Context, params *ecr.CreateRepositoryInput, optFns ...func(*ecr.Options)) (*ecr.CreateRepositoryOutput, error)
+	DeleteRepository(ctx context.Context, params *ecr.DeleteRepositoryInput, optFns ...func(*ecr.Options)) (*ecr.DeleteRepositoryOutput, error)
+	GetAuthorizationToken(ctx context.Context, params *ecr.GetAuthorizationTokenInput, optFns ...func(*ecr.Options)) (*ecr.GetAuthorizationTokenOutput, error)
+	ListTagsForResource(ctx context.Context, params *ecr.ListTagsForResourceInput, optFns ...func(*ecr.Options)) (*ecr.ListTagsForResourceOutput, error)
+}
+
+// ECR builds the Prism image and pushes it to the ECR repository of the account.
+type ECR struct {
+	ecrClient    ECRAPI
+	region       string
+	awsAccountID string
+	config       *params.Config
+	specFile     string
+}
+
+// NewECR returns the registry building specFile into the image. specFile is relative to the Docker build context, and Dockerfile.prism uses app/openapi.yaml if empty.
+func NewECR(ecrClient ECRAPI, region, awsAccountID string, config *params.Config, specFile string) *ECR {
+	return &ECR{
+		ecrClient:    ecrClient,
+		region:       region,
+		awsAccountID: awsAccountID,
+		config:       config,
+		specFile:     specFile,
+	}
+}
+
+// BuildAndPush builds the Prism image from Dockerfile.prism and returns the image pushed to the repository.
+func (e *ECR) BuildAndPush(ctx context.Context, repositoryName string) (string, error) {
+	err := BuildAndPushECR(ctx, e.ecrClient, e.region, e.config, e.awsAccountID, repositoryName, e.specFile)
+	if err != nil {
+		return "", err
+	}
+	return imageName(e.awsAccountID, e.region, repositoryName), nil
+}
+
+// BuildAndPushFaultProxy builds the fault proxy image from Dockerfile.faultproxy and returns the image pushed to the repository with the faultproxy tag.
+func (e *ECR) BuildAndPushFaultProxy(ctx context.Context, repositoryName string) (string, error) {
+	imageTag := e.config.MicroserviceName + "-faultproxy:v1"
+	cmd := exec.Command("docker", "build", "--platform", "linux/amd64", "-f", "Dockerfile.faultproxy", "-t", imageTag, ".")
+	if err := cmd.Run(); err != nil {
+		return "", xerrors.Errorf("%s: %v", errFailedToBuildDockerImage, err)
+	}
+	log.Println("[INFO] Docker image of the fault proxy is built successfully")
+
+	err := CreateECR(ctx, e.ecrClient, e.config, repositoryName)
+	if err != nil {
+		return "", err
+	}
+	ecrImageTag := imageName(e.awsAccountID, e.region, repositoryName) + ":" + faultProxyTag
+	if err := pushImage(ctx, e.ecrClient, e.awsAccountID, imageTag, ecrImageTag); err != nil {
+		return "", err
+	}
+	return ecrImageTag, nil
+}
+
+// Delete deletes the repository with all images.
+func (e *ECR) Delete(ctx context.Context, repositoryName string) error {
+	return DeleteECR(ctx, e.ecrClient, repositoryName)
+}
+
+func imageName(awsAccountID, region, repositoryName string) string {
+	return fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com/%s", awsAccountID, region, repositoryName)
+}
+
+func BuildAndPushECR(ctx context.Context, ecrClient ECRAPI, region string, config *params.Config, awsAccountID, resourceName, specFile string) error {
 	// build Docker image
-	imageTag := params.MicroserviceName + ":v1"
-	cmd := exec.Command("docker", "build", "--platform", "linux/amd64", "-f", "Dockerfile.prism", "-t", imageTag, ".")
+	imageTag := config.MicroserviceName + ":v1"
+	args := []string{"build", "--platform", "linux/amd64", "-f", "Dockerfile.prism", "-t", imageTag}
+	if specFile != "" {
+		args = append(args, "--build-arg", "SPEC_FILE="+specFile)
+	}
+	cmd := exec.Command("docker", append(args, ".")...)
 	if err := cmd.Run(); err != nil {
 		return xerrors.Errorf("%s: %v", errFailedToBuildDockerImage, err)
 	}
 	log.Println("[INFO] Docker image is built successfully")
 
-	// ECR tags
-	tags := []types.Tag{}
-	for _, ecrTag := range params.EcrTags {
-		if ecrTag.Key != "" || ecrTag.Value != "" {
-			tags = append(tags, types.Tag{
-				Key:   aws.String(ecrTag.Key),
-				Value: aws.String(ecrTag.Value),
-			})
-		}
-	}
-
 	// create ECR repository
-	ecrClient := ecr.NewFromConfig(awsConfig)
 	repositoryName := resourceName
-	input := &ecr.CreateRepositoryInput{
-		RepositoryName: aws.String(repositoryName),
-		Tags:           tags,
-	}
-	_, err := ecrClient.CreateRepository(ctx, input)
+	err := CreateECR(ctx, ecrClient, config, repositoryName)
 	if err != nil {
-		var ecrExistsException *types.RepositoryAlreadyExistsException
-		if !errors.As(err, &ecrExistsException) {
-			return xerrors.Errorf("%w: %w", errFailedToCreateECR, err)
-		}
-		log.Println("[WARN] The ECR already exists")
-	} else {
-		log.Println("[INFO] ECR is created successfully")
+		return err
 	}
 
+	ecrImageTag := imageName(awsAccountID, region, repositoryName) + ":latest"
+	return pushImage(ctx, ecrClient, awsAccountID, imageTag, ecrImageTag)
+}
+
+// pushImage tags the local image for ECR and pushes it.
+func pushImage(ctx context.Context, ecrClient ECRAPI, awsAccountID, imageTag, ecrImageTag string) error {
 	// tag Docker image for ECR
-	ecrImageTag := fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com/%s:latest", awsAccountID, awsConfig.Region, repositoryName)
 	cmdTag := exec.Command("docker", "tag", imageTag, ecrImageTag)
 	if err := cmdTag.Run(); err != nil {
 		return xerrors.Errorf("%w: %w", errFailedToTagImage, err)
@@ -72,7 +138,7 @@ func BuildAndPushECR(ctx context.Context, awsConfig aws.Config, awsAccountID, re
 	log.Println("[INFO] Docker image tagged successfully")
 
 	// login to ECR
-	err = loginToECR(ctx, awsConfig, awsAccountID)
+	err := loginToECR(ctx, ecrClient, awsAccountID)
 	if err != nil {
 		return xerrors.Errorf("%w: %w", errFailedToLoginECR, err)
 	}
@@ -87,39 +153,95 @@ func BuildAndPushECR(ctx context.Context, awsConfig aws.Config, awsAccountID, re
 	return nil
 }
 
-func loginToECR(ctx context.Context, awsConfig aws.Config, awsAccountID string) error {
-	ecrClient := ecr.NewFromConfig(awsConfig)
+// CreateECR creates the repository with the ownership tag and the ECR tags of the parameters.
+// An existing repository is left as it is.
+func CreateECR(ctx context.Context, ecrClient ECRAPI, config *params.Config, repositoryName string) error {
+	// ECR tags
+	tags := []types.Tag{
+		{
+			Key:   aws.String(ownership.ManagedByTagKey),
+			Value: aws.String(ownership.ManagedByValue),
+		},
+	}
+	for _, ecrTag := range config.EcrTags {
+		if ecrTag.Key != "" || ecrTag.Value != "" {
+			tags = append(tags, types.Tag{
+				Key:   aws.String(ecrTag.Key),
+				Value: aws.String(ecrTag.Value),
+			})
+		}
+	}
+
+	input := &ecr.CreateRepositoryInput{
+		RepositoryName: aws.String(repositoryName),
+		Tags:           tags,
+	}
+	_, err := ecrClient.CreateRepository(ctx, input)
+	if err != nil {
+		var ecrExistsException *types.RepositoryAlreadyExistsException
+		if !errors.As(err, &ecrExistsException) {
+			return xerrors.Errorf("%w: %w", errFailedToCreateECR, err)
+		}
+		log.Println("[WARN] The ECR already exists")
+	} else {
+		log.Println("[INFO] ECR is created successfully")
+	}
+	return nil
+}
+
+// LoginCredentials are the credentials of `docker login` for ECR.
+type LoginCredentials struct {
+	Username string
+	Password string
+	Registry string
+}
 
+// GetLoginCredentials gets the authorization token of the account and decodes it.
+func GetLoginCredentials(ctx context.Context, ecrClient ECRAPI, awsAccountID string) (*LoginCredentials, error) {
 	// Get the authorization token
 	authTokenOutput, err := ecrClient.GetAuthorizationToken(ctx, &ecr.GetAuthorizationTokenInput{
 		RegistryIds: []string{awsAccountID},
 	})
 	if err != nil {
-		return fmt.Errorf("%w: %w", errFailedToLoginECR, err)
+		return nil, fmt.Errorf("%w: %w", errFailedToLoginECR, err)
 	}
 
 	if len(authTokenOutput.AuthorizationData) == 0 {
-		return fmt.Errorf("%w: no authorization data found", errFailedToLoginECR)
+		return nil, fmt.Errorf("%w: no authorization data found", errFailedToLoginECR)
 	}
+	return decodeAuthToken(authTokenOutput.AuthorizationData[0])
+}
 
-	authData := authTokenOutput.AuthorizationData[0]
+func decodeAuthToken(authData types.AuthorizationData) (*LoginCredentials, error) {
+	if authData.AuthorizationToken == nil || authData.ProxyEndpoint == nil {
+		return nil, fmt.Errorf("%w: incomplete authorization data", errFailedToLoginECR)
+	}
 	decodedToken, err := base64.StdEncoding.DecodeString(*authData.AuthorizationToken)
 	if err != nil {
-		return fmt.Errorf("%w: %w", errFailedToLoginECR, err)
+		return nil, fmt.Errorf("%w: %w", errFailedToLoginECR, err)
 	}
 
 	decodedTokenParts := 2
 	parts := strings.SplitN(string(decodedToken), ":", decodedTokenParts)
 	if len(parts) != decodedTokenParts {
-		return fmt.Errorf("%w: invalid authorization token format", errFailedToLoginECR)
+		return nil, fmt.Errorf("%w: invalid authorization token format", errFailedToLoginECR)
 	}
 
-	username := parts[0]
-	password := parts[1]
-	registry := *authData.ProxyEndpoint
+	return &LoginCredentials{
+		Username: parts[0],
+		Password: parts[1],
+		Registry: *authData.ProxyEndpoint,
+	}, nil
+}
 
-	loginCmd := exec.Command("docker", "login", "--username", username, "--password-stdin", registry)
-	loginCmd.Stdin = strings.NewReader(password)
+func loginToECR(ctx context.Context, ecrClient ECRAPI, awsAccountID string) error {
+	credentials, err := GetLoginCredentials(ctx, ecrClient, awsAccountID)
+	if err != nil {
+		return err
+	}
+
+	loginCmd := exec.Command("docker", "login", "--username", credentials.Username, "--password-stdin", credentials.Registry)
+	loginCmd.Stdin = strings.NewReader(credentials.Password)
 	output, err := loginCmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("%w: %w\n%s", errFailedToLoginECR, err, string(output))
@@ -128,9 +250,8 @@ func loginToECR(ctx context.Context, awsConfig aws.Config, awsAccountID string)
 	return nil
 }
 
-func DeleteECR(ctx context.Context, awsConfig aws.Config, resourceName string) error {
+func DeleteECR(ctx context.Context, ecrClient ECRAPI, resourceName string) error {
 	// Delete ECR
-	ecrClient := ecr.NewFromConfig(awsConfig)
 	repositoryName := resourceName
 	input := &ecr.DeleteRepositoryInput{
 		RepositoryName: aws.String(repositoryName),
@@ -148,3 +269,55 @@ func DeleteECR(ctx context.Context, awsConfig aws.Config, resourceName string) e
 	}
 	return nil
 }
+
+// ListRepositories returns the ECR repositories having the ownership tag of this tool.
+func ListRepositories(ctx context.Context, ecrClient ECRAPI) ([]Repository, error) {
+	repositories := []Repository{}
+	paginator := ecr.NewDescribeRepositoriesPaginator(ecrClient, &ecr.DescribeRepositoriesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, xerrors.Errorf("%w: %w", errFailedToListECR, err)
+		}
+		for _, repository := range page.Repositories {
+			tagsOutput, err := ecrClient.ListTagsForResource(ctx, &ecr.ListTagsForResourceInput{
+				ResourceArn: repository.RepositoryArn,
+			})
+			if err != nil {
+				return nil, xerrors.Errorf("%w: %w", errFailedToListECR, err)
+			}
+			if !hasOwnershipTag(tagsOutput.Tags) {
+				continue
+			}
+			repositories = append(repositories, Repository{
+				Name:      aws.ToString(repository.RepositoryName),
+				CreatedAt: aws.ToTime(repository.CreatedAt),
+			})
+		}
+	}
+	return repositories, nil
+}
+
+// Orphans returns the repositories whose names are not in inUse, i.e. without a matching mock.
+func Orphans(repositories []Repository, inUse []string) []Repository {
+	names := make(map[string]struct{}, len(inUse))
+	for _, name := range inUse {
+		names[name] = struct{}{}
+	}
+	orphans := []Repository{}
+	for _, repository := range repositories {
+		if _, ok := names[repository.Name]; !ok {
+			orphans = append(orphans, repository)
+		}
+	}
+	return orphans
+}
+
+func hasOwnershipTag(tags []types.Tag) bool {
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == ownership.ManagedByTagKey && aws.ToString(tag.Value) == ownership.ManagedByValue {
+			return true
+		}
+	}
+	return false
+}
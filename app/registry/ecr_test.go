@@ -0,0 +1,212 @@
+package registry_test
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/gold-kou/prism-in-k8s/app/registry"
+	"github.com/gold-kou/prism-in-k8s/app/registry/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAccountID = "123456789012"
+	testRegion    = "ap-northeast-1"
+)
+
+var (
+	_ registry.ECRAPI = (*fake.ECR)(nil)
+	_ registry.STSAPI = (*fake.STS)(nil)
+)
+
+func TestCreateECR(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+	}{
+		{
+			name: "create",
+		},
+		{
+			name:     "already exists",
+			existing: []string{"test-repository"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			ecrClient := fake.NewECR(testAccountID, testRegion)
+			for _, name := range tt.existing {
+				require.NoError(t, registry.CreateECR(ctx, ecrClient, &params.Config{}, name))
+			}
+			config := &params.Config{EcrTags: []params.ECRTag{{Key: "CostEnv", Value: "stg"}, {}}}
+
+			// test target
+			err := registry.CreateECR(ctx, ecrClient, config, "test-repository")
+			require.NoError(t, err)
+
+			// verify
+			assert.Equal(t, []string{"test-repository"}, ecrClient.RepositoryNames())
+		})
+	}
+}
+
+func TestDeleteECR(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+	}{
+		{
+			name:     "delete",
+			existing: []string{"test-repository"},
+		},
+		{
+			name: "not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			ecrClient := fake.NewECR(testAccountID, testRegion)
+			for _, name := range tt.existing {
+				require.NoError(t, registry.CreateECR(ctx, ecrClient, &params.Config{}, name))
+			}
+
+			// test target
+			err := registry.DeleteECR(ctx, ecrClient, "test-repository")
+			require.NoError(t, err)
+
+			// verify
+			assert.Empty(t, ecrClient.RepositoryNames())
+		})
+	}
+}
+
+func TestListRepositories(t *testing.T) {
+	ctx := context.TODO()
+	ecrClient := fake.NewECR(testAccountID, testRegion)
+	require.NoError(t, registry.CreateECR(ctx, ecrClient, &params.Config{}, "owned"))
+	// created by someone else without the ownership tag
+	_, err := ecrClient.CreateRepository(ctx, &ecr.CreateRepositoryInput{RepositoryName: aws.String("not-owned")})
+	require.NoError(t, err)
+
+	// test target
+	repositories, err := registry.ListRepositories(ctx, ecrClient)
+	require.NoError(t, err)
+
+	// verify
+	require.Len(t, repositories, 1)
+	assert.Equal(t, "owned", repositories[0].Name)
+}
+
+func TestOrphans(t *testing.T) {
+	ctx := context.TODO()
+	ecrClient := fake.NewECR(testAccountID, testRegion)
+	for _, name := range []string{"in-use", "orphaned"} {
+		require.NoError(t, registry.CreateECR(ctx, ecrClient, &params.Config{}, name))
+	}
+	repositories, err := registry.ListRepositories(ctx, ecrClient)
+	require.NoError(t, err)
+
+	// test target
+	// a mock without a repository, e.g. with the upstream Prism image, has an empty name
+	orphans := registry.Orphans(repositories, []string{"in-use", ""})
+
+	// verify
+	require.Len(t, orphans, 1)
+	assert.Equal(t, "orphaned", orphans[0].Name)
+}
+
+func TestGetLoginCredentials(t *testing.T) {
+	tests := []struct {
+		name              string
+		authorizationData []types.AuthorizationData
+		want              *registry.LoginCredentials
+		wantErr           bool
+	}{
+		{
+			name: "valid token",
+			want: &registry.LoginCredentials{
+				Username: fake.Username,
+				Password: fake.Password,
+				Registry: "https://" + testAccountID + ".dkr.ecr." + testRegion + ".amazonaws.com",
+			},
+		},
+		{
+			name: "password with colon",
+			authorizationData: []types.AuthorizationData{
+				{
+					AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte("AWS:pass:word"))),
+					ProxyEndpoint:      aws.String("https://registry"),
+				},
+			},
+			want: &registry.LoginCredentials{Username: "AWS", Password: "pass:word", Registry: "https://registry"},
+		},
+		{
+			name:              "no authorization data",
+			authorizationData: []types.AuthorizationData{},
+			wantErr:           true,
+		},
+		{
+			name: "not base64",
+			authorizationData: []types.AuthorizationData{
+				{AuthorizationToken: aws.String("!!!"), ProxyEndpoint: aws.String("https://registry")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "no colon",
+			authorizationData: []types.AuthorizationData{
+				{AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte("AWS"))), ProxyEndpoint: aws.String("https://registry")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "no proxy endpoint",
+			authorizationData: []types.AuthorizationData{
+				{AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte("AWS:password")))},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ecrClient := fake.NewECR(testAccountID, testRegion)
+			if tt.authorizationData != nil {
+				ecrClient.AuthorizationData = tt.authorizationData
+			}
+
+			// test target
+			credentials, err := registry.GetLoginCredentials(context.TODO(), ecrClient, testAccountID)
+
+			// verify
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, credentials)
+		})
+	}
+}
+
+func TestCallerIdentity(t *testing.T) {
+	stsClient := &fake.STS{Account: testAccountID, Arn: "arn:aws:iam::123456789012:user/tester"}
+
+	// test target
+	accountID, arn, err := registry.CallerIdentity(context.TODO(), stsClient)
+
+	// verify
+	require.NoError(t, err)
+	assert.Equal(t, testAccountID, accountID)
+	assert.Equal(t, "arn:aws:iam::123456789012:user/tester", arn)
+}
@@ -0,0 +1,148 @@
+// Package fake provides in-memory ECR and STS clients to test the registry package without AWS.
+package fake
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+const (
+	// Username and Password are encoded in the default authorization token
+	Username = "AWS"
+	Password = "fake-password"
+)
+
+type repository struct {
+	arn       string
+	createdAt time.Time
+	tags      []types.Tag
+}
+
+// ECR is an in-memory ECR client implementing registry.ECRAPI.
+type ECR struct {
+	AccountID string
+	Region    string
+	// AuthorizationData is returned by GetAuthorizationToken. It defaults to the token of Username and Password.
+	AuthorizationData []types.AuthorizationData
+
+	mu           sync.Mutex
+	repositories map[string]*repository
+}
+
+// NewECR returns an ECR client without repositories.
+func NewECR(accountID, region string) *ECR {
+	return &ECR{
+		AccountID: accountID,
+		Region:    region,
+		AuthorizationData: []types.AuthorizationData{
+			{
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(Username + ":" + Password))),
+				ProxyEndpoint:      aws.String(fmt.Sprintf("https://%s.dkr.ecr.%s.amazonaws.com", accountID, region)),
+			},
+		},
+		repositories: map[string]*repository{},
+	}
+}
+
+// RepositoryNames returns the names of the existing repositories in order.
+func (e *ECR) RepositoryNames() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.names()
+}
+
+func (e *ECR) CreateRepository(_ context.Context, params *ecr.CreateRepositoryInput, _ ...func(*ecr.Options)) (*ecr.CreateRepositoryOutput, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	name := aws.ToString(params.RepositoryName)
+	if _, ok := e.repositories[name]; ok {
+		return nil, &types.RepositoryAlreadyExistsException{Message: aws.String("The repository with name '" + name + "' already exists")}
+	}
+	e.repositories[name] = &repository{
+		arn:       fmt.Sprintf("arn:aws:ecr:%s:%s:repository/%s", e.Region, e.AccountID, name),
+		createdAt: time.Unix(0, 0).UTC(),
+		tags:      params.Tags,
+	}
+	return &ecr.CreateRepositoryOutput{Repository: e.toRepository(name)}, nil
+}
+
+func (e *ECR) DeleteRepository(_ context.Context, params *ecr.DeleteRepositoryInput, _ ...func(*ecr.Options)) (*ecr.DeleteRepositoryOutput, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	name := aws.ToString(params.RepositoryName)
+	if _, ok := e.repositories[name]; !ok {
+		return nil, &types.RepositoryNotFoundException{Message: aws.String("The repository with name '" + name + "' does not exist")}
+	}
+	output := &ecr.DeleteRepositoryOutput{Repository: e.toRepository(name)}
+	delete(e.repositories, name)
+	return output, nil
+}
+
+// DescribeRepositories returns all repositories in one page.
+func (e *ECR) DescribeRepositories(_ context.Context, _ *ecr.DescribeRepositoriesInput, _ ...func(*ecr.Options)) (*ecr.DescribeRepositoriesOutput, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	repositories := []types.Repository{}
+	for _, name := range e.names() {
+		repositories = append(repositories, *e.toRepository(name))
+	}
+	return &ecr.DescribeRepositoriesOutput{Repositories: repositories}, nil
+}
+
+func (e *ECR) GetAuthorizationToken(_ context.Context, _ *ecr.GetAuthorizationTokenInput, _ ...func(*ecr.Options)) (*ecr.GetAuthorizationTokenOutput, error) {
+	return &ecr.GetAuthorizationTokenOutput{AuthorizationData: e.AuthorizationData}, nil
+}
+
+func (e *ECR) ListTagsForResource(_ context.Context, params *ecr.ListTagsForResourceInput, _ ...func(*ecr.Options)) (*ecr.ListTagsForResourceOutput, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, repository := range e.repositories {
+		if repository.arn == aws.ToString(params.ResourceArn) {
+			return &ecr.ListTagsForResourceOutput{Tags: repository.tags}, nil
+		}
+	}
+	return nil, &types.RepositoryNotFoundException{Message: aws.String("The repository with arn '" + aws.ToString(params.ResourceArn) + "' does not exist")}
+}
+
+// names returns the names of the repositories in order. e.mu must be held.
+func (e *ECR) names() []string {
+	names := []string{}
+	for name := range e.repositories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// toRepository returns the existing repository of the name. e.mu must be held.
+func (e *ECR) toRepository(name string) *types.Repository {
+	repository := e.repositories[name]
+	return &types.Repository{
+		RepositoryName: aws.String(name),
+		RepositoryArn:  aws.String(repository.arn),
+		RegistryId:     aws.String(e.AccountID),
+		CreatedAt:      aws.Time(repository.createdAt),
+	}
+}
+
+// STS is an STS client implementing registry.STSAPI.
+type STS struct {
+	Account string
+	Arn     string
+}
+
+func (s *STS) GetCallerIdentity(_ context.Context, _ *sts.GetCallerIdentityInput, _ ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{
+		Account: aws.String(s.Account),
+		Arn:     aws.String(s.Arn),
+	}, nil
+}
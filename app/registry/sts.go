@@ -0,0 +1,26 @@
+package registry
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"golang.org/x/xerrors"
+)
+
+var errFailedToGetCallerIdentity = errors.New("failed to get caller identity")
+
+// STSAPI is the part of the STS client used by this package. *sts.Client and fake.STS implement it.
+type STSAPI interface {
+	GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+// CallerIdentity returns the AWS account ID and the ARN of the caller.
+func CallerIdentity(ctx context.Context, stsClient STSAPI) (string, string, error) {
+	result, err := stsClient.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", "", xerrors.Errorf("%w: %w", errFailedToGetCallerIdentity, err)
+	}
+	return aws.ToString(result.Account), aws.ToString(result.Arn), nil
+}
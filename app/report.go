@@ -0,0 +1,131 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/k8s"
+	"github.com/gold-kou/prism-in-k8s/app/openapi"
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/gold-kou/prism-in-k8s/app/prismlog"
+	"github.com/gold-kou/prism-in-k8s/app/report"
+	"golang.org/x/xerrors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	errContractViolated = errors.New("requests violate the OpenAPI contract")
+	errInvalidWindow    = errors.New("invalid report window")
+)
+
+// writeReport writes the contract violations of the requests to the mock in the time window of -from, -to and -since.
+// It returns errContractViolated if any request violates the contract, so that CI fails.
+func writeReport(ctx context.Context, out io.Writer, config *params.Config) error {
+	from, to, err := reportWindow()
+	if err != nil {
+		return err
+	}
+	spec, err := loadSpec(ctx, config)
+	if err != nil {
+		return err
+	}
+	operations, err := openapi.ParseOperations(spec)
+	if err != nil {
+		return err //nolint:wrapcheck // already wrapped
+	}
+
+	requests, err := collectRequests(ctx, config, k8s.LogOptions{SinceTime: from})
+	if err != nil {
+		return err
+	}
+	result := report.New(from, to)
+	for _, request := range requests {
+		result.Add(operations, request)
+	}
+
+	if reportOutput != "" {
+		file, err := os.Create(reportOutput)
+		if err != nil {
+			return xerrors.Errorf("failed to create %s: %w", reportOutput, err)
+		}
+		defer file.Close()
+		out = file
+	}
+	if err := result.Write(out, report.Format(reportFormat)); err != nil {
+		return err //nolint:wrapcheck // already wrapped
+	}
+	if reportOutput != "" {
+		log.Printf("[INFO] The report is written to %s", reportOutput)
+	}
+
+	if result.Failed() {
+		return xerrors.Errorf("%w: %d of %d requests", errContractViolated, result.RequestsWithViolations, result.Requests)
+	}
+	return nil
+}
+
+// reportWindow returns the time window of the report. from is zero to scan all the logs.
+func reportWindow() (from, to time.Time, err error) {
+	to = metav1.Now().Time
+	if reportTo != "" {
+		to, err = time.Parse(time.RFC3339, reportTo)
+		if err != nil {
+			return from, to, xerrors.Errorf("%w: -to: %w", errInvalidWindow, err)
+		}
+	}
+	if reportFrom != "" {
+		from, err = time.Parse(time.RFC3339, reportFrom)
+		if err != nil {
+			return from, to, xerrors.Errorf("%w: -from: %w", errInvalidWindow, err)
+		}
+	} else if since > 0 {
+		from = to.Add(-since)
+	}
+	if !from.IsZero() && !from.Before(to) {
+		return from, to, xerrors.Errorf("%w: %s is not before %s", errInvalidWindow, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	return from, to, nil
+}
+
+// collectRequests returns the requests in the Prism logs of all the pods of the mock in time order.
+func collectRequests(ctx context.Context, config *params.Config, options k8s.LogOptions) ([]*prismlog.Request, error) {
+	lines := make(chan k8s.LogLine)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		errCh <- k8s.StreamLogs(ctx, k8sClientSet, config.NamespaceName(), config.ResourceName(), options, lines)
+	}()
+
+	// the lines of a pod are in order, so the requests are assembled per pod
+	assemblers := map[string]*prismlog.Assembler{}
+	requests := []*prismlog.Request{}
+	for line := range lines {
+		entry, ok := prismlog.ParseLine(line.Text)
+		if !ok {
+			continue
+		}
+		assembler, ok := assemblers[line.Pod]
+		if !ok {
+			assembler = prismlog.NewAssembler(line.Pod)
+			assemblers[line.Pod] = assembler
+		}
+		requests = append(requests, assembler.Add(entry, line.Time)...)
+	}
+	if err := <-errCh; err != nil {
+		return nil, xerrors.Errorf("failed to get logs: %w", err)
+	}
+	// the requests without the response in the logs
+	for _, assembler := range assemblers {
+		requests = append(requests, assembler.Flush()...)
+	}
+
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].Time.Before(requests[j].Time)
+	})
+	return requests, nil
+}
@@ -0,0 +1,352 @@
+// Package report aggregates the contract violations of the requests sent to the mock,
+// so that CI can fail a client sending requests the OpenAPI definition rejects.
+package report
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/openapi"
+	"github.com/gold-kou/prism-in-k8s/app/prismlog"
+	"golang.org/x/xerrors"
+)
+
+// Format is the output format of the report.
+type Format string
+
+const (
+	FormatMarkdown Format = "markdown"
+	FormatJSON     Format = "json"
+	FormatJUnit    Format = "junit"
+)
+
+const (
+	requestLocationPrefix = "request"
+	minClientErrorStatus  = 400
+	minServerErrorStatus  = 500
+	// unknownOperation is the operation of the requests not matching any path of the OpenAPI definition
+	unknownOperation = "(unknown)"
+	// incompleteOperation is the operation of the requests whose log lines overlapped with other requests in a pod
+	incompleteOperation = "(incomplete)"
+	junitSuiteName      = "prism contract"
+)
+
+var (
+	errUnknownFormat   = errors.New("unknown report format")
+	errFailedToWrite   = errors.New("failed to write report")
+	errFailedToMarshal = errors.New("failed to marshal report")
+)
+
+// Report is the contract violations of the requests in a time window.
+// Incomplete is the number of requests whose status and violations may be missing in the logs.
+type Report struct {
+	// From is zero if the window starts at the beginning of the logs
+	From                   time.Time    `json:"from,omitempty"`
+	To                     time.Time    `json:"to"`
+	Requests               int          `json:"requests"`
+	RequestsWithViolations int          `json:"requests_with_violations"`
+	Incomplete             int          `json:"incomplete"`
+	Operations             []*Operation `json:"operations"`
+}
+
+// Operation is the requests to an operation and their contract violations.
+type Operation struct {
+	OperationID            string   `json:"operation_id"`
+	Method                 string   `json:"method"`
+	Path                   string   `json:"path"`
+	Requests               int      `json:"requests"`
+	RequestsWithViolations int      `json:"requests_with_violations"`
+	Errors                 []*Error `json:"errors"`
+}
+
+// Error is a contract violation and the number of requests it is found in.
+type Error struct {
+	// Type is the part of the request, e.g. request.body, or the Prism error code, e.g. NO_PATH_MATCHED_ERROR
+	Type     string `json:"type"`
+	Location string `json:"location,omitempty"`
+	Message  string `json:"message"`
+	Count    int    `json:"count"`
+}
+
+// New returns an empty report of the time window.
+func New(from, to time.Time) *Report {
+	return &Report{From: from, To: to, Operations: []*Operation{}}
+}
+
+// Add adds the request to the report. The operation is looked up in operations by the method and the path.
+// The violations of the responses are ignored because they are not the fault of the client.
+// The incomplete requests are added to their own operation, so that the report shows the logs are lossy,
+// but the violations found in them still fail the report.
+func (r *Report) Add(operations *openapi.Operations, request *prismlog.Request) {
+	if (!r.From.IsZero() && request.Time.Before(r.From)) || request.Time.After(r.To) {
+		return
+	}
+
+	matched, found := operations.Find(request.Method, request.Path)
+	if !found {
+		matched = openapi.Operation{ID: unknownOperation, Method: request.Method, Path: request.Path}
+	}
+	if request.Incomplete {
+		matched = openapi.Operation{ID: incompleteOperation}
+		r.Incomplete++
+	}
+	operation := r.operation(matched)
+	operation.Requests++
+	r.Requests++
+
+	errs := requestErrors(request)
+	if len(errs) == 0 {
+		return
+	}
+	operation.RequestsWithViolations++
+	r.RequestsWithViolations++
+	for _, err := range errs {
+		operation.addError(err)
+	}
+}
+
+// Failed returns true if any request has contract violations.
+func (r *Report) Failed() bool {
+	return r.RequestsWithViolations > 0
+}
+
+func (r *Report) operation(matched openapi.Operation) *Operation {
+	for _, operation := range r.Operations {
+		if operation.OperationID == matched.ID && operation.Method == matched.Method && operation.Path == matched.Path {
+			return operation
+		}
+	}
+	operation := &Operation{
+		OperationID: matched.ID,
+		Method:      matched.Method,
+		Path:        matched.Path,
+		Errors:      []*Error{},
+	}
+	r.Operations = append(r.Operations, operation)
+	sort.Slice(r.Operations, func(i, j int) bool {
+		if r.Operations[i].OperationID != r.Operations[j].OperationID {
+			return r.Operations[i].OperationID < r.Operations[j].OperationID
+		}
+		if r.Operations[i].Path != r.Operations[j].Path {
+			return r.Operations[i].Path < r.Operations[j].Path
+		}
+		return r.Operations[i].Method < r.Operations[j].Method
+	})
+	return operation
+}
+
+func (o *Operation) addError(err Error) {
+	for _, found := range o.Errors {
+		if found.Type == err.Type && found.Location == err.Location && found.Message == err.Message {
+			found.Count++
+			return
+		}
+	}
+	err.Count = 1
+	o.Errors = append(o.Errors, &err)
+	sort.SliceStable(o.Errors, func(i, j int) bool {
+		return o.Errors[i].Type < o.Errors[j].Type
+	})
+}
+
+// requestErrors returns the request violations, or the Prism error of a client error without violations, e.g. an unknown path.
+func requestErrors(request *prismlog.Request) []Error {
+	errs := []Error{}
+	for _, violation := range request.Violations {
+		if !strings.HasPrefix(violation.Location, requestLocationPrefix) {
+			continue
+		}
+		errs = append(errs, Error{
+			Type:     errorType(violation.Location),
+			Location: violation.Location,
+			Message:  violation.Message,
+		})
+	}
+	if len(errs) == 0 && request.Error != "" && request.Status >= minClientErrorStatus && request.Status < minServerErrorStatus {
+		errs = append(errs, Error{
+			Type:    request.Error,
+			Message: fmt.Sprintf("%s %s is responded with %d", request.Method, request.Path, request.Status),
+		})
+	}
+	return errs
+}
+
+// errorType returns the part of the request, e.g. request.header for request.header.x-api-key.
+func errorType(location string) string {
+	parts := strings.SplitN(location, ".", 3) //nolint:mnd // request, part and name
+	if len(parts) < 2 {                       //nolint:mnd // request and part
+		return location
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// Write writes the report in the format.
+func (r *Report) Write(out io.Writer, format Format) error {
+	switch format {
+	case FormatMarkdown:
+		return r.writeMarkdown(out)
+	case FormatJSON:
+		return r.writeJSON(out)
+	case FormatJUnit:
+		return r.writeJUnit(out)
+	default:
+		return xerrors.Errorf("%w: %s", errUnknownFormat, format)
+	}
+}
+
+func (r *Report) window() string {
+	if r.From.IsZero() {
+		return "until " + r.To.UTC().Format(time.RFC3339)
+	}
+	return "from " + r.From.UTC().Format(time.RFC3339) + " to " + r.To.UTC().Format(time.RFC3339)
+}
+
+func (r *Report) writeMarkdown(out io.Writer) error {
+	builder := &strings.Builder{}
+	fmt.Fprintln(builder, "# Contract Violation Report")
+	fmt.Fprintln(builder)
+	fmt.Fprintf(builder, "%d requests %s, %d with contract violations, %d incomplete.\n", r.Requests, r.window(), r.RequestsWithViolations, r.Incomplete)
+	if len(r.Operations) > 0 {
+		fmt.Fprintln(builder)
+		fmt.Fprintln(builder, "| Operation | Method | Path | Requests | With violations |")
+		fmt.Fprintln(builder, "| --- | --- | --- | ---: | ---: |")
+		for _, operation := range r.Operations {
+			path := ""
+			if operation.Path != "" {
+				path = "`" + operation.Path + "`"
+			}
+			fmt.Fprintf(builder, "| %s | %s | %s | %d | %d |\n", operation.OperationID, operation.Method, path, operation.Requests, operation.RequestsWithViolations)
+		}
+	}
+	if r.Failed() {
+		fmt.Fprintln(builder)
+		fmt.Fprintln(builder, "## Violations")
+		fmt.Fprintln(builder)
+		fmt.Fprintln(builder, "| Operation | Type | Location | Message | Count |")
+		fmt.Fprintln(builder, "| --- | --- | --- | --- | ---: |")
+		for _, operation := range r.Operations {
+			for _, err := range operation.Errors {
+				fmt.Fprintf(builder, "| %s | %s | %s | %s | %d |\n", operation.OperationID, err.Type, err.Location, strings.ReplaceAll(err.Message, "|", `\|`), err.Count)
+			}
+		}
+	}
+	if _, err := io.WriteString(out, builder.String()); err != nil {
+		return xerrors.Errorf("%w: %w", errFailedToWrite, err)
+	}
+	return nil
+}
+
+func (r *Report) writeJSON(out io.Writer) error {
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return xerrors.Errorf("%w: %w", errFailedToMarshal, err)
+	}
+	if _, err := out.Write(append(content, '\n')); err != nil {
+		return xerrors.Errorf("%w: %w", errFailedToWrite, err)
+	}
+	return nil
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// writeJUnit writes a test case per operation, which fails if any request to the operation has contract violations.
+// The test case of the incomplete requests is skipped unless they have contract violations.
+func (r *Report) writeJUnit(out io.Writer) error {
+	suite := junitTestSuite{
+		Name:      junitSuiteName,
+		Tests:     len(r.Operations),
+		Timestamp: r.To.UTC().Format(time.RFC3339),
+		TestCases: []junitTestCase{},
+	}
+	for _, operation := range r.Operations {
+		testCase := junitTestCase{
+			ClassName: junitSuiteName,
+			Name:      operation.OperationID + " (" + operation.Method + " " + operation.Path + ")",
+		}
+		if operation.OperationID == incompleteOperation {
+			testCase.Name = operation.OperationID
+		}
+		if len(operation.Errors) > 0 {
+			suite.Failures++
+			types := []string{}
+			lines := []string{}
+			for _, err := range operation.Errors {
+				if len(types) == 0 || types[len(types)-1] != err.Type {
+					types = append(types, err.Type)
+				}
+				location := err.Location
+				if location == "" {
+					location = err.Type
+				}
+				lines = append(lines, fmt.Sprintf("%dx %s %s", err.Count, location, err.Message))
+			}
+			testCase.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d of %d requests violate the contract", operation.RequestsWithViolations, operation.Requests),
+				Type:    strings.Join(types, ","),
+				Text:    strings.Join(lines, "\n"),
+			}
+		}
+		if testCase.Failure == nil && operation.OperationID == incompleteOperation {
+			suite.Skipped++
+			testCase.Skipped = &junitSkipped{
+				Message: fmt.Sprintf("%d requests cannot be fully checked because their log lines overlapped with other requests", operation.Requests),
+			}
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	suites := junitTestSuites{
+		Name:     junitSuiteName,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	content, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return xerrors.Errorf("%w: %w", errFailedToMarshal, err)
+	}
+	if _, err := io.WriteString(out, xml.Header+string(content)+"\n"); err != nil {
+		return xerrors.Errorf("%w: %w", errFailedToWrite, err)
+	}
+	return nil
+}
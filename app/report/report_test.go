@@ -0,0 +1,137 @@
+package report_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/openapi"
+	"github.com/gold-kou/prism-in-k8s/app/prismlog"
+	"github.com/gold-kou/prism-in-k8s/app/report"
+	"github.com/gold-kou/prism-in-k8s/app/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const spec = `
+openapi: 3.0.0
+info:
+  title: test
+  version: 1.0.0
+paths:
+  /users:
+    get:
+      operationId: listUsers
+      responses: {}
+    post:
+      operationId: createUser
+      responses: {}
+  /users/{id}:
+    get:
+      operationId: getUser
+      responses: {}
+`
+
+var (
+	from = time.Date(2024, 1, 2, 1, 0, 0, 0, time.UTC)
+	to   = time.Date(2024, 1, 2, 2, 0, 0, 0, time.UTC)
+)
+
+func newReport(t *testing.T) *report.Report {
+	t.Helper()
+	operations, err := openapi.ParseOperations([]byte(spec))
+	require.NoError(t, err)
+
+	missingName := prismlog.Violation{Location: "request.body", Message: "Request body must have required property 'name'", Level: "error"}
+	missingKey := prismlog.Violation{Location: "request.header.x-api-key", Message: "Request header must have required property 'x-api-key'", Level: "error"}
+	requests := []*prismlog.Request{
+		{Time: from.Add(1 * time.Minute), Method: "GET", Path: "/users", Status: 200},
+		{Time: from.Add(2 * time.Minute), Method: "GET", Path: "/users/1", Status: 200},
+		{Time: from.Add(3 * time.Minute), Method: "POST", Path: "/users", Status: 422, Violations: []prismlog.Violation{missingName, missingKey}},
+		{Time: from.Add(4 * time.Minute), Method: "POST", Path: "/users", Status: 422, Violations: []prismlog.Violation{missingName}},
+		// the response violation is not the fault of the client
+		{Time: from.Add(5 * time.Minute), Method: "GET", Path: "/users/2", Status: 200, Violations: []prismlog.Violation{{Location: "response.body", Message: "Response body must be array", Level: "error"}}},
+		{Time: from.Add(6 * time.Minute), Method: "GET", Path: "/unknown", Status: 404, Error: "NO_PATH_MATCHED_ERROR"},
+		// the lines overlapped with another request
+		{Time: from.Add(7 * time.Minute), Method: "GET", Path: "/users/3", Incomplete: true},
+		// out of the window
+		{Time: from.Add(-1 * time.Minute), Method: "POST", Path: "/users", Status: 422, Violations: []prismlog.Violation{missingName}},
+		{Time: to.Add(1 * time.Minute), Method: "POST", Path: "/users", Status: 422, Violations: []prismlog.Violation{missingName}},
+	}
+
+	r := report.New(from, to)
+	for _, request := range requests {
+		r.Add(operations, request)
+	}
+	return r
+}
+
+func TestAdd(t *testing.T) {
+	// test target
+	r := newReport(t)
+
+	// verify
+	assert.True(t, r.Failed())
+	assert.Equal(t, 7, r.Requests)
+	assert.Equal(t, 3, r.RequestsWithViolations)
+	assert.Equal(t, 1, r.Incomplete)
+	require.Len(t, r.Operations, 5)
+	assert.Equal(t, "(incomplete)", r.Operations[0].OperationID)
+	assert.Empty(t, r.Operations[0].Path)
+	assert.Equal(t, 1, r.Operations[0].Requests)
+	assert.Equal(t, "(unknown)", r.Operations[1].OperationID)
+	assert.Equal(t, "NO_PATH_MATCHED_ERROR", r.Operations[1].Errors[0].Type)
+	assert.Equal(t, "createUser", r.Operations[2].OperationID)
+	assert.Equal(t, 2, r.Operations[2].Requests)
+	assert.Equal(t, []*report.Error{
+		{Type: "request.body", Location: "request.body", Message: "Request body must have required property 'name'", Count: 2},
+		{Type: "request.header", Location: "request.header.x-api-key", Message: "Request header must have required property 'x-api-key'", Count: 1},
+	}, r.Operations[2].Errors)
+	assert.Equal(t, "getUser", r.Operations[3].OperationID)
+	assert.Equal(t, 2, r.Operations[3].Requests)
+	assert.Empty(t, r.Operations[3].Errors)
+}
+
+func TestFailed(t *testing.T) {
+	operations, err := openapi.ParseOperations([]byte(spec))
+	require.NoError(t, err)
+	r := report.New(time.Time{}, to)
+	r.Add(operations, &prismlog.Request{Time: from, Method: "GET", Path: "/users", Status: 200})
+
+	// test target
+	failed := r.Failed()
+
+	// verify
+	assert.False(t, failed)
+	assert.Equal(t, 1, r.Requests)
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		format report.Format
+		golden string
+	}{
+		{format: report.FormatMarkdown, golden: "report.golden.md"},
+		{format: report.FormatJSON, golden: "report.golden.json"},
+		{format: report.FormatJUnit, golden: "report.golden.xml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			r := newReport(t)
+			out := &bytes.Buffer{}
+
+			// test target
+			err := r.Write(out, tt.format)
+
+			// verify
+			require.NoError(t, err)
+			testutil.AssertGoldenText(t, tt.golden, out.String())
+		})
+	}
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	err := newReport(t).Write(&bytes.Buffer{}, "html")
+	assert.Error(t, err)
+}
@@ -0,0 +1,114 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/gold-kou/prism-in-k8s/app/openapi"
+	"github.com/gold-kou/prism-in-k8s/app/prismlog"
+	"golang.org/x/xerrors"
+)
+
+type operationSummary struct {
+	requests   int
+	violations int
+	// incomplete is the requests whose status and violations may be missing, see prismlog.Request
+	incomplete int
+}
+
+type violationSummary struct {
+	operation string
+	violation prismlog.Violation
+	count     int
+}
+
+// Summary counts the requests per operation and the contract violations, including those of the responses, for the logs mode.
+type Summary struct {
+	operations       *openapi.Operations
+	operationSummary map[string]*operationSummary
+	violations       map[string]*violationSummary
+}
+
+// NewSummary returns an empty summary. The operations of the requests are looked up in operations.
+func NewSummary(operations *openapi.Operations) *Summary {
+	return &Summary{
+		operations:       operations,
+		operationSummary: map[string]*operationSummary{},
+		violations:       map[string]*violationSummary{},
+	}
+}
+
+// Add counts the request for its operation, e.g. GET /users/1 and GET /users/2 for GET /users/{id}.
+func (s *Summary) Add(request *prismlog.Request) {
+	operation := request.Method + " " + request.Path + " " + unknownOperation
+	if matched, found := s.operations.Find(request.Method, request.Path); found {
+		operation = matched.Method + " " + matched.Path
+	}
+
+	if _, ok := s.operationSummary[operation]; !ok {
+		s.operationSummary[operation] = &operationSummary{}
+	}
+	s.operationSummary[operation].requests++
+	if len(request.Violations) > 0 {
+		s.operationSummary[operation].violations++
+	}
+	if request.Incomplete {
+		s.operationSummary[operation].incomplete++
+	}
+	for _, violation := range request.Violations {
+		key := operation + "\x00" + violation.Location + "\x00" + violation.Message
+		if _, ok := s.violations[key]; !ok {
+			s.violations[key] = &violationSummary{operation: operation, violation: violation}
+		}
+		s.violations[key].count++
+	}
+}
+
+// Write writes the requests per operation, and then the violations from the most frequent.
+// The violations of the incomplete requests may be missing, so they are counted in their own column.
+func (s *Summary) Write(out io.Writer) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0) //nolint:mnd // padding between columns
+	fmt.Fprintln(writer, "OPERATION\tREQUESTS\tWITH VIOLATIONS\tINCOMPLETE")
+	operations := make([]string, 0, len(s.operationSummary))
+	for operation := range s.operationSummary {
+		operations = append(operations, operation)
+	}
+	sort.Strings(operations)
+	for _, operation := range operations {
+		summary := s.operationSummary[operation]
+		fmt.Fprintf(writer, "%s\t%d\t%d\t%d\n", operation, summary.requests, summary.violations, summary.incomplete)
+	}
+	if err := writer.Flush(); err != nil {
+		return xerrors.Errorf("%w: %w", errFailedToWrite, err)
+	}
+
+	if len(s.violations) == 0 {
+		return nil
+	}
+	violations := make([]*violationSummary, 0, len(s.violations))
+	for _, violation := range s.violations {
+		violations = append(violations, violation)
+	}
+	sort.Slice(violations, func(i, j int) bool {
+		if violations[i].count != violations[j].count {
+			return violations[i].count > violations[j].count
+		}
+		if violations[i].operation != violations[j].operation {
+			return violations[i].operation < violations[j].operation
+		}
+		return violations[i].violation.Message < violations[j].violation.Message
+	})
+
+	fmt.Fprintln(out)
+	writer = tabwriter.NewWriter(out, 0, 0, 3, ' ', 0) //nolint:mnd // padding between columns
+	fmt.Fprintln(writer, "CONTRACT VIOLATION\tCOUNT\tOPERATION\tLOCATION\tLEVEL")
+	for _, violation := range violations {
+		fmt.Fprintf(writer, "%s\t%d\t%s\t%s\t%s\n", violation.violation.Message, violation.count, violation.operation, violation.violation.Location, violation.violation.Level)
+	}
+	if err := writer.Flush(); err != nil {
+		return xerrors.Errorf("%w: %w", errFailedToWrite, err)
+	}
+	return nil
+}
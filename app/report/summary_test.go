@@ -0,0 +1,49 @@
+package report_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gold-kou/prism-in-k8s/app/openapi"
+	"github.com/gold-kou/prism-in-k8s/app/prismlog"
+	"github.com/gold-kou/prism-in-k8s/app/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummary(t *testing.T) {
+	operations, err := openapi.ParseOperations([]byte(spec))
+	require.NoError(t, err)
+	missingName := prismlog.Violation{Location: "request.body", Message: "Request body must have required property 'name'", Level: "error"}
+	requests := []*prismlog.Request{
+		{Method: "GET", Path: "/users", Status: 200},
+		{Method: "GET", Path: "/users/1", Status: 200},
+		{Method: "GET", Path: "/users/2", Status: 200},
+		{Method: "GET", Path: "/users/3", Status: 200},
+		// overlapped with another request
+		{Method: "GET", Path: "/users/4", Incomplete: true},
+		{Method: "POST", Path: "/users", Status: 422, Violations: []prismlog.Violation{missingName}},
+		{Method: "POST", Path: "/users", Status: 422, Violations: []prismlog.Violation{missingName}},
+		{Method: "GET", Path: "/unknown", Status: 404, Error: "NO_PATH_MATCHED_ERROR"},
+	}
+	summary := report.NewSummary(operations)
+	out := &bytes.Buffer{}
+
+	// test target
+	for _, request := range requests {
+		summary.Add(request)
+	}
+	err = summary.Write(out)
+
+	// verify
+	require.NoError(t, err)
+	assert.Equal(t, `OPERATION                REQUESTS   WITH VIOLATIONS   INCOMPLETE
+GET /unknown (unknown)   1          0                 0
+GET /users               1          0                 0
+GET /users/{id}          4          0                 1
+POST /users              2          2                 0
+
+CONTRACT VIOLATION                                COUNT   OPERATION     LOCATION       LEVEL
+Request body must have required property 'name'   2       POST /users   request.body   error
+`, out.String())
+}
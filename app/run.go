@@ -2,118 +2,346 @@ package app
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"log"
+	"os"
+	"os/signal"
+	"os/user"
+	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
-	"github.com/gold-kou/prism-in-k8s/app/istio"
-	"github.com/gold-kou/prism-in-k8s/app/k8s"
+	"github.com/gold-kou/prism-in-k8s/app/connect"
+	"github.com/gold-kou/prism-in-k8s/app/openapi"
+	"github.com/gold-kou/prism-in-k8s/app/operator"
+	"github.com/gold-kou/prism-in-k8s/app/ownership"
 	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/gold-kou/prism-in-k8s/app/prismmock"
 	"github.com/gold-kou/prism-in-k8s/app/registry"
+	"github.com/gold-kou/prism-in-k8s/app/report"
 	"golang.org/x/xerrors"
+	"istio.io/client-go/pkg/clientset/versioned"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
 )
 
+const (
+	openAPIPath       = "app/openapi.yaml"
+	openAPISamplePath = "app/openapi-sample.yaml"
+	// bundledSpecPath is the OpenAPI definition built into the image, in the Docker build context
+	bundledSpecPath = "app/openapi.bundled.yaml"
+	localPrismImage = "my-local-image:v1"
+	// localFaultProxyImage is loaded into the kind cluster by make kind-up
+	localFaultProxyImage = "my-local-faultproxy:v1"
+)
+
+var errConfigPathNotSet = errors.New("PARAMS_CONFIG_PATH is not set")
+
 var (
-	isCreate      bool
-	isDelete      bool
-	isTest        bool
-	awsConfig     aws.Config
-	awsAccountID  string
-	kubeConfig    *restclient.Config
-	resourceName  string
-	namespaceName string
+	isCreate       bool
+	isDelete       bool
+	isList         bool
+	isGC           bool
+	isDryRun       bool
+	isOperator     bool
+	isConnect      bool
+	isLogs         bool
+	isFollow       bool
+	isParse        bool
+	isSummary      bool
+	isReport       bool
+	violationsOnly bool
+	isTest         bool
+	scenarioPath   string
+	includeOrphans bool
+	localPort      int
+	envFile        string
+	since          time.Duration
+	pathFilter     string
+	statusFilter   int
+	reportFormat   string
+	reportOutput   string
+	reportFrom     string
+	reportTo       string
+	awsConfig      aws.Config
+	ecrClient      registry.ECRAPI
+	awsAccountID   string
+	creator        string
+	kubeConfig     *restclient.Config
+	k8sClientSet   kubernetes.Interface
+	istioClientSet versioned.Interface
+	dynamicClient  dynamic.Interface
 )
 
 func init() {
 	// command args
 	flag.BoolVar(&isCreate, "create", false, "set to true if running in create mode")
 	flag.BoolVar(&isDelete, "delete", false, "set to true if running in delete mode")
+	flag.BoolVar(&isList, "list", false, "set to true if running in list mode")
+	flag.BoolVar(&isGC, "gc", false, "set to true if running in gc mode to delete expired mocks")
+	flag.BoolVar(&isDryRun, "dry-run", false, "set to true to only print the expired mocks in gc mode")
+	flag.BoolVar(&isOperator, "operator", false, "set to true if running as an operator reconciling PrismMock resources")
+	flag.BoolVar(&isConnect, "connect", false, "set to true to port-forward a local port to the mock until interrupted")
+	flag.IntVar(&localPort, "local-port", 0, "local port to forward in connect mode, a random port if 0")
+	flag.StringVar(&envFile, "env-file", "", "file to write the local base URL of the mock as "+connect.EnvKey+" in connect mode")
+	flag.BoolVar(&isLogs, "logs", false, "set to true to show the Prism logs of all the pods of the mock")
+	flag.BoolVar(&isFollow, "follow", false, "set to true to stream the logs until interrupted in logs mode")
+	flag.DurationVar(&since, "since", 0, "only show the logs newer than the duration, e.g. 1h, in logs and report modes")
+	flag.BoolVar(&isParse, "parse", false, "set to true to show one line per request instead of the raw logs in logs mode, marking the requests overlapping with another as incomplete")
+	flag.StringVar(&pathFilter, "path", "", "only show the requests with the path prefix in logs mode")
+	flag.IntVar(&statusFilter, "status", 0, "only show the requests responded with the status code in logs mode")
+	flag.BoolVar(&violationsOnly, "violations", false, "set to true to only show the requests with contract violations in logs mode")
+	flag.BoolVar(&isSummary, "summary", false, "set to true to show the request counts per operation and the contract violations in logs mode, counting the requests overlapping with another as incomplete")
+	flag.BoolVar(&isReport, "report", false, "set to true to report the contract violations of the requests to the mock, failing if any")
+	flag.StringVar(&reportFormat, "format", string(report.FormatMarkdown), "format of the report, markdown, json or junit, in report mode")
+	flag.StringVar(&reportOutput, "output", "", "file to write the report to instead of stdout in report mode")
+	flag.StringVar(&reportFrom, "from", "", "start of the report window in RFC3339, e.g. 2024-01-02T15:04:05Z, in report mode. -since is used if empty")
+	flag.StringVar(&reportTo, "to", "", "end of the report window in RFC3339 in report mode, now if empty")
+	flag.BoolVar(&includeOrphans, "orphans", false, "set to true to also list ECR repositories without a matching mock in list mode")
+	flag.StringVar(&scenarioPath, "scenario", "", "file of the timeline of the faults to apply to the mock, restoring them when finished or interrupted")
 	flag.BoolVar(&isTest, "test", false, "set to true if running in test mode")
 	flag.Parse()
+}
 
-	// validation parameters
-	err := params.ValidateParams()
+func Run() {
+	err := setUpKubernetes()
 	if err != nil {
 		panic(err)
 	}
 
-	if !isTest {
-		// AWS config
-		awsConfig, err = config.LoadDefaultConfig(context.Background())
+	if isOperator {
+		// no timeout because the operator runs until it is stopped
+		err = operator.Start(ctrl.SetupSignalHandler(), kubeConfig, operator.Options{MetricsBindAddress: "0"})
 		if err != nil {
-			panic(xerrors.Errorf("failed load AWS config: %v", err))
+			panic(err)
 		}
+		return
+	}
 
-		// get AWS account ID
-		stsClient := sts.NewFromConfig(awsConfig)
-		result, err := stsClient.GetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{})
+	// parameters
+	path := os.Getenv("PARAMS_CONFIG_PATH")
+	if path == "" {
+		panic(errConfigPathNotSet)
+	}
+	config, err := params.LoadConfig(path)
+	if err != nil {
+		panic(err)
+	}
+	err = params.ValidateParams(config)
+	if err != nil {
+		panic(err)
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if isConnect || (isLogs && isFollow) || scenarioPath != "" {
+		// no timeout because it runs until it is interrupted
+		ctx, cancel = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	} else {
+		ctx, cancel = context.WithTimeout(context.Background(), config.Timeout)
+	}
+	defer cancel()
+
+	// connect, logs, report and scenario modes need no AWS
+	if isConnect {
+		err = connectMock(ctx, os.Stdout, config)
+	} else if scenarioPath != "" {
+		err = runScenario(ctx, config)
+	} else if isLogs {
+		err = showLogs(ctx, os.Stdout, config)
+	} else if isReport {
+		err = writeReport(ctx, os.Stdout, config)
+	} else {
+		err = setUpAWS(ctx)
 		if err != nil {
-			panic(xerrors.Errorf("failed to get caller identity: %v", err))
+			panic(err)
+		}
+
+		if isCreate {
+			err = create(ctx, config)
+		} else if isDelete {
+			err = del(ctx, config)
+		} else if isList {
+			err = listMocks(ctx, os.Stdout, config)
+		} else if isGC {
+			err = collectGarbage(ctx)
 		}
-		awsAccountID = *result.Account
 	}
+	if err != nil {
+		panic(err)
+	}
+}
 
-	// kube config
+func setUpKubernetes() error {
+	// kube config, falling back to the in-cluster config when running as a pod (e.g. gc CronJob)
 	kubeconfigPath := clientcmd.NewDefaultPathOptions().GetDefaultFilename()
+	if _, statErr := os.Stat(kubeconfigPath); statErr != nil {
+		kubeconfigPath = ""
+	}
+	var err error
 	kubeConfig, err = clientcmd.BuildConfigFromFlags("", kubeconfigPath)
 	if err != nil {
-		panic(xerrors.Errorf("failed to build Kubeconfig: %v", err))
+		return xerrors.Errorf("failed to build Kubeconfig: %w", err)
 	}
 
-	// resource name
-	resourceName = "test-microservice"
-	namespaceName = "test-namespace"
-	if params.MicroserviceName != "" && params.MicroserviceNamespace != "" {
-		resourceName = params.MicroserviceName + params.PrismMockSuffix
-		namespaceName = params.MicroserviceNamespace + params.PrismMockSuffix
+	k8sClientSet, err = kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return xerrors.Errorf("failed to create k8s clientset: %w", err)
+	}
+	istioClientSet, err = versioned.NewForConfig(kubeConfig)
+	if err != nil {
+		return xerrors.Errorf("failed to create Istio clientset: %w", err)
+	}
+	dynamicClient, err = dynamic.NewForConfig(kubeConfig)
+	if err != nil {
+		return xerrors.Errorf("failed to create dynamic client: %w", err)
 	}
+	return nil
 }
 
-func Run() {
-	ctx, cancel := context.WithTimeout(context.Background(), params.Timeout)
-	defer cancel()
-
-	if isCreate {
-		if !isTest {
-			err := registry.BuildAndPushECR(ctx, awsConfig, awsAccountID, resourceName)
-			if err != nil {
-				panic(err)
-			}
-		}
-
-		err := k8s.CreateK8sResources(ctx, awsAccountID, awsConfig, kubeConfig, namespaceName, resourceName, params.IstioMode, isTest)
+func setUpAWS(ctx context.Context) error {
+	if isTest {
+		currentUser, err := user.Current()
 		if err != nil {
-			panic(err)
+			return xerrors.Errorf("failed to get current user: %w", err)
 		}
+		creator = currentUser.Username
+		return nil
+	}
+
+	// AWS config
+	var err error
+	awsConfig, err = awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return xerrors.Errorf("failed load AWS config: %w", err)
+	}
 
-		if params.IstioMode {
-			err = istio.CreateIstioResources(ctx, kubeConfig, namespaceName, resourceName)
-			if err != nil {
-				panic(err)
-			}
+	ecrClient = ecr.NewFromConfig(awsConfig)
+
+	// get AWS account ID
+	awsAccountID, creator, err = registry.CallerIdentity(ctx, sts.NewFromConfig(awsConfig))
+	if err != nil {
+		return err //nolint:wrapcheck // already wrapped
+	}
+	return nil
+}
+
+func newClient(config *params.Config, specFile string) (*prismmock.Client, error) {
+	options := prismmock.Options{
+		KubeClient:    k8sClientSet,
+		IstioClient:   istioClientSet,
+		DynamicClient: dynamicClient,
+		Creator:       creator,
+	}
+	if !isTest {
+		options.Registry = registry.NewECR(ecrClient, awsConfig.Region, awsAccountID, config, specFile)
+	}
+	return prismmock.New(options) //nolint:wrapcheck // nothing to add
+}
+
+// specPath returns the path of the OpenAPI definition served by the mock, with the same fallback as empty_check_and_copy.sh.
+func specPath() string {
+	if info, err := os.Stat(openAPIPath); err != nil || info.Size() == 0 {
+		return openAPISamplePath
+	}
+	return openAPIPath
+}
+
+// specSource returns spec.source of the parameters, or the path of app/openapi.yaml.
+func specSource(config *params.Config) string {
+	if config.Spec.Source != "" {
+		return config.Spec.Source
+	}
+	return specPath()
+}
+
+// loadSpec returns the OpenAPI definition of the mock with the external $refs bundled, converted to OpenAPI 3 if it is Swagger 2.0.
+func loadSpec(ctx context.Context, config *params.Config) ([]byte, error) {
+	spec, problems, err := openapi.Load(ctx, specSource(config))
+	if err != nil {
+		return nil, xerrors.Errorf("%s: %w", specSource(config), err)
+	}
+	for _, problem := range problems {
+		log.Printf("[WARN] %s: Swagger 2.0 conversion: %s", specSource(config), problem)
+	}
+	return spec, nil
+}
+
+// validateSpec validates the OpenAPI definition before the mock is created.
+// It is not a part of params.ValidateParams, because the definition is loaded from spec.source, which may be a URL,
+// and the other modes, e.g. delete, must work even if the definition got broken after the mock was created.
+// prismmock.Create and the operator validate a mounted definition with the same prismmock.ValidateOpenAPI.
+func validateSpec(source string, spec []byte) error {
+	if err := prismmock.ValidateOpenAPI(string(spec)); err != nil {
+		return xerrors.Errorf("%s: %w", source, err)
+	}
+	log.Printf("[INFO] %s is valid", source)
+	return nil
+}
+
+func newMock(config *params.Config, spec []byte) *prismmock.Mock {
+	mock := &prismmock.Mock{
+		Config: *config,
+	}
+	if spec != nil {
+		mock.SpecHash = ownership.HashSpec(spec)
+	}
+	if isTest {
+		// to get image from local
+		mock.Image = localPrismImage
+		mock.ImagePullPolicy = corev1.PullNever
+		if mock.FaultProxyImage == "" {
+			mock.FaultProxyImage = localFaultProxyImage
 		}
-		log.Println("[INFO] All resources for prism mock are created successfully")
-	} else if isDelete {
-		if params.IstioMode {
-			err := istio.DeleteIstioResources(ctx, kubeConfig, namespaceName, resourceName)
-			if err != nil {
-				panic(err)
-			}
+		if config.Spec.Source != "" {
+			// the local image has app/openapi.yaml built in
+			mock.OpenAPI = string(spec)
 		}
+	}
+	return mock
+}
 
-		err := k8s.DeleteK8sResources(ctx, kubeConfig, namespaceName, resourceName)
-		if err != nil {
-			panic(err)
+func create(ctx context.Context, config *params.Config) error {
+	spec, err := loadSpec(ctx, config)
+	if err != nil {
+		return err
+	}
+	mock := newMock(config, spec)
+	// fail fast before building and pushing the image. prismmock validates a mounted definition by itself.
+	if mock.OpenAPI == "" {
+		if err := validateSpec(specSource(config), spec); err != nil {
+			return err
 		}
+	}
 
-		err = registry.DeleteECR(ctx, awsConfig, resourceName)
-		if err != nil {
-			panic(err)
+	specFile := ""
+	if !isTest {
+		// to build the bundled definition into the image
+		specFile = bundledSpecPath
+		if err := os.WriteFile(specFile, spec, 0o600); err != nil {
+			return xerrors.Errorf("failed to write %s: %w", specFile, err)
 		}
-		log.Println("[INFO] All resources for prism mock are deleted successfully")
+		defer os.Remove(specFile)
+	}
+	client, err := newClient(config, specFile)
+	if err != nil {
+		return err
+	}
+	return client.Create(ctx, mock) //nolint:wrapcheck // nothing to add
+}
+
+func del(ctx context.Context, config *params.Config) error {
+	client, err := newClient(config, "")
+	if err != nil {
+		return err
 	}
+	return client.Delete(ctx, newMock(config, nil)) //nolint:wrapcheck // nothing to add
 }
@@ -0,0 +1,28 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/gold-kou/prism-in-k8s/app/scenario"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// runScenario applies the steps of the scenario file to the mock until they are finished or interrupted, and then restores the baseline.
+func runScenario(ctx context.Context, config *params.Config) error {
+	s, err := scenario.Load(scenarioPath)
+	if err != nil {
+		return err //nolint:wrapcheck // already wrapped
+	}
+	if err := s.Validate(config); err != nil {
+		return err //nolint:wrapcheck // already wrapped
+	}
+	mock, err := scenario.NewMock(ctx, k8sClientSet, istioClientSet, config, s)
+	if err != nil {
+		return err //nolint:wrapcheck // already wrapped
+	}
+	return scenario.Run(ctx, mock, s, func() time.Time { //nolint:wrapcheck // already wrapped
+		return metav1.Now().Time
+	})
+}
@@ -0,0 +1,163 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/faultproxy"
+	"github.com/gold-kou/prism-in-k8s/app/istio"
+	"github.com/gold-kou/prism-in-k8s/app/k8s"
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"golang.org/x/xerrors"
+	networkingv1alpha3 "istio.io/api/networking/v1alpha3"
+	"istio.io/client-go/pkg/clientset/versioned"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var errNoFaultProxy = errors.New("the mock has no fault proxy, create it with routes having a latency")
+
+// Mock applies the routes to the VirtualService of the mock in istioMode and to its fault proxy if it has one.
+type Mock struct {
+	k8sClientSet   kubernetes.Interface
+	istioClientSet versioned.Interface
+	config         params.Config
+	// the routes before the scenario. nil if not used.
+	virtualServiceRoutes []*networkingv1alpha3.HTTPRoute
+	faultProxyRoutes     *string
+	// the routes last written to the fault proxy
+	currentRoutes string
+	// stops watching the reloads of the previous routes. nil if not watching.
+	stopWatching context.CancelFunc
+}
+
+// NewMock records the current routes of the mock as the baseline, and checks that the mock can apply the routes of the steps.
+func NewMock(ctx context.Context, k8sClientSet kubernetes.Interface, istioClientSet versioned.Interface, config *params.Config, scenario *Scenario) (*Mock, error) {
+	m := &Mock{
+		k8sClientSet:   k8sClientSet,
+		istioClientSet: istioClientSet,
+		config:         *config,
+	}
+	namespaceName, resourceName := config.NamespaceName(), config.ResourceName()
+	if config.IstioMode {
+		routes, err := istio.MockRoutes(ctx, istioClientSet, namespaceName, resourceName)
+		if err != nil {
+			return nil, err //nolint:wrapcheck // already wrapped
+		}
+		m.virtualServiceRoutes = routes
+	}
+	routes, err := k8s.FaultProxyRoutes(ctx, k8sClientSet, namespaceName, resourceName)
+	switch {
+	case err == nil:
+		m.faultProxyRoutes = &routes
+		m.currentRoutes = routes
+	case !apierrors.IsNotFound(err):
+		return nil, err //nolint:wrapcheck // already wrapped
+	}
+
+	for _, step := range scenario.Steps {
+		if !m.stepConfig(step.Routes).FaultProxyEnabled() {
+			continue
+		}
+		if m.faultProxyRoutes == nil {
+			return nil, xerrors.Errorf("%w: step %q", errNoFaultProxy, step.Name)
+		}
+		log.Println("[WARN] The fault proxy reloads the routes up to about a minute after a step is started, when the kubelet syncs its ConfigMap. The reloads are logged separately")
+		break
+	}
+	return m, nil
+}
+
+func (m *Mock) stepConfig(routes []params.Route) *params.Config {
+	config := m.config
+	config.Routes = routes
+	return &config
+}
+
+// Apply replaces the routes of the mock. The baseline is restored if the routes are empty.
+func (m *Mock) Apply(ctx context.Context, routes []params.Route) error {
+	if len(routes) == 0 {
+		return m.Restore(ctx)
+	}
+	config := m.stepConfig(routes)
+	namespaceName, resourceName := config.NamespaceName(), config.ResourceName()
+	if m.virtualServiceRoutes != nil {
+		virtualService := istio.NewVirtualService(config, namespaceName, resourceName)
+		if err := istio.SetMockRoutes(ctx, m.istioClientSet, namespaceName, resourceName, virtualService.Spec.Http); err != nil {
+			return err //nolint:wrapcheck // already wrapped
+		}
+	}
+	if m.faultProxyRoutes != nil {
+		marshaled, err := faultproxy.MarshalRoutes(config.FaultProxyRoutes())
+		if err != nil {
+			return err //nolint:wrapcheck // already wrapped
+		}
+		if marshaled == m.currentRoutes {
+			return nil
+		}
+		writtenAt := metav1.Now().Time
+		if err := k8s.SetFaultProxyRoutes(ctx, m.k8sClientSet, namespaceName, resourceName, marshaled); err != nil {
+			return err //nolint:wrapcheck // already wrapped
+		}
+		m.currentRoutes = marshaled
+		m.watchReloads(ctx, writtenAt)
+	}
+	return nil
+}
+
+// watchReloads logs when the fault proxy of each pod reloads the routes written at writtenAt,
+// because the step is effective then rather than when it is started.
+// The previous watch is stopped, so a pod not reloading the routes before the next step is not logged.
+func (m *Mock) watchReloads(ctx context.Context, writtenAt time.Time) {
+	m.stopWatchingReloads()
+	ctx, m.stopWatching = context.WithCancel(ctx)
+
+	namespaceName, resourceName := m.config.NamespaceName(), m.config.ResourceName()
+	lines := make(chan k8s.LogLine)
+	go func() {
+		defer close(lines)
+		options := k8s.LogOptions{Follow: true, SinceTime: writtenAt, FaultProxy: true}
+		if err := k8s.StreamLogs(ctx, m.k8sClientSet, namespaceName, resourceName, options, lines); err != nil && ctx.Err() == nil {
+			log.Printf("[WARN] The reloads of the fault proxy are not logged: %v", err)
+		}
+	}()
+	go func() {
+		reloaded := map[string]bool{}
+		for line := range lines {
+			if reloaded[line.Pod] || !strings.Contains(line.Text, faultproxy.ReloadedMessage) {
+				continue
+			}
+			reloaded[line.Pod] = true
+			log.Printf("[INFO] %s the fault proxy of pod %s reloaded the routes", line.Time.Format(time.RFC3339), line.Pod)
+		}
+	}()
+}
+
+func (m *Mock) stopWatchingReloads() {
+	if m.stopWatching != nil {
+		m.stopWatching()
+		m.stopWatching = nil
+	}
+}
+
+// Restore puts back the routes recorded by NewMock.
+func (m *Mock) Restore(ctx context.Context) error {
+	m.stopWatchingReloads()
+	namespaceName, resourceName := m.config.NamespaceName(), m.config.ResourceName()
+	if m.virtualServiceRoutes != nil {
+		if err := istio.SetMockRoutes(ctx, m.istioClientSet, namespaceName, resourceName, m.virtualServiceRoutes); err != nil {
+			return err //nolint:wrapcheck // already wrapped
+		}
+	}
+	if m.faultProxyRoutes != nil {
+		if err := k8s.SetFaultProxyRoutes(ctx, m.k8sClientSet, namespaceName, resourceName, *m.faultProxyRoutes); err != nil {
+			return err //nolint:wrapcheck // already wrapped
+		}
+		m.currentRoutes = *m.faultProxyRoutes
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Package scenario changes the faults of a mock over time, e.g. healthy for 5 minutes, slow for 2 and failing for 1.
+package scenario
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v2"
+)
+
+// restoreTimeout is the time to restore the baseline after the scenario is interrupted.
+const restoreTimeout = 30 * time.Second
+
+var (
+	errFailedToLoadScenario = errors.New("failed to load scenario")
+	errInvalidScenario      = errors.New("invalid scenario")
+	errFailedToApplyStep    = errors.New("failed to apply step")
+	errFailedToRestore      = errors.New("failed to restore baseline")
+)
+
+// Scenario is a timeline of the faults of the mock.
+type Scenario struct {
+	Steps []Step `yaml:"steps"`
+}
+
+// Step applies the routes for the duration.
+type Step struct {
+	Name     string        `yaml:"name"`
+	Duration time.Duration `yaml:"duration"`
+	// Routes are the routes of the parameters during the step. The baseline is used if empty.
+	Routes []params.Route `yaml:"routes"`
+}
+
+// Target is where the routes of the steps are applied.
+type Target interface {
+	// Apply replaces the routes of the mock.
+	Apply(ctx context.Context, routes []params.Route) error
+	// Restore puts back the routes of the mock before the scenario.
+	Restore(ctx context.Context) error
+}
+
+// Load reads the scenario file.
+func Load(path string) (*Scenario, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("%w: %w", errFailedToLoadScenario, err)
+	}
+	var scenario Scenario
+	if err := yaml.UnmarshalStrict(content, &scenario); err != nil {
+		return nil, xerrors.Errorf("%w: %s: %w", errFailedToLoadScenario, path, err)
+	}
+	return &scenario, nil
+}
+
+// Validate checks the steps with the parameters of the mock.
+func (s *Scenario) Validate(config *params.Config) error {
+	if len(s.Steps) == 0 {
+		return xerrors.Errorf("%w: no steps", errInvalidScenario)
+	}
+	for i, step := range s.Steps {
+		if step.Duration <= 0 {
+			return xerrors.Errorf("%w: steps[%d] needs a positive duration", errInvalidScenario, i)
+		}
+		stepConfig := *config
+		stepConfig.Routes = step.Routes
+		if err := params.ValidateParams(&stepConfig); err != nil {
+			return xerrors.Errorf("%w: steps[%d]: %w", errInvalidScenario, i, err)
+		}
+	}
+	return nil
+}
+
+// Duration returns the total duration of the steps.
+func (s *Scenario) Duration() time.Duration {
+	var total time.Duration
+	for _, step := range s.Steps {
+		total += step.Duration
+	}
+	return total
+}
+
+// Run applies the steps in order and restores the baseline when the steps are finished or the context is done.
+// now is used for the timestamps of the transitions, to correlate them with the graphs of the load test.
+func Run(ctx context.Context, target Target, scenario *Scenario, now func() time.Time) (err error) {
+	defer func() {
+		// the context may be already canceled by an interrupt
+		restoreCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), restoreTimeout)
+		defer cancel()
+		if restoreErr := target.Restore(restoreCtx); restoreErr != nil {
+			err = errors.Join(err, xerrors.Errorf("%w: %w", errFailedToRestore, restoreErr))
+			return
+		}
+		log.Printf("[INFO] %s baseline is restored", now().Format(time.RFC3339))
+	}()
+
+	log.Printf("[INFO] %s scenario is started with %d steps for %s", now().Format(time.RFC3339), len(scenario.Steps), scenario.Duration())
+	for i, step := range scenario.Steps {
+		if err := target.Apply(ctx, step.Routes); err != nil {
+			return xerrors.Errorf("%w: %s: %w", errFailedToApplyStep, step.Name, err)
+		}
+		log.Printf("[INFO] %s step %d/%d %q is started for %s", now().Format(time.RFC3339), i+1, len(scenario.Steps), step.Name, step.Duration)
+
+		timer := time.NewTimer(step.Duration)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Printf("[WARN] %s scenario is interrupted in step %q", now().Format(time.RFC3339), step.Name)
+			return nil
+		case <-timer.C:
+		}
+	}
+	log.Printf("[INFO] %s scenario is finished", now().Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,299 @@
+package scenario_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/faultproxy"
+	"github.com/gold-kou/prism-in-k8s/app/istio"
+	"github.com/gold-kou/prism-in-k8s/app/k8s"
+	"github.com/gold-kou/prism-in-k8s/app/params"
+	"github.com/gold-kou/prism-in-k8s/app/scenario"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	istiofake "istio.io/client-go/pkg/clientset/versioned/fake"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var (
+	slowRoutes    = []params.Route{{Name: "all", Latency: params.Latency{P50: time.Second}}}
+	failingRoutes = []params.Route{{Name: "all", Fault: params.Fault{Abort: params.FaultAbort{HTTPStatus: 503}}}}
+)
+
+func newConfig(istioMode bool) *params.Config {
+	config := &params.Config{
+		MicroserviceName:      "sample",
+		MicroserviceNamespace: "sample",
+		PrismMockSuffix:       "-prism-mock",
+		IstioMode:             istioMode,
+	}
+	config.SetDefaults()
+	return config
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantSteps int
+		wantErr   bool
+	}{
+		{
+			name:      "steps",
+			content:   "steps:\n  - name: healthy\n    duration: 5m\n  - name: failing\n    duration: 1m\n    routes:\n      - name: all\n        fault:\n          abort:\n            httpStatus: 503\n",
+			wantSteps: 2,
+		},
+		{
+			name:    "unknown field",
+			content: "steps:\n  - name: healthy\n    wait: 5m\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "scenario.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+
+			// test target
+			got, err := scenario.Load(path)
+
+			// verify
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, got.Steps, tt.wantSteps)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		steps     []scenario.Step
+		istioMode bool
+		wantErr   bool
+	}{
+		{
+			name:      "valid",
+			steps:     []scenario.Step{{Name: "healthy", Duration: time.Minute}, {Name: "failing", Duration: time.Minute, Routes: failingRoutes}},
+			istioMode: true,
+		},
+		{
+			name:    "no steps",
+			wantErr: true,
+		},
+		{
+			name:    "no duration",
+			steps:   []scenario.Step{{Name: "healthy"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid routes",
+			steps:   []scenario.Step{{Name: "timeout", Duration: time.Minute, Routes: []params.Route{{Name: "all", Timeout: time.Second}}}},
+			wantErr: true, // timeout requires istioMode
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &scenario.Scenario{Steps: tt.steps}
+
+			// test target
+			err := s.Validate(newConfig(tt.istioMode))
+
+			// verify
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+// recorder records the calls of the scenario, and cancels the context when the routes are applied if cancelOn is set.
+type recorder struct {
+	calls      []string
+	cancelOn   string
+	cancel     context.CancelFunc
+	restoreErr error
+}
+
+func (r *recorder) Apply(_ context.Context, routes []params.Route) error {
+	name := "baseline"
+	if len(routes) > 0 {
+		name = routes[0].Name
+	}
+	r.calls = append(r.calls, "apply "+name)
+	if name == r.cancelOn {
+		r.cancel()
+	}
+	return nil
+}
+
+func (r *recorder) Restore(ctx context.Context) error {
+	// the baseline is restored even after the interrupt
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	r.calls = append(r.calls, "restore")
+	return r.restoreErr
+}
+
+func TestRun(t *testing.T) {
+	steps := []scenario.Step{
+		{Name: "healthy", Duration: time.Millisecond},
+		{Name: "slow", Duration: time.Millisecond, Routes: []params.Route{{Name: "slow"}}},
+		{Name: "failing", Duration: time.Millisecond, Routes: []params.Route{{Name: "failing"}}},
+	}
+	tests := []struct {
+		name       string
+		cancelOn   string
+		restoreErr error
+		wantCalls  []string
+		wantErr    bool
+	}{
+		{
+			name:      "finished",
+			wantCalls: []string{"apply baseline", "apply slow", "apply failing", "restore"},
+		},
+		{
+			name:      "interrupted",
+			cancelOn:  "slow",
+			wantCalls: []string{"apply baseline", "apply slow", "restore"},
+		},
+		{
+			name:       "restore error",
+			restoreErr: errors.New("conflict"),
+			wantCalls:  []string{"apply baseline", "apply slow", "apply failing", "restore"},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			target := &recorder{cancelOn: tt.cancelOn, cancel: cancel, restoreErr: tt.restoreErr}
+
+			// test target
+			err := scenario.Run(ctx, target, &scenario.Scenario{Steps: steps}, time.Now)
+
+			// verify
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantCalls, target.calls)
+		})
+	}
+}
+
+func TestMock(t *testing.T) {
+	ctx := context.TODO()
+	config := newConfig(true)
+	config.Routes = []params.Route{{Name: "baseline", Latency: params.Latency{P50: 10 * time.Millisecond}}}
+	namespaceName, resourceName := config.NamespaceName(), config.ResourceName()
+	configMap, err := k8s.NewFaultProxyConfigMap(config, namespaceName, resourceName)
+	require.NoError(t, err)
+	k8sClientSet := fake.NewSimpleClientset(configMap)
+	istioClientSet := istiofake.NewSimpleClientset(istio.NewVirtualService(config, namespaceName, resourceName))
+	s := &scenario.Scenario{Steps: []scenario.Step{
+		{Name: "slow", Duration: time.Minute, Routes: slowRoutes},
+		{Name: "failing", Duration: time.Minute, Routes: failingRoutes},
+	}}
+	mock, err := scenario.NewMock(ctx, k8sClientSet, istioClientSet, config, s)
+	require.NoError(t, err)
+
+	// test target
+	err = mock.Apply(ctx, failingRoutes)
+
+	// verify
+	require.NoError(t, err)
+	routes, err := istio.MockRoutes(ctx, istioClientSet, namespaceName, resourceName)
+	require.NoError(t, err)
+	assert.Equal(t, "all", routes[0].GetName())
+	assert.Equal(t, int32(503), routes[0].GetFault().GetAbort().GetHttpStatus())
+	proxyRoutes, err := k8s.FaultProxyRoutes(ctx, k8sClientSet, namespaceName, resourceName)
+	require.NoError(t, err)
+	unmarshaled, err := faultproxy.UnmarshalRoutes([]byte(proxyRoutes))
+	require.NoError(t, err)
+	// the faults are left to Istio in istioMode
+	require.Len(t, unmarshaled, 1)
+	assert.Equal(t, "all", unmarshaled[0].Name)
+	assert.False(t, unmarshaled[0].Fault.Enabled())
+
+	// test target
+	err = mock.Restore(ctx)
+
+	// verify
+	require.NoError(t, err)
+	routes, err = istio.MockRoutes(ctx, istioClientSet, namespaceName, resourceName)
+	require.NoError(t, err)
+	assert.Equal(t, "baseline", routes[0].GetName())
+	proxyRoutes, err = k8s.FaultProxyRoutes(ctx, k8sClientSet, namespaceName, resourceName)
+	require.NoError(t, err)
+	assert.Equal(t, configMap.Data[faultproxy.RoutesKey], proxyRoutes)
+}
+
+func TestNewMock(t *testing.T) {
+	tests := []struct {
+		name       string
+		istioMode  bool
+		faultProxy bool
+		steps      []scenario.Step
+		wantErr    bool
+	}{
+		{
+			name:      "faults by istio",
+			istioMode: true,
+			steps:     []scenario.Step{{Name: "failing", Duration: time.Minute, Routes: failingRoutes}},
+		},
+		{
+			name:      "latency without the fault proxy",
+			istioMode: true,
+			steps:     []scenario.Step{{Name: "slow", Duration: time.Minute, Routes: slowRoutes}},
+			wantErr:   true,
+		},
+		{
+			name:    "faults without the fault proxy",
+			steps:   []scenario.Step{{Name: "failing", Duration: time.Minute, Routes: failingRoutes}},
+			wantErr: true,
+		},
+		{
+			name:       "faults by the fault proxy",
+			faultProxy: true,
+			steps:      []scenario.Step{{Name: "failing", Duration: time.Minute, Routes: failingRoutes}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			config := newConfig(tt.istioMode)
+			existing := []runtime.Object{}
+			if tt.faultProxy {
+				configMap, err := k8s.NewFaultProxyConfigMap(config, config.NamespaceName(), config.ResourceName())
+				require.NoError(t, err)
+				existing = append(existing, configMap)
+			}
+			k8sClientSet := fake.NewSimpleClientset(existing...)
+			istioClientSet := istiofake.NewSimpleClientset(istio.NewVirtualService(config, config.NamespaceName(), config.ResourceName()))
+
+			// test target
+			_, err := scenario.NewMock(ctx, k8sClientSet, istioClientSet, config, &scenario.Scenario{Steps: tt.steps})
+
+			// verify
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
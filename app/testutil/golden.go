@@ -0,0 +1,37 @@
+package testutil
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// AssertGolden compares the YAML of obj with testdata/<name>.golden.yaml.
+// Run `go test ./... -update` to regenerate the golden files after an intended change, and review the diff.
+func AssertGolden(t *testing.T, name string, obj interface{}) {
+	t.Helper()
+	actual, err := yaml.Marshal(obj)
+	require.NoError(t, err)
+	AssertGoldenText(t, name+".golden.yaml", string(actual))
+}
+
+// AssertGoldenText compares the text with testdata/<filename>, e.g. a rendered report.
+func AssertGoldenText(t *testing.T, filename, actual string) {
+	t.Helper()
+	path := filepath.Join("testdata", filename)
+	if *update {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(actual), 0o600))
+	}
+
+	expected, err := os.ReadFile(path)
+	require.NoError(t, err, "run the test with -update to create the golden file")
+	assert.Equal(t, string(expected), actual)
+}
@@ -0,0 +1,72 @@
+// Command faultproxy runs the fault proxy in front of Prism in the pod of the mock.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gold-kou/prism-in-k8s/app/faultproxy"
+	"github.com/gold-kou/prism-in-k8s/app/params"
+)
+
+const (
+	reloadInterval  = 5 * time.Second
+	shutdownTimeout = 30 * time.Second
+	readTimeout     = 10 * time.Second
+)
+
+func main() {
+	listen := flag.String("listen", ":"+strconv.Itoa(params.FaultProxyPort), "address to listen on")
+	target := flag.String("target", "http://127.0.0.1:80", "base URL of Prism")
+	routesPath := flag.String("routes", "/faultproxy/"+faultproxy.RoutesKey, "file of the routes, reloaded when it changes")
+	flag.Parse()
+
+	targetURL, err := url.Parse(*target)
+	if err != nil {
+		log.Fatalf("[ERROR] invalid target: %v", err)
+	}
+	read := func() ([]byte, error) {
+		return os.ReadFile(*routesPath)
+	}
+	content, err := read()
+	if err != nil {
+		log.Fatalf("[ERROR] failed to read the routes: %v", err)
+	}
+	routes, err := faultproxy.UnmarshalRoutes(content)
+	if err != nil {
+		log.Fatalf("[ERROR] %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	proxy := faultproxy.New(targetURL, routes)
+	go faultproxy.Watch(ctx, proxy, read, reloadInterval)
+
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           proxy,
+		ReadHeaderTimeout: readTimeout,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer shutdownCancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("[WARN] failed to shut down: %v", err)
+		}
+	}()
+
+	log.Printf("[INFO] Proxying %s to %s with %d routes", *listen, targetURL, len(routes))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("[ERROR] %v", err)
+	}
+}